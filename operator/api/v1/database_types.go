@@ -0,0 +1,125 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DatabaseEngine names a database server the operator can run
+// +kubebuilder:validation:Enum=postgres;redis
+type DatabaseEngine string
+
+const (
+	EnginePostgres DatabaseEngine = "postgres"
+	EngineRedis    DatabaseEngine = "redis"
+)
+
+// DatabaseSpec defines the desired state of Database
+type DatabaseSpec struct {
+	// Engine is the database server, it cannot change once created
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="engine is immutable"
+	Engine DatabaseEngine `json:"engine"`
+
+	// Version is the image tag of the engine, 16 for postgres and 7 for
+	// redis by default. Postgres data cannot move to another major version
+	// in place.
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)*$`
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Size of the data volume, such as 1Gi. It can grow but not shrink, up to
+	// 50Gi like the volumes of a WebApp, within the requests.storage quota
+	// of the namespace.
+	// +kubebuilder:validation:XValidation:rule="quantity(string(self)).compareTo(quantity('50Gi')) <= 0",message="size must not exceed 50Gi"
+	Size resource.Quantity `json:"size"`
+
+	// StorageClassName picks the storage class, the cluster default when unset
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="storageClassName is immutable"
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// Resources sets the requests and limits of the database container
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// DatabaseStatus defines the observed state of Database.
+type DatabaseStatus struct {
+	// Conditions hold Available for the database server
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// ObservedGeneration is the generation the status was computed for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Version is the engine version the server runs
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// SecretName is the Secret holding the connection details: url, host,
+	// port, username, password and database
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// Host is the in-cluster name of the server
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Port the server listens on
+	// +optional
+	Port int32 `json:"port,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Engine",type=string,JSONPath=`.spec.engine`
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.version`
+// +kubebuilder:printcolumn:name="Available",type=string,JSONPath=`.status.conditions[?(@.type=="Available")].status`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.conditions[?(@.type=="Available")].reason`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Database is the Schema for the databases API
+type Database struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitzero"`
+
+	// +required
+	Spec DatabaseSpec `json:"spec"`
+
+	// +optional
+	Status DatabaseStatus `json:"status,omitzero"`
+}
+
+// +kubebuilder:object:root=true
+
+// DatabaseList contains a list of Database
+type DatabaseList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitzero"`
+	Items           []Database `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Database{}, &DatabaseList{})
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PlatformConfigName is the only PlatformConfig the operator reads
+const PlatformConfigName = "default"
+
+// PlatformSettings are the cluster specific values WebApps are deployed with.
+// Empty fields keep the value of the level below: operator flags and config
+// file, then the PlatformConfig, then its namespace overrides.
+type PlatformSettings struct {
+	// BaseDomain is the parent domain of the app subdomains
+	// +optional
+	BaseDomain string `json:"baseDomain,omitempty"`
+
+	// GatewayName is the Gateway the HTTPRoutes attach to
+	// +optional
+	GatewayName string `json:"gatewayName,omitempty"`
+
+	// GatewayNamespace is the namespace of the Gateway
+	// +optional
+	GatewayNamespace string `json:"gatewayNamespace,omitempty"`
+
+	// DNSTarget is the address ExternalDNS points the app records to
+	// +optional
+	DNSTarget string `json:"dnsTarget,omitempty"`
+
+	// ImagePullSecret is the Secret pods pull app images with
+	// +optional
+	ImagePullSecret string `json:"imagePullSecret,omitempty"`
+
+	// ClusterIssuer is the cert-manager ClusterIssuer of custom domain certificates
+	// +optional
+	ClusterIssuer string `json:"clusterIssuer,omitempty"`
+
+	// RouteAnnotations are added to every HTTPRoute, e.g. the Cloudflare
+	// settings of ExternalDNS. Keys are merged with the level below.
+	// +optional
+	RouteAnnotations map[string]string `json:"routeAnnotations,omitempty"`
+}
+
+// NamespacePlatformSettings overrides the settings of a single namespace
+type NamespacePlatformSettings struct {
+	// +kubebuilder:validation:MinLength=1
+	Namespace string `json:"namespace"`
+
+	PlatformSettings `json:",inline"`
+}
+
+// PlatformConfigSpec defines the desired state of PlatformConfig
+type PlatformConfigSpec struct {
+	PlatformSettings `json:",inline"`
+
+	// Namespaces overrides the settings for single namespaces
+	// +listType=map
+	// +listMapKey=namespace
+	// +optional
+	Namespaces []NamespacePlatformSettings `json:"namespaces,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:validation:XValidation:rule="self.metadata.name == 'default'",message="only the PlatformConfig named default is read"
+
+// PlatformConfig is the Schema for the platformconfigs API. It overrides the
+// operator's settings without a restart.
+type PlatformConfig struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitzero"`
+
+	// +required
+	Spec PlatformConfigSpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// PlatformConfigList contains a list of PlatformConfig
+type PlatformConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitzero"`
+	Items           []PlatformConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PlatformConfig{}, &PlatformConfigList{})
+}
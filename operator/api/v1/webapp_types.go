@@ -5,44 +5,627 @@ Copyright 2025.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // WebAppSpec defines the desired state of WebApp
+// +kubebuilder:validation:XValidation:rule="!has(self.minReplicas) || !has(self.maxReplicas) || self.minReplicas <= self.maxReplicas",message="minReplicas must not exceed maxReplicas"
 type WebAppSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
-	
+
 	// +kubebuilder:validation:MinLength=1
 	DisplayName string `json:"displayName,omitempty"`
 
 	// ADDED: The UUID from the build request
 	ContainerID string `json:"containerID,omitempty"`
 
-	RepoURL     string `json:"repoURL,omitempty"`
-	Branch      string `json:"branch,omitempty"`
-	
-	// +kubebuilder:validation:Required
+	RepoURL string `json:"repoURL,omitempty"`
+	Branch  string `json:"branch,omitempty"`
+
+	// GitCredentials names the project's Git credentials used to clone RepoURL
+	// +optional
+	GitCredentials string `json:"gitCredentials,omitempty"`
+
+	// Image is only set once a build of it has succeeded; until then the
+	// WebApp has no workload
+	// +optional
 	Image string `json:"image,omitempty"`
-	
+
+	// Commit is the Git SHA Image was built from
+	// +kubebuilder:validation:Pattern=`^[0-9a-f]{40}$`
+	// +optional
+	Commit string `json:"commit,omitempty"`
+
+	// Port is the HTTP port of the app, routed at the app subdomain
 	// +kubebuilder:validation:Minimum=1
 	// +kubebuilder:validation:Maximum=65535
 	// +kubebuilder:default=8080
 	Port int `json:"port,omitempty"`
-	
+
+	// Ports are extra ports serving gRPC, TCP or UDP, see status.endpoints
+	// for where they are reachable
+	// +kubebuilder:validation:MaxItems=10
+	// +kubebuilder:validation:XValidation:rule="self.all(a, self.exists_one(b, b.port == a.port && (has(b.protocol) ? b.protocol : 'TCP') == (has(a.protocol) ? a.protocol : 'TCP')))",message="every port needs its own number and protocol"
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Ports []AppPort `json:"ports,omitempty"`
+
 	// +optional
 	EnvVariables map[string]string `json:"envVariables,omitempty"`
+
+	// SecretEnv names variables whose values are kept in the Secret
+	// "<name>-env", so they never show up in the CR
+	// +listType=set
+	// +optional
+	SecretEnv []string `json:"secretEnv,omitempty"`
+
+	// Replicas is the fixed number of pods, used while autoscaling is off
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// MinReplicas is the lower bound of the autoscaler, defaults to 1
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas turns autoscaling on when set
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+
+	// TargetCPUUtilization is the average CPU usage, in percent of the
+	// requested CPU, the autoscaler aims for. Defaults to 80.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	TargetCPUUtilization *int32 `json:"targetCPUUtilization,omitempty"`
+
+	// Plan names an entry of the operator's resource plans, e.g. small,
+	// medium or large. Defaults to the operator's default plan.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +optional
+	Plan string `json:"plan,omitempty"`
+
+	// Resources overrides the requests and limits of the plan
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// CustomDomains are served in addition to the platform subdomain once
+	// their ownership is verified through a TXT record, see status.domains
+	// +kubebuilder:validation:MaxItems=10
+	// +kubebuilder:validation:items:Pattern=`^([a-z0-9]([-a-z0-9]*[a-z0-9])?\.)+[a-z]{2,63}$`
+	// +kubebuilder:validation:items:MaxLength=253
+	// +listType=set
+	// +optional
+	CustomDomains []string `json:"customDomains,omitempty"`
+
+	// Strategy controls how a new image or configuration is rolled out
+	// +optional
+	Strategy *DeploymentStrategy `json:"strategy,omitempty"`
+
+	// HealthCheck configures the readiness, liveness and startup probes.
+	// Without it the app port is probed over TCP.
+	// +optional
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+
+	// Volumes are persistent disks mounted into the app. A ReadWriteOnce
+	// volume can only be attached to one pod, so the WebApp then runs a
+	// single replica, without autoscaling, replaced with a Recreate rollout.
+	// +kubebuilder:validation:MaxItems=10
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Volumes []Volume `json:"volumes,omitempty"`
+
+	// Databases binds Databases of the namespace, whose connection details
+	// reach the app as environment variables
+	// +kubebuilder:validation:MaxItems=5
+	// +kubebuilder:validation:XValidation:rule="self.all(a, self.exists_one(b, (has(b.envPrefix) ? b.envPrefix : 'DATABASE') == (has(a.envPrefix) ? a.envPrefix : 'DATABASE')))",message="every database needs its own envPrefix"
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Databases []DatabaseBinding `json:"databases,omitempty"`
+
+	// Build records how the image was built, so rebuilds are reproducible
+	// +optional
+	Build *BuildConfig `json:"build,omitempty"`
+}
+
+// VolumeAccessMode is how many pods can mount a volume
+// +kubebuilder:validation:Enum=ReadWriteOnce;ReadWriteMany
+type VolumeAccessMode string
+
+const (
+	ReadWriteOnce VolumeAccessMode = "ReadWriteOnce"
+	ReadWriteMany VolumeAccessMode = "ReadWriteMany"
+)
+
+// Volume is a PersistentVolumeClaim owned by the WebApp, named after both
+// +kubebuilder:validation:XValidation:rule="!has(oldSelf.storageClassName) || (has(self.storageClassName) && self.storageClassName == oldSelf.storageClassName)",message="storageClassName is immutable"
+// +kubebuilder:validation:XValidation:rule="!has(oldSelf.accessMode) || (has(self.accessMode) && self.accessMode == oldSelf.accessMode)",message="accessMode is immutable"
+type Volume struct {
+	// Name identifies the volume within the WebApp
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=40
+	Name string `json:"name"`
+
+	// MountPath is where the volume appears in the container
+	// +kubebuilder:validation:Pattern=`^/.*`
+	MountPath string `json:"mountPath"`
+
+	// Size of the volume, such as 1Gi. It can grow but not shrink, up to
+	// 50Gi, within the requests.storage quota of the namespace.
+	// +kubebuilder:validation:XValidation:rule="quantity(string(self)).compareTo(quantity('50Gi')) <= 0",message="size must not exceed 50Gi"
+	Size resource.Quantity `json:"size"`
+
+	// StorageClassName picks the storage class, the cluster default when unset
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// AccessMode defaults to ReadWriteOnce
+	// +optional
+	AccessMode VolumeAccessMode `json:"accessMode,omitempty"`
+}
+
+// PortProtocol is what an extra port serves
+// +kubebuilder:validation:Enum=GRPC;TCP;UDP
+type PortProtocol string
+
+const (
+	ProtocolGRPC PortProtocol = "GRPC"
+	ProtocolTCP  PortProtocol = "TCP"
+	ProtocolUDP  PortProtocol = "UDP"
+)
+
+// PortExposure is how an extra port is reached from outside the cluster
+// +kubebuilder:validation:Enum=Gateway;LoadBalancer;NodePort
+type PortExposure string
+
+const (
+	// ExposeGateway routes the port through the platform Gateway: a
+	// GRPCRoute at <name>-<app>.<baseDomain>, or a TCPRoute or UDPRoute
+	// attached to a listener of the Gateway
+	ExposeGateway PortExposure = "Gateway"
+	// ExposeLoadBalancer gives the port a LoadBalancer Service of its own
+	ExposeLoadBalancer PortExposure = "LoadBalancer"
+	// ExposeNodePort opens the port on every node through a NodePort Service
+	ExposeNodePort PortExposure = "NodePort"
+)
+
+// AppPort is a port of the app besides the HTTP one
+// +kubebuilder:validation:XValidation:rule="!has(self.protocol) || self.protocol != 'GRPC' || !has(self.expose) || self.expose == 'Gateway'",message="GRPC ports are exposed through the Gateway"
+// +kubebuilder:validation:XValidation:rule="has(self.listener) == ((!has(self.expose) || self.expose == 'Gateway') && (!has(self.protocol) || self.protocol != 'GRPC'))",message="listener is required for TCP and UDP ports exposed through the Gateway, and only for them"
+type AppPort struct {
+	// Name identifies the port, it also names its Service port. "http" is
+	// the name of the HTTP port.
+	// +kubebuilder:validation:XValidation:rule="self != 'http'",message="http is reserved for the HTTP port"
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=15
+	Name string `json:"name"`
+
+	// Port the container listens on
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+
+	// Protocol defaults to TCP
+	// +kubebuilder:default=TCP
+	// +optional
+	Protocol PortProtocol `json:"protocol,omitempty"`
+
+	// Expose defaults to Gateway. LoadBalancer and NodePort Services count
+	// against the services.loadbalancers and services.nodeports quota of the
+	// namespace.
+	// +optional
+	Expose PortExposure `json:"expose,omitempty"`
+
+	// Listener names the listener of the platform Gateway a TCP or UDP port
+	// exposed through the Gateway attaches to. The platform provisions it
+	// with the matching protocol, for this port alone.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +optional
+	Listener string `json:"listener,omitempty"`
+}
+
+// DatabaseBinding injects the connection details of a Database as
+// <envPrefix>_URL, _HOST, _PORT, _USER, _PASSWORD and _NAME
+type DatabaseBinding struct {
+	// Name of the Database
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// EnvPrefix defaults to DATABASE, giving DATABASE_URL and so on
+	// +kubebuilder:validation:Pattern=`^[A-Z_][A-Z0-9_]*$`
+	// +kubebuilder:validation:MaxLength=50
+	// +optional
+	EnvPrefix string `json:"envPrefix,omitempty"`
+}
+
+// StrategyType names a way of rolling out a WebApp
+// +kubebuilder:validation:Enum=RollingUpdate;BlueGreen;Canary
+type StrategyType string
+
+const (
+	// StrategyRollingUpdate replaces the pods of the Deployment in place
+	StrategyRollingUpdate StrategyType = "RollingUpdate"
+	// StrategyBlueGreen brings the new version up next to the old one and
+	// switches all traffic at once when it is ready
+	StrategyBlueGreen StrategyType = "BlueGreen"
+	// StrategyCanary runs the new version next to the old one and shifts
+	// the traffic to it in weighted steps
+	StrategyCanary StrategyType = "Canary"
+)
+
+// DeploymentStrategy describes how changes reach the running pods
+type DeploymentStrategy struct {
+	// Type defaults to RollingUpdate
+	// +optional
+	Type StrategyType `json:"type,omitempty"`
+
+	// RollingUpdate tunes the RollingUpdate type
+	// +optional
+	RollingUpdate *RollingUpdateStrategy `json:"rollingUpdate,omitempty"`
+
+	// BlueGreen tunes the BlueGreen type
+	// +optional
+	BlueGreen *BlueGreenStrategy `json:"blueGreen,omitempty"`
+
+	// Canary tunes the Canary type
+	// +optional
+	Canary *CanaryStrategy `json:"canary,omitempty"`
+}
+
+// RollingUpdateStrategy bounds the pods added and removed at a time
+type RollingUpdateStrategy struct {
+	// MaxSurge is the number or percentage of pods created above the
+	// desired count during an update, defaults to 25%
+	// +optional
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+
+	// MaxUnavailable is the number or percentage of pods that may be
+	// unavailable during an update, defaults to 25%
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// BlueGreenStrategy tunes blue/green rollouts
+type BlueGreenStrategy struct {
+	// ScaleDownDelaySeconds is how long the previous version keeps running
+	// after the switch, so it can be switched back to instantly. Defaults
+	// to 300.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ScaleDownDelaySeconds *int32 `json:"scaleDownDelaySeconds,omitempty"`
+}
+
+// CanaryStrategy lists the traffic steps of a canary release. Once the last
+// step passed, the new version replaces the stable one.
+type CanaryStrategy struct {
+	// Steps default to 10% then 50% of the traffic, five minutes each
+	// +kubebuilder:validation:MaxItems=10
+	// +optional
+	Steps []CanaryStep `json:"steps,omitempty"`
 }
 
+// CanaryStep sends a share of the traffic to the canary
+type CanaryStep struct {
+	// Weight is the percentage of requests the canary receives
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
+
+	// PauseSeconds is how long the step lasts. Without it the step lasts
+	// until the release is promoted.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	PauseSeconds *int32 `json:"pauseSeconds,omitempty"`
+}
+
+// CanaryActionAnnotation asks the operator to promote a canary to its next
+// step or to abort it. The operator removes it once handled.
+const CanaryActionAnnotation = "kleff.io/canary-action"
+
+// CanaryActionIDAnnotation identifies a canary action, so the operator
+// applies it once even when removing the annotation fails. Actions without
+// an ID are applied every time they are seen.
+const CanaryActionIDAnnotation = "kleff.io/canary-action-id"
+
+const (
+	CanaryActionPromote = "promote"
+	CanaryActionAbort   = "abort"
+)
+
+// ProbeKind names a container probe
+// +kubebuilder:validation:Enum=readiness;liveness;startup
+type ProbeKind string
+
+const (
+	ReadinessProbe ProbeKind = "readiness"
+	LivenessProbe  ProbeKind = "liveness"
+	StartupProbe   ProbeKind = "startup"
+)
+
+// HealthCheck describes how the app reports its health
+// +kubebuilder:validation:XValidation:rule="!has(self.type) || self.type != 'http' || has(self.path)",message="path is required for http health checks"
+type HealthCheck struct {
+	// Type is http, which expects a 2xx or 3xx answer on Path, or tcp,
+	// which only expects the port to accept connections. Defaults to http
+	// when Path is set.
+	// +kubebuilder:validation:Enum=http;tcp
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// Path is requested with GET, e.g. /healthz
+	// +kubebuilder:validation:Pattern=`^/`
+	// +kubebuilder:validation:MaxLength=1024
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Port defaults to the app port
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+
+	// InitialDelaySeconds is waited before the first check
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+
+	// PeriodSeconds is the interval between checks, defaults to 10
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+
+	// TimeoutSeconds bounds a single check, defaults to 3
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// SuccessThreshold is the number of passed checks after which a pod
+	// receives traffic again, defaults to 1
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	SuccessThreshold *int32 `json:"successThreshold,omitempty"`
+
+	// FailureThreshold is the number of failed checks after which a pod
+	// stops receiving traffic or is restarted, defaults to 3
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+
+	// StartupTimeoutSeconds is how long the app may take to boot before it
+	// is restarted, defaults to 300
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	StartupTimeoutSeconds *int32 `json:"startupTimeoutSeconds,omitempty"`
+
+	// Probes selects the probes using this check, all three by default
+	// +listType=set
+	// +optional
+	Probes []ProbeKind `json:"probes,omitempty"`
+}
+
+// BuildConfig holds the Kaniko options used to build a WebApp image
+type BuildConfig struct {
+	// DockerfilePath is relative to the build context
+	// +kubebuilder:default=Dockerfile
+	// +optional
+	DockerfilePath string `json:"dockerfilePath,omitempty"`
+
+	// ContextSubPath is the repository subdirectory used as build context
+	// +optional
+	ContextSubPath string `json:"contextSubPath,omitempty"`
+
+	// +optional
+	BuildArgs map[string]string `json:"buildArgs,omitempty"`
+
+	// Target is the stage to build in a multi-stage Dockerfile
+	// +optional
+	Target string `json:"target,omitempty"`
+}
+
+// TriggeredByAnnotation names the user behind the latest change of spec.image
+const TriggeredByAnnotation = "kleff.io/triggered-by"
+
+// MaxRevisionHistory bounds the number of revisions kept in the status
+const MaxRevisionHistory = 10
+
+// Slots of the BlueGreen strategy. The blue slot is the WebApp's own
+// Deployment and Service, the green slot carries a "-green" suffix.
+const (
+	SlotBlue  = "blue"
+	SlotGreen = "green"
+)
+
+// BlueGreenStatus records which slot serves the traffic
+type BlueGreenStatus struct {
+	// ActiveSlot is blue or green
+	ActiveSlot string `json:"activeSlot"`
+
+	// SwitchedAt is when the traffic moved to ActiveSlot
+	// +optional
+	SwitchedAt *metav1.Time `json:"switchedAt,omitempty"`
+}
+
+// CanaryStatus records the progress of a canary release
+type CanaryStatus struct {
+	// Image is the image under test
+	Image string `json:"image"`
+
+	// TemplateHash identifies the pod template under test
+	TemplateHash string `json:"templateHash"`
+
+	// Step is the index of the current step in spec.strategy.canary.steps
+	Step int32 `json:"step"`
+
+	// Weight is the percentage of requests the canary currently receives
+	Weight int32 `json:"weight"`
+
+	// StepStartedAt is when the current step began, unset while the canary
+	// pods are starting
+	// +optional
+	StepStartedAt *metav1.Time `json:"stepStartedAt,omitempty"`
+
+	// Aborted is set when the release was aborted; it stays so until the
+	// spec changes again
+	// +optional
+	Aborted bool `json:"aborted,omitempty"`
+
+	// LastAction is the ID of the last canary action applied, recorded
+	// before its annotation is removed
+	// +optional
+	LastAction string `json:"lastAction,omitempty"`
+}
+
+// Condition types of a WebApp
+const (
+	// ConditionAvailable is true while at least one pod serves traffic
+	ConditionAvailable = "Available"
+	// ConditionProgressing is true while a rollout is under way
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded is true when pods fail to pull, start or roll out
+	ConditionDegraded = "Degraded"
+)
+
 // WebAppStatus defines the observed state of WebApp.
 type WebAppStatus struct {
+	// Conditions are Available, Progressing and Degraded
 	// +listType=map
 	// +listMapKey=type
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// ObservedGeneration is the generation of the spec the status reflects
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// URL is the platform address of the app
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// Replicas is the number of pods the Deployment currently wants
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// ReadyReplicas is the number of pods passing their readiness probe
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// CurrentImage is the image of the last rollout that completed
+	// +optional
+	CurrentImage string `json:"currentImage,omitempty"`
+
+	// LastDeployedAt is when CurrentImage finished rolling out
+	// +optional
+	LastDeployedAt *metav1.Time `json:"lastDeployedAt,omitempty"`
+
+	// Commit is the Git SHA of the image that was rolled out last
+	// +optional
+	Commit string `json:"commit,omitempty"`
+
+	// BlueGreen tracks the slots of the BlueGreen strategy
+	// +optional
+	BlueGreen *BlueGreenStatus `json:"blueGreen,omitempty"`
+
+	// Canary tracks the release under way with the Canary strategy
+	// +optional
+	Canary *CanaryStatus `json:"canary,omitempty"`
+
+	// Domains reports the verification and certificate of each custom domain
+	// +listType=map
+	// +listMapKey=domain
+	// +optional
+	Domains []DomainStatus `json:"domains,omitempty"`
+
+	// Endpoints reports where each extra port is reachable
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Endpoints []EndpointStatus `json:"endpoints,omitempty"`
+
+	// Revisions lists the most recent rollouts, oldest first
+	// +kubebuilder:validation:MaxItems=10
+	// +optional
+	Revisions []WebAppRevision `json:"revisions,omitempty"`
+}
+
+// DomainStatus reports the state of a custom domain
+type DomainStatus struct {
+	Domain string `json:"domain"`
+
+	// VerificationRecord is the TXT record that must hold VerificationToken
+	VerificationRecord string `json:"verificationRecord"`
+	VerificationToken  string `json:"verificationToken"`
+
+	Verified bool `json:"verified"`
+
+	// +optional
+	VerifiedAt *metav1.Time `json:"verifiedAt,omitempty"`
+
+	// +optional
+	CertificateReady bool `json:"certificateReady,omitempty"`
+
+	// Message explains what the domain is waiting for
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// EndpointStatus is the external address of an extra port
+type EndpointStatus struct {
+	Name     string       `json:"name"`
+	Protocol PortProtocol `json:"protocol"`
+
+	// Host is a hostname or IP address, empty until allocated and for
+	// NodePort, which is open on every node
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Port is the external port, which is not the container port for
+	// NodePort and Gateway listeners
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// Ready is true once the address is allocated
+	Ready bool `json:"ready"`
+
+	// Message explains what the endpoint is waiting for
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// WebAppRevision is one rollout of an image and environment
+type WebAppRevision struct {
+	Revision int64  `json:"revision"`
+	Image    string `json:"image"`
+
+	// +optional
+	Commit string `json:"commit,omitempty"`
+
+	// EnvHash identifies the environment variables the image ran with
+	// +optional
+	EnvHash string `json:"envHash,omitempty"`
+
+	DeployedAt metav1.Time `json:"deployedAt"`
+
+	// +optional
+	TriggeredBy string `json:"triggeredBy,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`
+// +kubebuilder:printcolumn:name="Available",type=string,JSONPath=`.status.conditions[?(@.type=="Available")].status`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.conditions[?(@.type=="Available")].reason`
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.url`
+// +kubebuilder:printcolumn:name="Image",type=string,JSONPath=`.status.currentImage`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // WebApp is the Schema for the webapps API
 type WebApp struct {
@@ -68,4 +651,4 @@ type WebAppList struct {
 
 func init() {
 	SchemeBuilder.Register(&WebApp{}, &WebAppList{})
-}
\ No newline at end of file
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// WorkloadSpec holds what the Worker and CronJob kinds share with WebApps:
+// the repo an image is built from and how its container runs
+type WorkloadSpec struct {
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	DisplayName string `json:"displayName,omitempty"`
+
+	// ContainerID is the UUID from the build request
+	// +optional
+	ContainerID string `json:"containerID,omitempty"`
+
+	// +optional
+	RepoURL string `json:"repoURL,omitempty"`
+	// +optional
+	Branch string `json:"branch,omitempty"`
+
+	// GitCredentials names the project's Git credentials used to clone RepoURL
+	// +optional
+	GitCredentials string `json:"gitCredentials,omitempty"`
+
+	// Image is only set once a build of it has succeeded; until then
+	// nothing runs
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Commit is the Git SHA Image was built from
+	// +kubebuilder:validation:Pattern=`^[0-9a-f]{40}$`
+	// +optional
+	Commit string `json:"commit,omitempty"`
+
+	// Command overrides the entrypoint of the image
+	// +optional
+	Command []string `json:"command,omitempty"`
+
+	// Args overrides the command of the image
+	// +optional
+	Args []string `json:"args,omitempty"`
+
+	// +optional
+	EnvVariables map[string]string `json:"envVariables,omitempty"`
+
+	// SecretEnv names variables whose values are kept in the Secret
+	// "<name>-env", so they never show up in the CR
+	// +listType=set
+	// +optional
+	SecretEnv []string `json:"secretEnv,omitempty"`
+
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +optional
+	Plan string `json:"plan,omitempty"`
+
+	// Resources overrides the requests and limits of the plan
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Databases binds Databases of the namespace, whose connection details
+	// reach the container as environment variables
+	// +kubebuilder:validation:MaxItems=5
+	// +kubebuilder:validation:XValidation:rule="self.all(a, self.exists_one(b, (has(b.envPrefix) ? b.envPrefix : 'DATABASE') == (has(a.envPrefix) ? a.envPrefix : 'DATABASE')))",message="every database needs its own envPrefix"
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Databases []DatabaseBinding `json:"databases,omitempty"`
+
+	// Build records how the image was built, so rebuilds are reproducible
+	// +optional
+	Build *BuildConfig `json:"build,omitempty"`
+}
@@ -23,16 +23,21 @@ import (
 
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
@@ -53,6 +58,8 @@ func init() {
 
 	// ADD THIS HERE: Register Istio types before the manager starts
 	utilruntime.Must(gatewayv1.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1alpha2.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1beta1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -65,6 +72,10 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var resourceConfigPath string
+	var platformConfigPath string
+	var platformFlags kleffv1.PlatformSettings
+	cleanupConfig := controller.DefaultCleanupConfig()
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -83,6 +94,24 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&resourceConfigPath, "resource-config", "",
+		"YAML file with the resource plans and namespace quota of WebApps. Built-in defaults are used when empty.")
+	flag.StringVar(&platformConfigPath, "platform-config", "",
+		"YAML file with the gateway, domain and DNS settings of WebApps. Built-in defaults are used when empty.")
+	flag.StringVar(&platformFlags.BaseDomain, "base-domain", "", "The parent domain of the app subdomains.")
+	flag.StringVar(&platformFlags.GatewayName, "gateway-name", "", "The Gateway the HTTPRoutes attach to.")
+	flag.StringVar(&platformFlags.GatewayNamespace, "gateway-namespace", "", "The namespace of the Gateway.")
+	flag.StringVar(&platformFlags.DNSTarget, "dns-target", "", "The address ExternalDNS points the app records to.")
+	flag.StringVar(&platformFlags.ImagePullSecret, "image-pull-secret", "", "The Secret pods pull app images with.")
+	flag.StringVar(&platformFlags.ClusterIssuer, "cluster-issuer", "",
+		"The cert-manager ClusterIssuer of custom domain certificates.")
+	flag.StringVar(&cleanupConfig.BuildNamespace, "build-namespace", cleanupConfig.BuildNamespace,
+		"The namespace the deployment service runs build Jobs in, cleaned up with their WebApp.")
+	flag.StringVar(&cleanupConfig.RegistrySecret, "registry-secret", cleanupConfig.RegistrySecret,
+		"The dockerconfigjson Secret of the build namespace used to delete the images of deleted WebApps. "+
+			"Images are kept when empty.")
+	flag.IntVar(&cleanupConfig.RetainedImages, "retained-images", cleanupConfig.RetainedImages,
+		"How many of the most recent images of a deleted WebApp stay in the registry.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -165,6 +194,12 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "c4117f5d.kleff.io",
+		// Pods are watched for failures, only those of the apps matter
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				&corev1.Pod{}: {Label: controller.ManagedPodSelector()},
+			},
+		},
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -182,13 +217,62 @@ func main() {
 		os.Exit(1)
 	}
 
+	resourceConfig := controller.DefaultResourceConfig()
+	if resourceConfigPath != "" {
+		resourceConfig, err = controller.LoadResourceConfig(resourceConfigPath)
+		if err != nil {
+			setupLog.Error(err, "unable to load resource config")
+			os.Exit(1)
+		}
+	}
+
+	// Flags take precedence over the config file
+	platformSettings := controller.DefaultPlatformSettings()
+	if platformConfigPath != "" {
+		platformSettings, err = controller.LoadPlatformSettings(platformConfigPath)
+		if err != nil {
+			setupLog.Error(err, "unable to load platform config")
+			os.Exit(1)
+		}
+	}
+	controller.MergePlatformSettings(&platformSettings, platformFlags)
+
 	if err := (&controller.WebAppReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Resources: resourceConfig,
+		Platform:  &platformSettings,
+		Cleanup:   &cleanupConfig,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "WebApp")
 		os.Exit(1)
 	}
+	if err := (&controller.DatabaseReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Resources: resourceConfig,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Database")
+		os.Exit(1)
+	}
+	if err := (&controller.WorkerReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Resources: resourceConfig,
+		Platform:  &platformSettings,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Worker")
+		os.Exit(1)
+	}
+	if err := (&controller.CronJobReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Resources: resourceConfig,
+		Platform:  &platformSettings,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CronJob")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
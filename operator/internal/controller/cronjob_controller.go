@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+// defaultActiveDeadlineSeconds bounds a run when the CronJob sets no deadline
+const defaultActiveDeadlineSeconds = int64(3600)
+
+// Finished runs kept around for their logs
+const (
+	successfulRunsHistory = int32(3)
+	failedRunsHistory     = int32(3)
+)
+
+// CronJobReconciler runs a CronJob through a batch CronJob of the same name
+type CronJobReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Resources holds the resource plans, DefaultResourceConfig when nil
+	Resources *ResourceConfig
+
+	// Platform holds the settings from the flags and config file,
+	// DefaultPlatformSettings when nil. The PlatformConfig overrides them.
+	Platform *kleffv1.PlatformSettings
+}
+
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=cronjobs/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=platformconfigs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=databases,verbs=get;list;watch
+// +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=resourcequotas;limitranges,verbs=get;list;watch;create;update;patch
+
+func (r *CronJobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	cronJob := &kleffv1.CronJob{}
+	if err := r.Get(ctx, req.NamespacedName, cronJob); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	before := cronJob.Status.DeepCopy()
+
+	// Nothing can run before the first build pushed an image
+	if cronJob.Spec.Image == "" {
+		return r.updateStatus(ctx, cronJob, before, metav1.ConditionFalse, "AwaitingBuild", "Waiting for the first build to succeed")
+	}
+
+	config := orDefaultResourceConfig(r.Resources)
+	labels := workloadLabels(cronJob.Name, "cronjob", &cronJob.Spec.WorkloadSpec)
+	w, reason, err := resolveWorkload(ctx, r.Client, config, r.Platform, cronJob.Namespace, cronJob.Name, &cronJob.Spec.WorkloadSpec, labels)
+	if err != nil {
+		logger.Error(err, "Failed to resolve cron job settings", "reason", reason)
+		return r.updateStatus(ctx, cronJob, before, metav1.ConditionFalse, reason, err.Error())
+	}
+
+	batchJob, err := r.syncCronJob(ctx, cronJob, labels, w.podTemplate(config))
+	if err != nil {
+		logger.Error(err, "Failed to reconcile batch CronJob")
+		return r.updateStatus(ctx, cronJob, before, metav1.ConditionFalse, "CronJobFailed", err.Error())
+	}
+
+	// Runs started from now on use the image of the spec
+	cronJob.Status.CurrentImage = cronJob.Spec.Image
+	cronJob.Status.Active = int32(len(batchJob.Status.Active))
+	cronJob.Status.LastScheduleTime = batchJob.Status.LastScheduleTime
+	cronJob.Status.LastSuccessfulTime = batchJob.Status.LastSuccessfulTime
+
+	if cronJob.Spec.Suspend {
+		return r.updateStatus(ctx, cronJob, before, metav1.ConditionFalse, "Suspended", "No new runs are scheduled")
+	}
+	return r.updateStatus(ctx, cronJob, before, metav1.ConditionTrue, "Scheduled",
+		fmt.Sprintf("Runs on schedule %q", cronJob.Spec.Schedule))
+}
+
+// syncCronJob creates or updates the batch CronJob named after the CronJob
+func (r *CronJobReconciler) syncCronJob(ctx context.Context, cronJob *kleffv1.CronJob, labels map[string]string, template corev1.PodTemplateSpec) (*batchv1.CronJob, error) {
+	batchJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cronJob.Name,
+			Namespace: cronJob.Namespace,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, batchJob, func() error {
+		batchJob.Labels = labels
+
+		spec := &batchJob.Spec
+		spec.Schedule = cronJob.Spec.Schedule
+		spec.TimeZone = cronJob.Spec.TimeZone
+		spec.ConcurrencyPolicy = batchv1.ForbidConcurrent
+		if cronJob.Spec.ConcurrencyPolicy != "" {
+			spec.ConcurrencyPolicy = batchv1.ConcurrencyPolicy(cronJob.Spec.ConcurrencyPolicy)
+		}
+		suspend := cronJob.Spec.Suspend
+		spec.Suspend = &suspend
+		successful, failed := successfulRunsHistory, failedRunsHistory
+		spec.SuccessfulJobsHistoryLimit = &successful
+		spec.FailedJobsHistoryLimit = &failed
+
+		spec.JobTemplate.Labels = labels
+		backoffLimit := int32(0)
+		if cronJob.Spec.BackoffLimit != nil {
+			backoffLimit = *cronJob.Spec.BackoffLimit
+		}
+		spec.JobTemplate.Spec.BackoffLimit = &backoffLimit
+		deadline := defaultActiveDeadlineSeconds
+		if cronJob.Spec.ActiveDeadlineSeconds != nil {
+			deadline = *cronJob.Spec.ActiveDeadlineSeconds
+		}
+		spec.JobTemplate.Spec.ActiveDeadlineSeconds = &deadline
+
+		// A run is a one-off, retries go through the backoff limit
+		template.Spec.RestartPolicy = corev1.RestartPolicyNever
+		spec.JobTemplate.Spec.Template = template
+
+		return controllerutil.SetControllerReference(cronJob, batchJob, r.Scheme)
+	})
+	return batchJob, err
+}
+
+// updateStatus sets the Available condition and writes the status when it
+// differs from before
+func (r *CronJobReconciler) updateStatus(ctx context.Context, cronJob *kleffv1.CronJob, before *kleffv1.CronJobStatus, status metav1.ConditionStatus, reason, message string) (ctrl.Result, error) {
+	meta.SetStatusCondition(&cronJob.Status.Conditions, metav1.Condition{
+		Type:               kleffv1.ConditionAvailable,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: cronJob.Generation,
+		LastTransitionTime: metav1.Now(),
+	})
+	cronJob.Status.ObservedGeneration = cronJob.Generation
+
+	if equality.Semantic.DeepEqual(before, &cronJob.Status) {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, r.Status().Update(ctx, cronJob)
+}
+
+// cronJobsForDatabase requeues the CronJobs bound to a Database
+func (r *CronJobReconciler) cronJobsForDatabase(ctx context.Context, obj client.Object) []reconcile.Request {
+	cronJobs := &kleffv1.CronJobList{}
+	if err := r.List(ctx, cronJobs, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, cronJob := range cronJobs.Items {
+		if boundToDatabase(&cronJob.Spec.WorkloadSpec, obj.GetName()) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: cronJob.Name, Namespace: cronJob.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CronJobReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kleffv1.CronJob{}).
+		Owns(&batchv1.CronJob{}).
+		Watches(&kleffv1.Database{}, handler.EnqueueRequestsFromMapFunc(r.cronJobsForDatabase)).
+		Named("cronjob").
+		Complete(r)
+}
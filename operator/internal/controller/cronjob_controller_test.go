@@ -0,0 +1,106 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+var _ = Describe("CronJob Controller", func() {
+	Context("When reconciling a resource", func() {
+		const resourceName = "test-cronjob"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			resource := &kleffv1.CronJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.CronJobSpec{
+					WorkloadSpec: kleffv1.WorkloadSpec{
+						Image: "registry.kleff.io/cleanup:1",
+						Args:  []string{"--dry-run"},
+					},
+					Schedule: "0 3 * * *",
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.CronJob{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should schedule the built image", func() {
+			controllerReconciler := &CronJobReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			batchJob := &batchv1.CronJob{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, batchJob)).To(Succeed())
+			Expect(batchJob.Spec.Schedule).To(Equal("0 3 * * *"))
+			Expect(batchJob.Spec.ConcurrencyPolicy).To(Equal(batchv1.ForbidConcurrent))
+			Expect(*batchJob.Spec.JobTemplate.Spec.BackoffLimit).To(Equal(int32(0)))
+			Expect(*batchJob.Spec.JobTemplate.Spec.ActiveDeadlineSeconds).To(Equal(int64(3600)))
+			podSpec := batchJob.Spec.JobTemplate.Spec.Template.Spec
+			Expect(podSpec.RestartPolicy).To(Equal(corev1.RestartPolicyNever))
+			Expect(podSpec.Containers[0].Image).To(Equal("registry.kleff.io/cleanup:1"))
+			Expect(podSpec.Containers[0].Args).To(Equal([]string{"--dry-run"}))
+
+			cronJob := &kleffv1.CronJob{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cronJob)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(cronJob.Status.Conditions, kleffv1.ConditionAvailable)).To(BeTrue())
+			Expect(cronJob.Status.CurrentImage).To(Equal("registry.kleff.io/cleanup:1"))
+
+			By("Suspending the schedule")
+			cronJob.Spec.Suspend = true
+			Expect(k8sClient.Update(ctx, cronJob)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, batchJob)).To(Succeed())
+			Expect(*batchJob.Spec.Suspend).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cronJob)).To(Succeed())
+			Expect(meta.FindStatusCondition(cronJob.Status.Conditions, kleffv1.ConditionAvailable).Reason).To(Equal("Suspended"))
+		})
+	})
+})
@@ -0,0 +1,358 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+// databaseEngine describes how to run an engine
+type databaseEngine struct {
+	image          string
+	defaultVersion string
+	port           int32
+	dataPath       string
+	// username and database are fixed, only the password is generated
+	username string
+	database string
+}
+
+var databaseEngines = map[kleffv1.DatabaseEngine]databaseEngine{
+	kleffv1.EnginePostgres: {image: "postgres", defaultVersion: "16", port: 5432, dataPath: "/var/lib/postgresql/data", username: "app", database: "app"},
+	kleffv1.EngineRedis:    {image: "redis", defaultVersion: "7", port: 6379, dataPath: "/data", username: "default", database: "0"},
+}
+
+// databaseSecretName is the Secret holding the connection details of a Database
+func databaseSecretName(name string) string {
+	return name + "-credentials"
+}
+
+// DatabaseReconciler runs each Database as a single pod StatefulSet behind a
+// headless Service, with its credentials in a generated Secret
+type DatabaseReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Resources holds the resource plans, DefaultResourceConfig when nil
+	Resources *ResourceConfig
+}
+
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=databases,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=databases/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups="",resources=resourcequotas;limitranges,verbs=get;list;watch;create;update;patch
+
+func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	database := &kleffv1.Database{}
+	if err := r.Get(ctx, req.NamespacedName, database); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	before := database.Status.DeepCopy()
+
+	engine, ok := databaseEngines[database.Spec.Engine]
+	if !ok {
+		return r.updateStatus(ctx, database, before, metav1.ConditionFalse, "UnknownEngine", fmt.Sprintf("Unknown engine %q", database.Spec.Engine))
+	}
+	version := database.Spec.Version
+	if version == "" {
+		version = engine.defaultVersion
+	}
+	// The data files of postgres are tied to its major version
+	if database.Spec.Engine == kleffv1.EnginePostgres && database.Status.Version != "" && majorVersion(database.Status.Version) != majorVersion(version) {
+		return r.updateStatus(ctx, database, before, metav1.ConditionFalse, "UnsupportedUpgrade",
+			fmt.Sprintf("postgres %s cannot be upgraded in place to %s", database.Status.Version, version))
+	}
+
+	// A database counts against the quota of its project like any app, on
+	// the default plan unless it sets its own resources
+	config := orDefaultResourceConfig(r.Resources)
+	resources, err := resolveResources(config, "", database.Spec.Resources)
+	if err != nil {
+		return r.updateStatus(ctx, database, before, metav1.ConditionFalse, "InvalidPlan", err.Error())
+	}
+	if err := reconcileNamespaceLimits(ctx, r.Client, config, database.Namespace); err != nil {
+		logger.Error(err, "Failed to reconcile namespace quota")
+		return r.updateStatus(ctx, database, before, metav1.ConditionFalse, "QuotaFailed", err.Error())
+	}
+
+	labels := map[string]string{
+		"database":   database.Name,
+		"engine":     string(database.Spec.Engine),
+		"controller": "database",
+	}
+	host := fmt.Sprintf("%s.%s.svc", database.Name, database.Namespace)
+
+	if err := r.syncSecret(ctx, database, engine, labels, host); err != nil {
+		logger.Error(err, "Failed to sync database credentials")
+		return r.updateStatus(ctx, database, before, metav1.ConditionFalse, "SecretFailed", err.Error())
+	}
+	if err := r.syncService(ctx, database, engine, labels); err != nil {
+		logger.Error(err, "Failed to sync database Service")
+		return r.updateStatus(ctx, database, before, metav1.ConditionFalse, "ServiceFailed", err.Error())
+	}
+	statefulSet, err := r.syncStatefulSet(ctx, database, engine, version, resources, labels)
+	if err != nil {
+		logger.Error(err, "Failed to sync database StatefulSet")
+		return r.updateStatus(ctx, database, before, metav1.ConditionFalse, "StatefulSetFailed", err.Error())
+	}
+	if err := r.growVolume(ctx, database); err != nil {
+		logger.Error(err, "Failed to resize database volume")
+		return r.updateStatus(ctx, database, before, metav1.ConditionFalse, "VolumeFailed", err.Error())
+	}
+
+	database.Status.SecretName = databaseSecretName(database.Name)
+	database.Status.Host = host
+	database.Status.Port = engine.port
+
+	status := statefulSet.Status
+	if status.ReadyReplicas == 0 {
+		return r.updateStatus(ctx, database, before, metav1.ConditionFalse, "Provisioning", "Waiting for the database server to be ready")
+	}
+	if status.ObservedGeneration >= statefulSet.Generation && status.CurrentRevision == status.UpdateRevision {
+		database.Status.Version = version
+	}
+	return r.updateStatus(ctx, database, before, metav1.ConditionTrue, "Available",
+		fmt.Sprintf("Database is accepting connections at %s:%d", host, engine.port))
+}
+
+// updateStatus sets the Available condition and writes the status when it
+// differs from before
+func (r *DatabaseReconciler) updateStatus(ctx context.Context, database *kleffv1.Database, before *kleffv1.DatabaseStatus, status metav1.ConditionStatus, reason, message string) (ctrl.Result, error) {
+	meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+		Type:               kleffv1.ConditionAvailable,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: database.Generation,
+		LastTransitionTime: metav1.Now(),
+	})
+	database.Status.ObservedGeneration = database.Generation
+
+	if equality.Semantic.DeepEqual(before, &database.Status) {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, r.Status().Update(ctx, database)
+}
+
+// syncSecret keeps the connection details of the Database. The password is
+// generated once and kept from then on.
+func (r *DatabaseReconciler) syncSecret(ctx context.Context, database *kleffv1.Database, engine databaseEngine, labels map[string]string, host string) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      databaseSecretName(database.Name),
+			Namespace: database.Namespace,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.Labels = labels
+		password := string(secret.Data["password"])
+		if password == "" {
+			var err error
+			if password, err = generatePassword(); err != nil {
+				return err
+			}
+		}
+
+		port := strconv.Itoa(int(engine.port))
+		connection := url.URL{
+			Scheme: string(database.Spec.Engine),
+			User:   url.UserPassword(engine.username, password),
+			Host:   net.JoinHostPort(host, port),
+			Path:   "/" + engine.database,
+		}
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = map[string][]byte{
+			"url":      []byte(connection.String()),
+			"host":     []byte(host),
+			"port":     []byte(port),
+			"username": []byte(engine.username),
+			"password": []byte(password),
+			"database": []byte(engine.database),
+		}
+		return controllerutil.SetControllerReference(database, secret, r.Scheme)
+	})
+	return err
+}
+
+func generatePassword() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// syncService creates the headless Service giving the server a stable name
+func (r *DatabaseReconciler) syncService(ctx context.Context, database *kleffv1.Database, engine databaseEngine, labels map[string]string) error {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      database.Name,
+			Namespace: database.Namespace,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, service, func() error {
+		service.Labels = labels
+		service.Spec.ClusterIP = corev1.ClusterIPNone
+		service.Spec.Selector = map[string]string{"database": database.Name}
+		service.Spec.Ports = []corev1.ServicePort{{
+			Name:       string(database.Spec.Engine),
+			Port:       engine.port,
+			TargetPort: intstr.FromInt32(engine.port),
+			Protocol:   corev1.ProtocolTCP,
+		}}
+		return controllerutil.SetControllerReference(database, service, r.Scheme)
+	})
+	return err
+}
+
+// syncStatefulSet runs the server as a single pod with its data volume
+func (r *DatabaseReconciler) syncStatefulSet(ctx context.Context, database *kleffv1.Database, engine databaseEngine, version string, resources corev1.ResourceRequirements, labels map[string]string) (*appsv1.StatefulSet, error) {
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      database.Name,
+			Namespace: database.Namespace,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, statefulSet, func() error {
+		statefulSet.Labels = labels
+
+		// Selector, service name and claim templates are immutable
+		if statefulSet.CreationTimestamp.IsZero() {
+			statefulSet.Spec.Selector = &metav1.LabelSelector{
+				MatchLabels: map[string]string{"database": database.Name},
+			}
+			statefulSet.Spec.ServiceName = database.Name
+			statefulSet.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{Name: "data", Labels: labels},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					StorageClassName: database.Spec.StorageClassName,
+					Resources: corev1.VolumeResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: database.Spec.Size},
+					},
+				},
+			}}
+		}
+
+		// The data goes with the Database
+		statefulSet.Spec.PersistentVolumeClaimRetentionPolicy = &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+			WhenDeleted: appsv1.DeletePersistentVolumeClaimRetentionPolicyType,
+			WhenScaled:  appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+		}
+		replicas := int32(1)
+		statefulSet.Spec.Replicas = &replicas
+		statefulSet.Spec.Template.Labels = labels
+		statefulSet.Spec.Template.Spec.Containers = []corev1.Container{databaseContainer(database, engine, version, resources)}
+		return controllerutil.SetControllerReference(database, statefulSet, r.Scheme)
+	})
+	return statefulSet, err
+}
+
+func databaseContainer(database *kleffv1.Database, engine databaseEngine, version string, resources corev1.ResourceRequirements) corev1.Container {
+	password := corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: databaseSecretName(database.Name)},
+		Key:                  "password",
+	}}
+
+	container := corev1.Container{
+		Name:  string(database.Spec.Engine),
+		Image: engine.image + ":" + version,
+		Ports: []corev1.ContainerPort{{
+			Name:          string(database.Spec.Engine),
+			ContainerPort: engine.port,
+			Protocol:      corev1.ProtocolTCP,
+		}},
+		VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: engine.dataPath}},
+		Resources:    resources,
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(engine.port)},
+			},
+			PeriodSeconds: 10,
+		},
+	}
+
+	switch database.Spec.Engine {
+	case kleffv1.EnginePostgres:
+		container.Env = []corev1.EnvVar{
+			{Name: "POSTGRES_USER", Value: engine.username},
+			{Name: "POSTGRES_DB", Value: engine.database},
+			{Name: "POSTGRES_PASSWORD", ValueFrom: &password},
+			// A subdirectory, as the volume root may hold lost+found
+			{Name: "PGDATA", Value: engine.dataPath + "/pgdata"},
+		}
+		container.ReadinessProbe.ProbeHandler = corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{Command: []string{"pg_isready", "-U", engine.username, "-d", engine.database}},
+		}
+	case kleffv1.EngineRedis:
+		container.Env = []corev1.EnvVar{{Name: "REDIS_PASSWORD", ValueFrom: &password}}
+		container.Args = []string{"redis-server", "--appendonly", "yes", "--requirepass", "$(REDIS_PASSWORD)"}
+	}
+	return container
+}
+
+// growVolume resizes the claim of the StatefulSet, whose claim template
+// cannot change, when the size grew
+func (r *DatabaseReconciler) growVolume(ctx context.Context, database *kleffv1.Database) error {
+	claim := &corev1.PersistentVolumeClaim{}
+	err := r.Get(ctx, types.NamespacedName{Name: "data-" + database.Name + "-0", Namespace: database.Namespace}, claim)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	current := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+	if database.Spec.Size.Cmp(current) <= 0 {
+		return nil
+	}
+	patch := client.MergeFrom(claim.DeepCopy())
+	claim.Spec.Resources.Requests[corev1.ResourceStorage] = database.Spec.Size
+	return r.Patch(ctx, claim, patch)
+}
+
+func majorVersion(version string) string {
+	major, _, _ := strings.Cut(version, ".")
+	return major
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DatabaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kleffv1.Database{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.Secret{}).
+		Named("database").
+		Complete(r)
+}
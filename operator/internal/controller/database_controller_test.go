@@ -0,0 +1,137 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+var _ = Describe("Database Controller", func() {
+	Context("When reconciling a resource", func() {
+		const resourceName = "test-database"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			resource := &kleffv1.Database{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.DatabaseSpec{
+					Engine: kleffv1.EnginePostgres,
+					Size:   resource.MustParse("1Gi"),
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.Database{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should provision the server and its credentials", func() {
+			controllerReconciler := &DatabaseReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-credentials", Namespace: "default"}, secret)).To(Succeed())
+			password := string(secret.Data["password"])
+			Expect(password).To(HaveLen(48))
+			Expect(string(secret.Data["url"])).To(Equal("postgres://app:" + password + "@" + resourceName + ".default.svc:5432/app"))
+
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, service)).To(Succeed())
+			Expect(service.Spec.ClusterIP).To(Equal(corev1.ClusterIPNone))
+
+			statefulSet := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, statefulSet)).To(Succeed())
+			Expect(statefulSet.Spec.Template.Spec.Containers[0].Image).To(Equal("postgres:16"))
+			Expect(statefulSet.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests.Storage().String()).To(Equal("1Gi"))
+
+			By("Running on the default plan under the quota of the project")
+			defaults := DefaultResourceConfig()
+			plan := defaults.Plans[defaults.DefaultPlan]
+			resources := statefulSet.Spec.Template.Spec.Containers[0].Resources
+			Expect(resources.Requests.Memory().String()).To(Equal(plan.Requests.Memory().String()))
+			Expect(resources.Limits.Cpu().String()).To(Equal(plan.Limits.Cpu().String()))
+			quota := &corev1.ResourceQuota{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: namespaceQuotaName, Namespace: "default"}, quota)).To(Succeed())
+			Expect(quota.Spec.Hard).To(HaveKey(corev1.ResourceRequestsStorage))
+
+			By("Keeping the password on the next reconcile")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-credentials", Namespace: "default"}, secret)).To(Succeed())
+			Expect(string(secret.Data["password"])).To(Equal(password))
+
+			By("Marking the server ready")
+			statefulSet.Status = appsv1.StatefulSetStatus{
+				ObservedGeneration: statefulSet.Generation,
+				Replicas:           1,
+				ReadyReplicas:      1,
+				CurrentRevision:    "r1",
+				UpdateRevision:     "r1",
+			}
+			Expect(k8sClient.Status().Update(ctx, statefulSet)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			database := &kleffv1.Database{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, database)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(database.Status.Conditions, kleffv1.ConditionAvailable)).To(BeTrue())
+			Expect(database.Status.Version).To(Equal("16"))
+			Expect(database.Status.SecretName).To(Equal(resourceName + "-credentials"))
+
+			By("Refusing a major postgres upgrade")
+			database.Spec.Version = "17"
+			Expect(k8sClient.Update(ctx, database)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, database)).To(Succeed())
+			Expect(meta.FindStatusCondition(database.Status.Conditions, kleffv1.ConditionAvailable).Reason).To(Equal("UnsupportedUpgrade"))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, statefulSet)).To(Succeed())
+			Expect(statefulSet.Spec.Template.Spec.Containers[0].Image).To(Equal("postgres:16"))
+		})
+	})
+})
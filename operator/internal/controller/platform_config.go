@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+// DefaultPlatformSettings are the settings of the production cluster, used
+// for anything neither the flags, the config file nor a PlatformConfig set
+func DefaultPlatformSettings() kleffv1.PlatformSettings {
+	return kleffv1.PlatformSettings{
+		BaseDomain:       "kleff.io",
+		GatewayName:      "prod-web",
+		GatewayNamespace: "envoy-gateway-system",
+		DNSTarget:        "66.130.187.229",
+		ImagePullSecret:  "acr-creds",
+		ClusterIssuer:    "letsencrypt-prod",
+		RouteAnnotations: map[string]string{
+			"external-dns.alpha.kubernetes.io/cloudflare-proxied": "false",
+			"external-dns.alpha.kubernetes.io/ttl":                "3600",
+		},
+	}
+}
+
+// LoadPlatformSettings reads PlatformSettings from a YAML file, on top of
+// DefaultPlatformSettings
+func LoadPlatformSettings(path string) (kleffv1.PlatformSettings, error) {
+	settings := DefaultPlatformSettings()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return settings, err
+	}
+
+	var file kleffv1.PlatformSettings
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return settings, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	MergePlatformSettings(&settings, file)
+	return settings, nil
+}
+
+// MergePlatformSettings applies the non-empty fields of override to settings
+func MergePlatformSettings(settings *kleffv1.PlatformSettings, override kleffv1.PlatformSettings) {
+	fields := []struct {
+		value    *string
+		override string
+	}{
+		{&settings.BaseDomain, override.BaseDomain},
+		{&settings.GatewayName, override.GatewayName},
+		{&settings.GatewayNamespace, override.GatewayNamespace},
+		{&settings.DNSTarget, override.DNSTarget},
+		{&settings.ImagePullSecret, override.ImagePullSecret},
+		{&settings.ClusterIssuer, override.ClusterIssuer},
+	}
+	for _, field := range fields {
+		if field.override != "" {
+			*field.value = field.override
+		}
+	}
+
+	if len(override.RouteAnnotations) > 0 {
+		annotations := make(map[string]string, len(settings.RouteAnnotations)+len(override.RouteAnnotations))
+		for k, v := range settings.RouteAnnotations {
+			annotations[k] = v
+		}
+		for k, v := range override.RouteAnnotations {
+			annotations[k] = v
+		}
+		settings.RouteAnnotations = annotations
+	}
+}
+
+// platformSettings resolves the settings of a namespace: the operator's own
+// settings, then the PlatformConfig, then its override for the namespace
+func (r *WebAppReconciler) platformSettings(ctx context.Context, namespace string) (kleffv1.PlatformSettings, error) {
+	return resolvePlatformSettings(ctx, r.Client, r.Platform, namespace)
+}
+
+// resolvePlatformSettings layers the PlatformConfig over base, the settings
+// of the flags and config file
+func resolvePlatformSettings(ctx context.Context, c client.Reader, base *kleffv1.PlatformSettings, namespace string) (kleffv1.PlatformSettings, error) {
+	var settings kleffv1.PlatformSettings
+	if base != nil {
+		settings = *base.DeepCopy()
+	} else {
+		settings = DefaultPlatformSettings()
+	}
+
+	config := &kleffv1.PlatformConfig{}
+	err := c.Get(ctx, types.NamespacedName{Name: kleffv1.PlatformConfigName}, config)
+	if err != nil {
+		if k8serrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return settings, nil
+		}
+		return settings, err
+	}
+
+	MergePlatformSettings(&settings, config.Spec.PlatformSettings)
+	for _, override := range config.Spec.Namespaces {
+		if override.Namespace == namespace {
+			MergePlatformSettings(&settings, override.PlatformSettings)
+		}
+	}
+	return settings, nil
+}
+
+// webAppsForPlatformConfig requeues every WebApp when the PlatformConfig changes
+func (r *WebAppReconciler) webAppsForPlatformConfig(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetName() != kleffv1.PlatformConfigName {
+		return nil
+	}
+
+	webapps := &kleffv1.WebAppList{}
+	if err := r.List(ctx, webapps); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(webapps.Items))
+	for _, webapp := range webapps.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: webapp.Name, Namespace: webapp.Namespace},
+		})
+	}
+	return requests
+}
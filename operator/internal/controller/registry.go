@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// manifestMediaTypes are accepted when resolving a tag, so the registry
+// answers with the digest of what was pushed instead of converting it
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// registryCredentials are the entries of a .dockerconfigjson, by registry host
+type registryCredentials map[string]registryAuth
+
+type registryAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// parseDockerConfig reads the credentials of a kubernetes.io/dockerconfigjson Secret
+func parseDockerConfig(data []byte) (registryCredentials, error) {
+	var config struct {
+		Auths registryCredentials `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	for host, auth := range config.Auths {
+		if auth.Username == "" && auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("auth of %s: %w", host, err)
+			}
+			auth.Username, auth.Password, _ = strings.Cut(string(decoded), ":")
+			config.Auths[host] = auth
+		}
+	}
+	return config.Auths, nil
+}
+
+// imageReference is an image split into its registry host, repository and
+// tag or digest
+type imageReference struct {
+	Host       string
+	Repository string
+	Reference  string
+}
+
+func parseImage(image string) (imageReference, bool) {
+	host, rest, ok := strings.Cut(image, "/")
+	if !ok {
+		return imageReference{}, false
+	}
+	if repository, digest, ok := strings.Cut(rest, "@"); ok {
+		return imageReference{Host: host, Repository: repository, Reference: digest}, true
+	}
+	i := strings.LastIndex(rest, ":")
+	if i < 0 || strings.Contains(rest[i:], "/") {
+		return imageReference{}, false
+	}
+	return imageReference{Host: host, Repository: rest[:i], Reference: rest[i+1:]}, true
+}
+
+// registryClient deletes images through the Docker Registry HTTP API
+type registryClient struct {
+	http  *http.Client
+	creds registryCredentials
+}
+
+// resolveDigest returns the repository and the manifest digest an image
+// points to. It returns an empty digest for images of other registries and
+// images that are gone.
+func (c *registryClient) resolveDigest(ctx context.Context, image string) (imageReference, string, error) {
+	ref, ok := parseImage(image)
+	if !ok {
+		return ref, "", nil
+	}
+	auth, ok := c.creds[ref.Host]
+	if !ok {
+		return ref, "", nil
+	}
+	if strings.Contains(ref.Reference, ":") {
+		return ref, ref.Reference, nil
+	}
+
+	resp, err := c.do(ctx, http.MethodHead, ref, ref.Reference, auth)
+	if err != nil {
+		return ref, "", err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ref, "", nil
+	case resp.StatusCode != http.StatusOK:
+		return ref, "", fmt.Errorf("resolving %s: registry answered %s", image, resp.Status)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return ref, "", fmt.Errorf("resolving %s: registry returned no digest", image)
+	}
+	return ref, digest, nil
+}
+
+// deleteManifest deletes a manifest by digest, which removes it from every
+// tag of the repository. Manifests that are already gone are left alone.
+func (c *registryClient) deleteManifest(ctx context.Context, ref imageReference, digest string) (bool, error) {
+	image := ref.Host + "/" + ref.Repository + "@" + digest
+	resp, err := c.do(ctx, http.MethodDelete, ref, digest, c.creds[ref.Host])
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("deleting %s: registry answered %s", image, resp.Status)
+	}
+}
+
+// do sends a manifest request, answering a Bearer challenge with a token
+// fetched with the credentials, or a Basic one with the credentials themselves
+func (c *registryClient) do(ctx context.Context, method string, ref imageReference, reference string, auth registryAuth) (*http.Response, error) {
+	target := fmt.Sprintf("https://%s/v2/%s/manifests/%s", ref.Host, ref.Repository, reference)
+	send := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		return c.http.Do(req)
+	}
+
+	resp, err := send("")
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	switch scheme {
+	case "basic":
+		return send("Basic " + basicAuth(auth))
+	case "bearer":
+		token, err := c.token(ctx, params, auth)
+		if err != nil {
+			return nil, err
+		}
+		return send("Bearer " + token)
+	default:
+		return nil, fmt.Errorf("%s %s: unsupported registry challenge %q", method, target, scheme)
+	}
+}
+
+// token exchanges the credentials for a token at the realm of a challenge
+func (c *registryClient) token(ctx context.Context, params map[string]string, auth registryAuth) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Scheme == "" {
+		return "", fmt.Errorf("invalid registry token realm %q", params["realm"])
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(auth.Username, auth.Password)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token request answered %s", resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding registry token: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("registry token request returned no token")
+}
+
+// parseChallenge splits a WWW-Authenticate header such as
+// Bearer realm="https://host/token",service="host",scope="repository:app:delete"
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key != "" {
+			params[strings.ToLower(strings.TrimSpace(key))] = value
+		}
+	}
+	return strings.ToLower(scheme), params
+}
+
+func basicAuth(auth registryAuth) string {
+	return base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+}
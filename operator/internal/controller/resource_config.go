@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// ResourceConfig is the table of resource plans and the per-namespace quota.
+// It is loaded from the file given with --resource-config.
+type ResourceConfig struct {
+	// DefaultPlan applies to WebApps that name no plan, and sets the
+	// LimitRange defaults of every namespace
+	DefaultPlan string `json:"defaultPlan"`
+
+	Plans map[string]corev1.ResourceRequirements `json:"plans"`
+
+	// NamespaceQuota is the hard limit of the ResourceQuota of each namespace.
+	// services.loadbalancers and services.nodeports cap the ports an app
+	// exposes outside of the Gateway, requests.storage and
+	// persistentvolumeclaims the volumes and databases.
+	NamespaceQuota corev1.ResourceList `json:"namespaceQuota"`
+}
+
+// DefaultResourceConfig is used when no config file is given
+func DefaultResourceConfig() *ResourceConfig {
+	plan := func(cpuRequest, memoryRequest, cpuLimit, memoryLimit string) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpuRequest),
+				corev1.ResourceMemory: resource.MustParse(memoryRequest),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpuLimit),
+				corev1.ResourceMemory: resource.MustParse(memoryLimit),
+			},
+		}
+	}
+
+	return &ResourceConfig{
+		DefaultPlan: "small",
+		Plans: map[string]corev1.ResourceRequirements{
+			"small":  plan("100m", "128Mi", "500m", "256Mi"),
+			"medium": plan("250m", "512Mi", "1", "1Gi"),
+			"large":  plan("1", "2Gi", "2", "4Gi"),
+		},
+		NamespaceQuota: corev1.ResourceList{
+			corev1.ResourceRequestsCPU:    resource.MustParse("4"),
+			corev1.ResourceRequestsMemory: resource.MustParse("8Gi"),
+			corev1.ResourceLimitsCPU:      resource.MustParse("8"),
+			corev1.ResourceLimitsMemory:   resource.MustParse("16Gi"),
+			corev1.ResourcePods:           resource.MustParse("30"),
+			// A LoadBalancer Service allocates node ports as well
+			corev1.ResourceServicesLoadBalancers:  resource.MustParse("2"),
+			corev1.ResourceServicesNodePorts:      resource.MustParse("4"),
+			corev1.ResourceRequestsStorage:        resource.MustParse("100Gi"),
+			corev1.ResourcePersistentVolumeClaims: resource.MustParse("20"),
+		},
+	}
+}
+
+// LoadResourceConfig reads a ResourceConfig from a YAML file
+func LoadResourceConfig(path string) (*ResourceConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ResourceConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if _, ok := config.Plans[config.DefaultPlan]; !ok {
+		return nil, fmt.Errorf("default plan %q is not defined in %s", config.DefaultPlan, path)
+	}
+	return config, nil
+}
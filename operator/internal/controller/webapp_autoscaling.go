@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+const defaultTargetCPUUtilization = int32(80)
+
+// autoscalingEnabled reports whether the WebApp's pods are scaled by an HPA.
+// A ReadWriteOnce volume keeps the WebApp on a single pod.
+func autoscalingEnabled(webapp *kleffv1.WebApp) bool {
+	return webapp.Spec.MaxReplicas != nil && !exclusiveVolumes(webapp)
+}
+
+// desiredReplicas is the replica count of the Deployment while autoscaling is off
+func desiredReplicas(webapp *kleffv1.WebApp) int32 {
+	if exclusiveVolumes(webapp) {
+		return 1
+	}
+	if webapp.Spec.Replicas != nil {
+		return *webapp.Spec.Replicas
+	}
+	return 1
+}
+
+// minReplicas is the lower bound of the autoscaler
+func minReplicas(webapp *kleffv1.WebApp) int32 {
+	if webapp.Spec.MinReplicas != nil {
+		return *webapp.Spec.MinReplicas
+	}
+	return 1
+}
+
+// reconcileAutoscaler creates the HorizontalPodAutoscaler of the WebApp's
+// Deployment named target when autoscaling is on, and removes it when it was
+// turned off.
+func (r *WebAppReconciler) reconcileAutoscaler(ctx context.Context, webapp *kleffv1.WebApp, target string, labels map[string]string) error {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      webapp.Name,
+			Namespace: webapp.Namespace,
+		},
+	}
+
+	if !autoscalingEnabled(webapp) {
+		err := r.Delete(ctx, hpa)
+		return client.IgnoreNotFound(err)
+	}
+
+	utilization := defaultTargetCPUUtilization
+	if webapp.Spec.TargetCPUUtilization != nil {
+		utilization = *webapp.Spec.TargetCPUUtilization
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, hpa, func() error {
+		hpa.Labels = labels
+		hpa.Spec.ScaleTargetRef = autoscalingv2.CrossVersionObjectReference{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       target,
+		}
+		lowerBound := minReplicas(webapp)
+		hpa.Spec.MinReplicas = &lowerBound
+		hpa.Spec.MaxReplicas = *webapp.Spec.MaxReplicas
+		hpa.Spec.Metrics = []autoscalingv2.MetricSpec{{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: "cpu",
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: &utilization,
+				},
+			},
+		}}
+		return controllerutil.SetControllerReference(webapp, hpa, r.Scheme)
+	})
+	return err
+}
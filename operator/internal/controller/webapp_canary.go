@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+const defaultCanaryPauseSeconds = int32(300)
+
+// canaryName is the Deployment and Service name of the canary
+func canaryName(webapp *kleffv1.WebApp) string {
+	return webapp.Name + "-canary"
+}
+
+func canarySteps(webapp *kleffv1.WebApp) []kleffv1.CanaryStep {
+	if webapp.Spec.Strategy != nil && webapp.Spec.Strategy.Canary != nil && len(webapp.Spec.Strategy.Canary.Steps) > 0 {
+		return webapp.Spec.Strategy.Canary.Steps
+	}
+	// 10% then 50% of the requests, five minutes each
+	pause := defaultCanaryPauseSeconds
+	return []kleffv1.CanaryStep{
+		{Weight: 10, PauseSeconds: &pause},
+		{Weight: 50, PauseSeconds: &pause},
+	}
+}
+
+// reconcileCanary keeps the WebApp's own Deployment on the stable template
+// and runs a new template as a canary next to it. The HTTPRoute sends the
+// weight of the current step to the canary, and the canary replaces the
+// stable version once the last step passed. A step without a pause lasts
+// until the release is promoted.
+func (r *WebAppReconciler) reconcileCanary(ctx context.Context, webapp *kleffv1.WebApp, labels map[string]string, template corev1.PodTemplateSpec) (*rollout, error) {
+	action, actionID := pendingCanaryAction(webapp)
+
+	stable := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: webapp.Name, Namespace: webapp.Namespace}, stable)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	// Nothing to compare a first version against, so it goes out directly.
+	// An action has no canary to act on then.
+	hash := templateHash(template)
+	if k8serrors.IsNotFound(err) || stable.Annotations[templateHashAnnotation] == hash {
+		if err := r.clearCanaryAction(ctx, webapp); err != nil {
+			return nil, err
+		}
+		return r.promoteCanary(ctx, webapp, labels, template)
+	}
+
+	status := webapp.Status.Canary
+	if status == nil || status.TemplateHash != hash {
+		status = &kleffv1.CanaryStatus{Image: webapp.Spec.Image, TemplateHash: hash}
+		if webapp.Status.Canary != nil {
+			status.LastAction = webapp.Status.Canary.LastAction
+		}
+		webapp.Status.Canary = status
+	}
+
+	if action != "" && (actionID == "" || actionID != status.LastAction) {
+		switch action {
+		case kleffv1.CanaryActionAbort:
+			status.Aborted = true
+		case kleffv1.CanaryActionPromote:
+			if !status.Aborted {
+				status.Step++
+				status.StepStartedAt = nil
+			}
+		}
+		// Saved before the annotation goes, so a failure in between cannot
+		// apply the action twice
+		status.LastAction = actionID
+		if err := r.Status().Update(ctx, webapp); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.clearCanaryAction(ctx, webapp); err != nil {
+		return nil, err
+	}
+
+	// An aborted release leaves the stable version alone until the spec
+	// changes again
+	if status.Aborted {
+		if err := r.removeWorkload(ctx, webapp, canaryName(webapp)); err != nil {
+			return nil, err
+		}
+		status.Weight = 0
+		status.StepStartedAt = nil
+		return &rollout{active: stable, updating: stable, backends: soleBackend(stable.Name)}, nil
+	}
+
+	steps := canarySteps(webapp)
+	if int(status.Step) < len(steps) && status.StepStartedAt != nil {
+		if pause := steps[status.Step].PauseSeconds; pause != nil && !time.Now().Before(status.StepStartedAt.Add(time.Duration(*pause)*time.Second)) {
+			status.Step++
+			status.StepStartedAt = nil
+		}
+	}
+	if int(status.Step) >= len(steps) {
+		return r.promoteCanary(ctx, webapp, labels, template)
+	}
+	step := steps[status.Step]
+
+	// The canary gets its share of the stable pods, at least one
+	stableReplicas := int32(1)
+	if stable.Spec.Replicas != nil {
+		stableReplicas = *stable.Spec.Replicas
+	}
+	replicas := max(1, (stableReplicas*step.Weight+99)/100)
+
+	name := canaryName(webapp)
+	if err := r.syncService(ctx, webapp, name, labels); err != nil {
+		return nil, err
+	}
+	canary, err := r.syncDeployment(ctx, webapp, name, labels, template, &replicas)
+	if err != nil {
+		return nil, err
+	}
+
+	// The weight only moves once the canary pods of the step are ready
+	result := &rollout{active: stable, updating: canary}
+	if deploymentReady(canary) {
+		status.Weight = step.Weight
+		if status.StepStartedAt == nil {
+			now := metav1.Now()
+			status.StepStartedAt = &now
+		}
+		if step.PauseSeconds != nil {
+			result.requeueAfter = time.Until(status.StepStartedAt.Add(time.Duration(*step.PauseSeconds) * time.Second))
+		}
+	}
+	result.backends = []routeBackend{
+		{service: stable.Name, weight: 100 - status.Weight},
+		{service: name, weight: status.Weight},
+	}
+	return result, nil
+}
+
+// promoteCanary rolls the template out to the WebApp's own Deployment and
+// drops the canary
+func (r *WebAppReconciler) promoteCanary(ctx context.Context, webapp *kleffv1.WebApp, labels map[string]string, template corev1.PodTemplateSpec) (*rollout, error) {
+	deployment, err := r.syncDeployment(ctx, webapp, webapp.Name, labels, template, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.removeWorkload(ctx, webapp, canaryName(webapp)); err != nil {
+		return nil, err
+	}
+	webapp.Status.Canary = nil
+	return &rollout{active: deployment, updating: deployment, backends: soleBackend(webapp.Name)}, nil
+}
+
+// pendingCanaryAction returns the canary action requested on the WebApp
+// and its ID
+func pendingCanaryAction(webapp *kleffv1.WebApp) (string, string) {
+	return webapp.Annotations[kleffv1.CanaryActionAnnotation], webapp.Annotations[kleffv1.CanaryActionIDAnnotation]
+}
+
+// clearCanaryAction removes the canary action annotations of the WebApp. The
+// status is left out of the patch, as it holds the changes of this reconcile.
+func (r *WebAppReconciler) clearCanaryAction(ctx context.Context, webapp *kleffv1.WebApp) error {
+	_, hasAction := webapp.Annotations[kleffv1.CanaryActionAnnotation]
+	_, hasID := webapp.Annotations[kleffv1.CanaryActionIDAnnotation]
+	if !hasAction && !hasID {
+		return nil
+	}
+
+	patched := webapp.DeepCopy()
+	patch := client.MergeFrom(webapp.DeepCopy())
+	delete(patched.Annotations, kleffv1.CanaryActionAnnotation)
+	delete(patched.Annotations, kleffv1.CanaryActionIDAnnotation)
+	if err := r.Patch(ctx, patched, patch); err != nil {
+		return err
+	}
+	webapp.Annotations = patched.Annotations
+	webapp.ResourceVersion = patched.ResourceVersion
+	return nil
+}
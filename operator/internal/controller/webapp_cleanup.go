@@ -0,0 +1,348 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+// webAppFinalizer holds a deleted WebApp until cleanupWebApp removed what
+// owner references cannot reach
+const webAppFinalizer = "kleff.kleff.io/cleanup"
+
+// buildImageAnnotation records the image a build Job pushes, set by the
+// deployment service
+const buildImageAnnotation = "kleff.io/image"
+
+// CleanupConfig locates what a WebApp leaves behind outside of its namespace
+type CleanupConfig struct {
+	// BuildNamespace is where the deployment service runs the build Jobs
+	BuildNamespace string
+
+	// RegistrySecret is the kubernetes.io/dockerconfigjson Secret of the
+	// build namespace allowed to delete images. Images are kept when it is
+	// empty or missing.
+	RegistrySecret string
+
+	// RetainedImages is how many of the most recent images of a deleted app
+	// stay in the registry, so it can be recreated from them
+	RetainedImages int
+}
+
+// DefaultCleanupConfig matches where the deployment service builds and pushes,
+// and keeps as many images as the revision history can roll back to
+func DefaultCleanupConfig() CleanupConfig {
+	return CleanupConfig{
+		BuildNamespace: "default",
+		RegistrySecret: "acr-creds",
+		RetainedImages: kleffv1.MaxRevisionHistory,
+	}
+}
+
+// cleanupWebApp runs once a WebApp is deleted: it removes the build Jobs and
+// their copied Git credentials, the registry images no other workload runs
+// beyond the retained ones, the routes ExternalDNS publishes records for and
+// the certificate Secrets cert-manager does not delete with the HTTPS
+// listeners serving them, and the claims of removed volumes. The finalizer is
+// released once all of it is gone.
+func (r *WebAppReconciler) cleanupWebApp(ctx context.Context, webapp *kleffv1.WebApp) (ctrl.Result, error) {
+	logger := logf.FromContext(ctx)
+	config := DefaultCleanupConfig()
+	if r.Cleanup != nil {
+		config = *r.Cleanup
+	}
+
+	if !controllerutil.ContainsFinalizer(webapp, webAppFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	buildImages, err := r.deleteBuildJobs(ctx, webapp, config.BuildNamespace)
+	if err != nil {
+		logger.Error(err, "Failed to delete build Jobs")
+		return ctrl.Result{}, err
+	}
+
+	// A registry that cannot be reached must not keep the app, or its
+	// namespace, from being deleted
+	if deleted, err := r.deleteImages(ctx, webapp, config, buildImages); err != nil {
+		logger.Error(err, "Failed to delete registry images, they are left behind")
+	} else if len(deleted) > 0 {
+		logger.Info("Deleted registry images", "images", deleted)
+	}
+
+	// ExternalDNS drops the records of the app with its routes, which are
+	// deleted first so the records never outlive the WebApp
+	if err := r.deleteRoutes(ctx, webapp); err != nil {
+		logger.Error(err, "Failed to delete routes")
+		return ctrl.Result{}, err
+	}
+	platform, err := r.platformSettings(ctx, webapp.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if _, err := r.syncDomainListeners(ctx, webapp, nil, platform); err != nil {
+		logger.Error(err, "Failed to remove domain listeners")
+		return ctrl.Result{}, err
+	}
+	if err := r.deleteCertificateSecrets(ctx, webapp); err != nil {
+		logger.Error(err, "Failed to delete certificate Secrets")
+		return ctrl.Result{}, err
+	}
+	if err := r.deleteOrphanedVolumes(ctx, webapp); err != nil {
+		logger.Error(err, "Failed to delete orphaned volumes")
+		return ctrl.Result{}, err
+	}
+
+	controllerutil.RemoveFinalizer(webapp, webAppFinalizer)
+	if err := r.Update(ctx, webapp); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	return ctrl.Result{}, nil
+}
+
+// deleteBuildJobs deletes the build Jobs of the WebApp, running or not, and
+// returns the images they pushed, oldest first
+func (r *WebAppReconciler) deleteBuildJobs(ctx context.Context, webapp *kleffv1.WebApp, namespace string) ([]string, error) {
+	jobs := &batchv1.JobList{}
+	err := r.List(ctx, jobs, client.InNamespace(namespace), client.MatchingLabels{
+		"managed-by": "paas-backend",
+		"project-id": webapp.Namespace,
+		"app":        webapp.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(jobs.Items, func(i, j int) bool {
+		return jobs.Items[i].CreationTimestamp.Before(&jobs.Items[j].CreationTimestamp)
+	})
+	images := make([]string, 0, len(jobs.Items))
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if image := job.Annotations[buildImageAnnotation]; image != "" {
+			images = append(images, image)
+		}
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		// Only owned by the Job once it was created, so not always collected with it
+		credentials := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-git", Namespace: namespace}}
+		if err := r.Delete(ctx, credentials); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
+
+// deleteImages deletes the images the WebApp ran or built from the registry,
+// except the config.RetainedImages most recent ones and those another
+// WebApp, Worker or CronJob still runs, since apps sharing a name share a
+// repository. Images are compared by digest, as the manifest of an image is
+// deleted under every tag. It returns the deleted images.
+func (r *WebAppReconciler) deleteImages(ctx context.Context, webapp *kleffv1.WebApp, config CleanupConfig, buildImages []string) ([]string, error) {
+	if config.RegistrySecret == "" {
+		return nil, nil
+	}
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: config.RegistrySecret, Namespace: config.BuildNamespace}, secret)
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	creds, err := parseDockerConfig(secret.Data[corev1.DockerConfigJsonKey])
+	if err != nil {
+		return nil, err
+	}
+
+	images := appImages(webapp, buildImages)
+	if config.RetainedImages >= len(images) {
+		return nil, nil
+	}
+	retained := images[len(images)-max(config.RetainedImages, 0):]
+	images = images[:len(images)-max(config.RetainedImages, 0)]
+
+	// Retained images must keep their manifests as much as running ones
+	inUse, err := r.imagesInUse(ctx, webapp)
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range retained {
+		inUse[image] = true
+	}
+
+	httpClient := r.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	registry := &registryClient{http: httpClient, creds: creds}
+
+	// Only the images of the repositories being cleaned up are resolved
+	repositories := make(map[string]bool, len(images))
+	for _, image := range images {
+		if ref, ok := parseImage(image); ok {
+			repositories[ref.Host+"/"+ref.Repository] = true
+		}
+	}
+	inUseDigests := make(map[string]bool)
+	for image := range inUse {
+		if image == "" {
+			continue
+		}
+		ref, ok := parseImage(image)
+		if !ok || !repositories[ref.Host+"/"+ref.Repository] {
+			continue
+		}
+		_, digest, err := registry.resolveDigest(ctx, image)
+		if err != nil {
+			return nil, err
+		}
+		inUseDigests[digest] = true
+	}
+
+	var deleted []string
+	for _, image := range images {
+		if inUse[image] {
+			continue
+		}
+		ref, digest, err := registry.resolveDigest(ctx, image)
+		if err != nil {
+			return deleted, err
+		}
+		if digest == "" || inUseDigests[digest] {
+			continue
+		}
+		ok, err := registry.deleteManifest(ctx, ref, digest)
+		if err != nil {
+			return deleted, err
+		}
+		if ok {
+			deleted = append(deleted, image)
+		}
+	}
+	return deleted, nil
+}
+
+// appImages lists the images of the WebApp once each, oldest first: its
+// revision history, the current and desired images, then the builds
+func appImages(webapp *kleffv1.WebApp, buildImages []string) []string {
+	var ordered []string
+	for _, revision := range webapp.Status.Revisions {
+		ordered = append(ordered, revision.Image)
+	}
+	ordered = append(ordered, webapp.Status.CurrentImage, webapp.Spec.Image)
+	ordered = append(ordered, buildImages...)
+
+	// The latest occurrence decides the position
+	last := make(map[string]int, len(ordered))
+	for i, image := range ordered {
+		if image != "" {
+			last[image] = i
+		}
+	}
+	images := make([]string, 0, len(last))
+	for i, image := range ordered {
+		if image != "" && last[image] == i {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// imagesInUse are the images of every other WebApp, Worker and CronJob
+func (r *WebAppReconciler) imagesInUse(ctx context.Context, webapp *kleffv1.WebApp) (map[string]bool, error) {
+	inUse := make(map[string]bool)
+
+	webapps := &kleffv1.WebAppList{}
+	if err := r.List(ctx, webapps); err != nil {
+		return nil, err
+	}
+	for _, other := range webapps.Items {
+		if other.UID == webapp.UID {
+			continue
+		}
+		inUse[other.Spec.Image] = true
+		inUse[other.Status.CurrentImage] = true
+	}
+
+	workers := &kleffv1.WorkerList{}
+	if err := r.List(ctx, workers); err != nil {
+		return nil, err
+	}
+	for _, worker := range workers.Items {
+		inUse[worker.Spec.Image] = true
+		inUse[worker.Status.CurrentImage] = true
+	}
+
+	cronJobs := &kleffv1.CronJobList{}
+	if err := r.List(ctx, cronJobs); err != nil {
+		return nil, err
+	}
+	for _, cronJob := range cronJobs.Items {
+		inUse[cronJob.Spec.Image] = true
+		inUse[cronJob.Status.CurrentImage] = true
+	}
+	return inUse, nil
+}
+
+// deleteRoutes deletes the HTTPRoute and the port objects of the WebApp
+func (r *WebAppReconciler) deleteRoutes(ctx context.Context, webapp *kleffv1.WebApp) error {
+	route := &gatewayv1.HTTPRoute{}
+	err := r.Get(ctx, types.NamespacedName{Name: webapp.Name + "-route", Namespace: webapp.Namespace}, route)
+	switch {
+	case err == nil:
+		if metav1.IsControlledBy(route, webapp) {
+			if err := r.Delete(ctx, route); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	case !k8serrors.IsNotFound(err) && !meta.IsNoMatchError(err):
+		return err
+	}
+	return r.deleteStalePortObjects(ctx, webapp, nil)
+}
+
+// deleteCertificateSecrets deletes the Secrets cert-manager issued the custom
+// domain certificates into, which it keeps when a Certificate is deleted
+func (r *WebAppReconciler) deleteCertificateSecrets(ctx context.Context, webapp *kleffv1.WebApp) error {
+	certs := &unstructured.UnstructuredList{}
+	certs.SetGroupVersionKind(certificateGVK.GroupVersion().WithKind("CertificateList"))
+	err := r.List(ctx, certs, client.InNamespace(webapp.Namespace), client.MatchingLabels{"app": webapp.Name})
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return err
+	}
+	for i := range certs.Items {
+		cert := &certs.Items[i]
+		if !metav1.IsControlledBy(cert, webapp) {
+			continue
+		}
+		secretName, _, _ := unstructured.NestedString(cert.Object, "spec", "secretName")
+		if secretName == "" {
+			continue
+		}
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: webapp.Namespace}}
+		if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
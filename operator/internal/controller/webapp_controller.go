@@ -3,18 +3,20 @@ package controller
 import (
 	"context"
 	"fmt"
-	"regexp" 
-	"strings"
+	"net/http"
+	"regexp"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/intstr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	// Import Gateway API types
@@ -26,13 +28,44 @@ import (
 type WebAppReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// Resources holds the resource plans, DefaultResourceConfig when nil
+	Resources *ResourceConfig
+
+	// Platform holds the settings from the flags and config file,
+	// DefaultPlatformSettings when nil. The PlatformConfig overrides them.
+	Platform *kleffv1.PlatformSettings
+
+	// LookupTXT resolves the TXT records verifying custom domains, the
+	// system resolver when nil
+	LookupTXT func(ctx context.Context, name string) ([]string, error)
+
+	// Cleanup locates the builds and images of deleted WebApps,
+	// DefaultCleanupConfig when nil
+	Cleanup *CleanupConfig
+
+	// HTTPClient talks to the container registry, http.DefaultClient when nil
+	HTTPClient *http.Client
 }
 
-//+kubebuilder:rbac:groups=kleff.kleff.io,resources=webapps,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=kleff.kleff.io,resources=webapps/status,verbs=get;update;patch
-//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=webapps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=webapps/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=platformconfigs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=databases,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=workers;cronjobs,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=resourcequotas;limitranges,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes;grpcroutes;tcproutes;udproutes,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=referencegrants,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
+
 func (r *WebAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 
@@ -43,8 +76,23 @@ func (r *WebAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	// Clean up what owner references do not reach before the WebApp goes
+	if !webapp.DeletionTimestamp.IsZero() {
+		return r.cleanupWebApp(ctx, webapp)
+	}
+	if controllerutil.AddFinalizer(webapp, webAppFinalizer) {
+		if err := r.Update(ctx, webapp); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Nothing can run before the first build pushed an image
+	if webapp.Spec.Image == "" {
+		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "AwaitingBuild", "Waiting for the first build to succeed")
+	}
+
 	// --- DEFINE LABELS ---
-	// "app" is the UUID (webapp.Name). 
+	// "app" is the UUID (webapp.Name).
 	// We add "display-name" for human observability via kubectl.
 	labels := map[string]string{
 		"app":          webapp.Name, // This is the UUID
@@ -57,95 +105,84 @@ func (r *WebAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		labels["display-name"] = safeDisplayName
 	}
 
-	// 2. Sync Deployment
-	deployment := &appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      webapp.Name, // UUID
-			Namespace: webapp.Namespace,
-		},
+	platform, err := r.platformSettings(ctx, webapp.Namespace)
+	if err != nil {
+		logger.Error(err, "Failed to read platform config")
+		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "PlatformConfigFailed", err.Error())
 	}
 
-	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, deployment, func() error {
-		deployment.Labels = labels
-
-		// Selector is immutable after creation, so we set it only if new
-		if deployment.CreationTimestamp.IsZero() {
-			deployment.Spec.Selector = &metav1.LabelSelector{
-				MatchLabels: map[string]string{"app": webapp.Name},
-			}
-		}
-
-		replicas := int32(1)
-		deployment.Spec.Replicas = &replicas
-
-		// Pod Template
-		if deployment.Spec.Template.ObjectMeta.Labels == nil {
-			deployment.Spec.Template.ObjectMeta.Labels = make(map[string]string)
-		}
-		for k, v := range labels {
-			deployment.Spec.Template.ObjectMeta.Labels[k] = v
-		}
-
-		deployment.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{
-			{Name: "acr-creds"},
-		}
+	secretEnvHash, err := secretEnvHash(ctx, r.Client, webapp.Namespace, webapp.Name, webapp.Spec.SecretEnv)
+	if err != nil {
+		logger.Error(err, "Failed to read secret environment")
+		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "SecretEnvFailed", err.Error())
+	}
 
-		// Environment Variables
-		var envVars []corev1.EnvVar
-		for key, value := range webapp.Spec.EnvVariables {
-			envVars = append(envVars, corev1.EnvVar{Name: key, Value: value})
-		}
+	missing, err := missingDatabase(ctx, r.Client, webapp.Namespace, webapp.Spec.Databases)
+	if err != nil {
+		logger.Error(err, "Failed to read bound databases")
+		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "DatabaseFailed", err.Error())
+	}
+	if missing != "" {
+		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "DatabaseNotFound", fmt.Sprintf("Database %s does not exist", missing))
+	}
 
-		deployment.Spec.Template.Spec.Containers = []corev1.Container{{
-			Name:            "app",
-			Image:           webapp.Spec.Image,
-			ImagePullPolicy: corev1.PullAlways,
-			Env:             envVars,
-			Ports: []corev1.ContainerPort{{
-				Name:          "http",
-				ContainerPort: int32(webapp.Spec.Port),
-				Protocol:      corev1.ProtocolTCP,
-			}},
-			LivenessProbe: &corev1.Probe{
-				ProbeHandler: corev1.ProbeHandler{
-					TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(webapp.Spec.Port)},
-				},
-			},
-		}}
+	resources, err := r.containerResources(webapp)
+	if err != nil {
+		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "InvalidPlan", err.Error())
+	}
+	if err := r.reconcileNamespaceLimits(ctx, webapp.Namespace); err != nil {
+		logger.Error(err, "Failed to reconcile namespace quota")
+		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "QuotaFailed", err.Error())
+	}
 
-		return controllerutil.SetControllerReference(webapp, deployment, r.Scheme)
-	})
+	if err := r.reconcileVolumes(ctx, webapp, labels); err != nil {
+		logger.Error(err, "Failed to reconcile volumes")
+		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "VolumesFailed", err.Error())
+	}
 
+	// 2. Sync Deployment, through the strategy of the WebApp
+	template := r.podTemplate(webapp, labels, platform, resources, secretEnvHash)
+	rollout, err := r.reconcileRollout(ctx, webapp, labels, template)
 	if err != nil {
 		logger.Error(err, "Failed to reconcile Deployment")
 		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "DeploymentFailed", err.Error())
 	}
 
-	// 3. Sync Service
-	service := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      webapp.Name, // UUID
-			Namespace: webapp.Namespace,
-		},
+	// Keep a history of rollouts so an earlier image can be restored
+	if recordRevision(webapp) {
+		if err := r.Status().Update(ctx, webapp); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
-	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, service, func() error {
-		service.Labels = labels
-		service.Spec.Selector = map[string]string{"app": webapp.Name}
-		service.Spec.Type = corev1.ServiceTypeClusterIP
-		service.Spec.Ports = []corev1.ServicePort{{
-			Name:       "http",
-			Port:       80,
-			TargetPort: intstr.FromInt(webapp.Spec.Port),
-			Protocol:   corev1.ProtocolTCP,
-		}}
-		return controllerutil.SetControllerReference(webapp, service, r.Scheme)
-	})
+	if err := r.reconcileAutoscaler(ctx, webapp, rollout.active.Name, labels); err != nil {
+		logger.Error(err, "Failed to reconcile HorizontalPodAutoscaler")
+		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "AutoscalerFailed", err.Error())
+	}
 
+	// 3. Sync Service
+	err = r.syncService(ctx, webapp, webapp.Name, labels)
 	if err != nil {
 		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "ServiceFailed", err.Error())
 	}
 
+	// Extra ports are exposed next to the HTTP route
+	endpoints, err := r.reconcilePorts(ctx, webapp, rollout.active.Name, labels, platform)
+	if err != nil {
+		logger.Error(err, "Failed to reconcile ports")
+		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "PortsFailed", err.Error())
+	}
+	endpointsPending := false
+	for _, endpoint := range endpoints {
+		if !endpoint.Ready {
+			endpointsPending = true
+		}
+	}
+
+	// Custom domains are only routed once their ownership is verified
+	domainsBefore := webapp.Status.DeepCopy().Domains
+	verifiedDomains, domainsPending := r.reconcileDomainVerification(ctx, webapp)
+
 	// 4. Sync HTTPRoute (Envoy Gateway)
 	httpRoute := &gatewayv1.HTTPRoute{
 		ObjectMeta: metav1.ObjectMeta{
@@ -155,41 +192,35 @@ func (r *WebAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	}
 
 	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, httpRoute, func() error {
-		if httpRoute.Annotations == nil {
-			httpRoute.Annotations = make(map[string]string)
-		}
 		// ExternalDNS targets
-		httpRoute.Annotations["external-dns.alpha.kubernetes.io/target"] = "66.130.187.229"
-		httpRoute.Annotations["external-dns.alpha.kubernetes.io/cloudflare-proxied"] = "false"
-		httpRoute.Annotations["external-dns.alpha.kubernetes.io/ttl"] = "3600"
-
-		gwNamespace := gatewayv1.Namespace("envoy-gateway-system")
-		httpRoute.Spec.CommonRouteSpec.ParentRefs = []gatewayv1.ParentReference{
-			{
-				Name:      "prod-web",
-				Namespace: &gwNamespace,
-			},
-		}
+		httpRoute.Annotations = routeAnnotations(httpRoute.Annotations, platform)
+		httpRoute.Spec.CommonRouteSpec.ParentRefs = []gatewayv1.ParentReference{platformGateway(platform, nil)}
 
 		// THE SUBDOMAIN: Using webapp.Name (UUID)
-		hostname := gatewayv1.Hostname(fmt.Sprintf("%s.kleff.io", webapp.Name))
+		hostname := gatewayv1.Hostname(fmt.Sprintf("%s.%s", webapp.Name, platform.BaseDomain))
 		httpRoute.Spec.Hostnames = []gatewayv1.Hostname{hostname}
+		for _, domain := range verifiedDomains {
+			httpRoute.Spec.Hostnames = append(httpRoute.Spec.Hostnames, gatewayv1.Hostname(domain))
+		}
 
-		// POINT TO BACKEND: Points to the Service named with the UUID
+		// POINT TO BACKEND: Points to the Service named with the UUID, the
+		// active slot, or splits the traffic with a canary
 		port := gatewayv1.PortNumber(80)
-		httpRoute.Spec.Rules = []gatewayv1.HTTPRouteRule{
-			{
-				BackendRefs: []gatewayv1.HTTPBackendRef{
-					{
-						BackendRef: gatewayv1.BackendRef{
-							BackendObjectReference: gatewayv1.BackendObjectReference{
-								Name: gatewayv1.ObjectName(webapp.Name), // UUID Service
-								Port: &port,
-							},
-						},
+		backendRefs := make([]gatewayv1.HTTPBackendRef, 0, len(rollout.backends))
+		for _, backend := range rollout.backends {
+			weight := backend.weight
+			backendRefs = append(backendRefs, gatewayv1.HTTPBackendRef{
+				BackendRef: gatewayv1.BackendRef{
+					BackendObjectReference: gatewayv1.BackendObjectReference{
+						Name: gatewayv1.ObjectName(backend.service),
+						Port: &port,
 					},
+					Weight: &weight,
 				},
-			},
+			})
+		}
+		httpRoute.Spec.Rules = []gatewayv1.HTTPRouteRule{
+			{BackendRefs: backendRefs},
 		}
 
 		return controllerutil.SetControllerReference(webapp, httpRoute, r.Scheme)
@@ -200,33 +231,69 @@ func (r *WebAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "HTTPRouteFailed", err.Error())
 	}
 
+	certificatesPending, err := r.reconcileDomainCertificates(ctx, webapp, labels, platform.ClusterIssuer)
+	if err != nil {
+		logger.Error(err, "Failed to reconcile domain certificates")
+		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "CertificateFailed", err.Error())
+	}
+	listenersPending, err := r.reconcileDomainListeners(ctx, webapp, labels, platform)
+	if err != nil {
+		logger.Error(err, "Failed to reconcile domain listeners")
+		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "CertificateFailed", err.Error())
+	}
+	if !equality.Semantic.DeepEqual(domainsBefore, webapp.Status.Domains) {
+		if err := r.Status().Update(ctx, webapp); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
 	// 5. Update Status based on Deployment Readiness
-	if deployment.Status.ReadyReplicas > 0 {
-		msg := fmt.Sprintf("WebApp is running at http://%s.kleff.io", webapp.Name)
-		return r.updateStatus(ctx, webapp, metav1.ConditionTrue, "Available", msg)
+	statusBefore := webapp.Status.DeepCopy()
+	webapp.Status.URL = fmt.Sprintf("https://%s.%s", webapp.Name, platform.BaseDomain)
+	webapp.Status.Endpoints = endpoints
+	if err := r.observeRollout(ctx, webapp, rollout.active, rollout.updating); err != nil {
+		logger.Error(err, "Failed to read pod status")
+		return ctrl.Result{}, err
+	}
+
+	var result ctrl.Result
+	degraded := meta.FindStatusCondition(webapp.Status.Conditions, kleffv1.ConditionDegraded)
+	if rollout.active.Status.ReadyReplicas > 0 {
+		msg := fmt.Sprintf("WebApp is running at %s", webapp.Status.URL)
+		result, err = r.persistStatus(ctx, webapp, statusBefore, metav1.ConditionTrue, "Available", msg)
+	} else if degraded != nil && degraded.Status == metav1.ConditionTrue {
+		result, err = r.persistStatus(ctx, webapp, statusBefore, metav1.ConditionFalse, degraded.Reason, degraded.Message)
 	} else {
-		return r.updateStatus(ctx, webapp, metav1.ConditionFalse, "Progressing", "Waiting for pods to be ready")
+		result, err = r.persistStatus(ctx, webapp, statusBefore, metav1.ConditionFalse, "Progressing", "Waiting for pods to be ready")
+	}
+
+	// Nothing signals a new TXT record or an issued certificate, so poll
+	if err == nil && (domainsPending || certificatesPending || listenersPending) {
+		result.RequeueAfter = domainRecheckInterval
+	}
+	if err == nil && endpointsPending && (result.RequeueAfter == 0 || endpointRecheckInterval < result.RequeueAfter) {
+		result.RequeueAfter = endpointRecheckInterval
+	}
+	if err == nil && rollout.requeueAfter > 0 && (result.RequeueAfter == 0 || rollout.requeueAfter < result.RequeueAfter) {
+		result.RequeueAfter = rollout.requeueAfter
 	}
+	return result, err
 }
 
 func (r *WebAppReconciler) updateStatus(ctx context.Context, webapp *kleffv1.WebApp, status metav1.ConditionStatus, reason, message string) (ctrl.Result, error) {
-	currentCond := meta.FindStatusCondition(webapp.Status.Conditions, "Available")
+	return r.persistStatus(ctx, webapp, webapp.Status.DeepCopy(), status, reason, message)
+}
+
+// persistStatus sets the Available condition and writes the status when it
+// differs from before
+func (r *WebAppReconciler) persistStatus(ctx context.Context, webapp *kleffv1.WebApp, before *kleffv1.WebAppStatus, status metav1.ConditionStatus, reason, message string) (ctrl.Result, error) {
+	setCondition(webapp, kleffv1.ConditionAvailable, status, reason, message)
+	webapp.Status.ObservedGeneration = webapp.Generation
 
-	if currentCond != nil &&
-		currentCond.Status == status &&
-		currentCond.Reason == reason &&
-		currentCond.Message == message {
+	if equality.Semantic.DeepEqual(before, &webapp.Status) {
 		return ctrl.Result{}, nil
 	}
 
-	meta.SetStatusCondition(&webapp.Status.Conditions, metav1.Condition{
-		Type:               "Available",
-		Status:             status,
-		Reason:             reason,
-		Message:            message,
-		LastTransitionTime: metav1.Now(),
-	})
-
 	if err := r.Status().Update(ctx, webapp); err != nil {
 		return ctrl.Result{}, err
 	}
@@ -240,6 +307,13 @@ func (r *WebAppReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&kleffv1.WebApp{}).
 		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.Service{}).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
 		Owns(&gatewayv1.HTTPRoute{}).
+		Owns(&gatewayv1.GRPCRoute{}).
+		Owns(&corev1.Secret{}).
+		Owns(&corev1.PersistentVolumeClaim{}).
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(webAppForPod)).
+		Watches(&kleffv1.PlatformConfig{}, handler.EnqueueRequestsFromMapFunc(r.webAppsForPlatformConfig)).
+		Watches(&kleffv1.Database{}, handler.EnqueueRequestsFromMapFunc(r.webAppsForDatabase)).
 		Complete(r)
 }
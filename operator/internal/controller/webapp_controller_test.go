@@ -18,12 +18,26 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -81,4 +95,1170 @@ var _ = Describe("WebApp Controller", func() {
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
 	})
+
+	Context("When the image of a WebApp changes", func() {
+		const resourceName = "revision-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			resource := &kleffv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.WebAppSpec{
+					Image: "nginx:1.25.3",
+					Port:  8080,
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should record a revision per rollout", func() {
+			controllerReconciler := &WebAppReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			By("Reconciling the initial image")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Rolling out a new image")
+			webapp := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			webapp.Spec.Image = "nginx:1.27.0"
+			webapp.Spec.Commit = "3f786850e387550fdab836ed7e6dc881de23001b"
+			Expect(k8sClient.Update(ctx, webapp)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			Expect(webapp.Status.Revisions).To(HaveLen(2))
+			Expect(webapp.Status.Revisions[0].Image).To(Equal("nginx:1.25.3"))
+			Expect(webapp.Status.Revisions[1].Revision).To(Equal(int64(2)))
+			Expect(webapp.Status.Revisions[1].Image).To(Equal("nginx:1.27.0"))
+			Expect(webapp.Status.Revisions[1].Commit).To(Equal("3f786850e387550fdab836ed7e6dc881de23001b"))
+			Expect(webapp.Status.Commit).To(Equal("3f786850e387550fdab836ed7e6dc881de23001b"))
+		})
+	})
+
+	Context("When autoscaling a WebApp", func() {
+		const resourceName = "autoscaled-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			minReplicas, maxReplicas := int32(2), int32(5)
+			resource := &kleffv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.WebAppSpec{
+					Image:       "nginx:1.25.3",
+					Port:        8080,
+					MinReplicas: &minReplicas,
+					MaxReplicas: &maxReplicas,
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should create and remove the HorizontalPodAutoscaler", func() {
+			controllerReconciler := &WebAppReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			By("Reconciling with autoscaling on")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, hpa)).To(Succeed())
+			Expect(*hpa.Spec.MinReplicas).To(Equal(int32(2)))
+			Expect(hpa.Spec.MaxReplicas).To(Equal(int32(5)))
+			Expect(*hpa.Spec.Metrics[0].Resource.Target.AverageUtilization).To(Equal(int32(80)))
+
+			By("Turning autoscaling off")
+			webapp := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			replicas := int32(3)
+			webapp.Spec.Replicas = &replicas
+			webapp.Spec.MinReplicas = nil
+			webapp.Spec.MaxReplicas = nil
+			Expect(k8sClient.Update(ctx, webapp)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, hpa))).To(BeTrue())
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(3)))
+		})
+	})
+
+	Context("When a WebApp has custom domains", func() {
+		const resourceName = "domain-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			resource := &kleffv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.WebAppSpec{
+					Image:         "nginx:1.25.3",
+					Port:          8080,
+					CustomDomains: []string{"www.example.com", "shop.example.com"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should only route the verified domains", func() {
+			webapp := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+
+			controllerReconciler := &WebAppReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+				LookupTXT: func(_ context.Context, name string) ([]string, error) {
+					if name == "_kleff-verification.www.example.com" {
+						return []string{verificationToken(webapp, "www.example.com")}, nil
+					}
+					return nil, nil
+				},
+			}
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(domainRecheckInterval))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			Expect(webapp.Status.Domains).To(HaveLen(2))
+			Expect(webapp.Status.Domains[0].Verified).To(BeTrue())
+			Expect(webapp.Status.Domains[1].Verified).To(BeFalse())
+			Expect(webapp.Status.Domains[1].VerificationRecord).To(Equal("_kleff-verification.shop.example.com"))
+
+			route := &gatewayv1.HTTPRoute{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-route", Namespace: "default"}, route)).To(Succeed())
+			Expect(route.Spec.Hostnames).To(ConsistOf(
+				gatewayv1.Hostname(resourceName+".kleff.io"),
+				gatewayv1.Hostname("www.example.com"),
+			))
+		})
+	})
+
+	Context("When the certificate of a custom domain is issued", func() {
+		const resourceName = "tls-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		gatewayName := types.NamespacedName{Name: "tls-gateway", Namespace: "default"}
+		platform := kleffv1.PlatformSettings{GatewayName: gatewayName.Name, GatewayNamespace: gatewayName.Namespace}
+
+		BeforeEach(func() {
+			gateway := &gatewayv1.Gateway{
+				ObjectMeta: metav1.ObjectMeta{Name: gatewayName.Name, Namespace: gatewayName.Namespace},
+				Spec: gatewayv1.GatewaySpec{
+					GatewayClassName: "eg",
+					Listeners: []gatewayv1.Listener{{
+						Name:     "http",
+						Port:     80,
+						Protocol: gatewayv1.HTTPProtocolType,
+					}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, gateway)).To(Succeed())
+
+			resource := &kleffv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.WebAppSpec{
+					Image:         "nginx:1.25.3",
+					Port:          8080,
+					CustomDomains: []string{"www.example.com"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			gateway := &gatewayv1.Gateway{}
+			Expect(k8sClient.Get(ctx, gatewayName, gateway)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, gateway)).To(Succeed())
+		})
+
+		It("should serve it on an HTTPS listener of the Gateway", func() {
+			controllerReconciler := &WebAppReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			webapp := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			webapp.Status.Domains = []kleffv1.DomainStatus{{
+				Domain:           "www.example.com",
+				Verified:         true,
+				CertificateReady: true,
+			}}
+			labels := map[string]string{"app": resourceName}
+			pending, err := controllerReconciler.reconcileDomainListeners(ctx, webapp, labels, platform)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pending).To(BeFalse())
+
+			secretName := domainSecretName(webapp, "www.example.com")
+			gateway := &gatewayv1.Gateway{}
+			Expect(k8sClient.Get(ctx, gatewayName, gateway)).To(Succeed())
+			Expect(gateway.Spec.Listeners).To(HaveLen(2))
+			listener := gateway.Spec.Listeners[1]
+			Expect(listener.Name).To(Equal(domainListenerName(webapp, "www.example.com")))
+			Expect(*listener.Hostname).To(Equal(gatewayv1.Hostname("www.example.com")))
+			Expect(listener.Port).To(Equal(gatewayv1.PortNumber(443)))
+			Expect(listener.Protocol).To(Equal(gatewayv1.HTTPSProtocolType))
+			Expect(listener.TLS.CertificateRefs).To(HaveLen(1))
+			Expect(listener.TLS.CertificateRefs[0].Name).To(Equal(gatewayv1.ObjectName(secretName)))
+			Expect(*listener.TLS.CertificateRefs[0].Namespace).To(Equal(gatewayv1.Namespace("default")))
+			Expect(listener.AllowedRoutes.Namespaces.Selector.MatchLabels).To(Equal(map[string]string{corev1.LabelMetadataName: "default"}))
+
+			grant := &gatewayv1beta1.ReferenceGrant{}
+			grantName := types.NamespacedName{Name: domainCertificateName(webapp, "www.example.com"), Namespace: "default"}
+			Expect(k8sClient.Get(ctx, grantName, grant)).To(Succeed())
+			Expect(grant.Spec.From).To(ConsistOf(gatewayv1beta1.ReferenceGrantFrom{
+				Group:     gatewayv1.GroupName,
+				Kind:      "Gateway",
+				Namespace: "default",
+			}))
+			Expect(grant.Spec.To).To(HaveLen(1))
+			Expect(grant.Spec.To[0].Kind).To(Equal(gatewayv1.Kind("Secret")))
+			Expect(*grant.Spec.To[0].Name).To(Equal(gatewayv1.ObjectName(secretName)))
+
+			By("Exceeding the listeners of the project")
+			webapp.Status.Domains = nil
+			for i := 0; i <= maxProjectDomainListeners; i++ {
+				webapp.Status.Domains = append(webapp.Status.Domains, kleffv1.DomainStatus{
+					Domain:           fmt.Sprintf("app%d.example.com", i),
+					Verified:         true,
+					CertificateReady: true,
+				})
+			}
+			_, err = controllerReconciler.reconcileDomainListeners(ctx, webapp, labels, platform)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, gatewayName, gateway)).To(Succeed())
+			Expect(gateway.Spec.Listeners).To(HaveLen(1 + maxProjectDomainListeners))
+			for _, status := range webapp.Status.Domains[:maxProjectDomainListeners] {
+				Expect(status.Message).To(BeEmpty())
+			}
+			Expect(webapp.Status.Domains[maxProjectDomainListeners].Message).To(ContainSubstring("the most it may"))
+
+			By("Dropping the domains")
+			webapp.Status.Domains = nil
+			_, err = controllerReconciler.reconcileDomainListeners(ctx, webapp, labels, platform)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, gatewayName, gateway)).To(Succeed())
+			Expect(gateway.Spec.Listeners).To(HaveLen(1))
+			err = k8sClient.Get(ctx, grantName, grant)
+			Expect(errors.IsNotFound(err) || grant.DeletionTimestamp != nil).To(BeTrue())
+		})
+	})
+
+	Context("When a PlatformConfig exists", func() {
+		const resourceName = "platform-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			config := &kleffv1.PlatformConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: kleffv1.PlatformConfigName},
+				Spec: kleffv1.PlatformConfigSpec{
+					PlatformSettings: kleffv1.PlatformSettings{
+						BaseDomain:  "staging.kleff.io",
+						GatewayName: "staging-web",
+					},
+					Namespaces: []kleffv1.NamespacePlatformSettings{{
+						Namespace:        "default",
+						PlatformSettings: kleffv1.PlatformSettings{ImagePullSecret: "staging-creds"},
+					}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, config)).To(Succeed())
+
+			resource := &kleffv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.WebAppSpec{
+					Image: "nginx:1.25.3",
+					Port:  8080,
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			config := &kleffv1.PlatformConfig{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: kleffv1.PlatformConfigName}, config)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, config)).To(Succeed())
+		})
+
+		It("should layer the PlatformConfig over the operator settings", func() {
+			platform := DefaultPlatformSettings()
+			platform.DNSTarget = "10.0.0.1"
+			controllerReconciler := &WebAppReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Platform: &platform,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			route := &gatewayv1.HTTPRoute{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-route", Namespace: "default"}, route)).To(Succeed())
+			Expect(route.Spec.Hostnames).To(ConsistOf(gatewayv1.Hostname(resourceName + ".staging.kleff.io")))
+			Expect(route.Spec.ParentRefs[0].Name).To(Equal(gatewayv1.ObjectName("staging-web")))
+			Expect(route.Annotations).To(HaveKeyWithValue("external-dns.alpha.kubernetes.io/target", "10.0.0.1"))
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.ImagePullSecrets).To(ConsistOf(corev1.LocalObjectReference{Name: "staging-creds"}))
+		})
+	})
+
+	Context("When a WebApp has a health check", func() {
+		const resourceName = "health-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			period := int32(5)
+			resource := &kleffv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.WebAppSpec{
+					Image: "nginx:1.25.3",
+					Port:  8080,
+					HealthCheck: &kleffv1.HealthCheck{
+						Path:          "/healthz",
+						PeriodSeconds: &period,
+						Probes:        []kleffv1.ProbeKind{kleffv1.ReadinessProbe, kleffv1.StartupProbe},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should map it to the container probes", func() {
+			controllerReconciler := &WebAppReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			container := deployment.Spec.Template.Spec.Containers[0]
+			Expect(container.ReadinessProbe.HTTPGet.Path).To(Equal("/healthz"))
+			Expect(container.ReadinessProbe.PeriodSeconds).To(Equal(int32(5)))
+			Expect(container.StartupProbe.FailureThreshold).To(Equal(int32(60)))
+			Expect(container.LivenessProbe).To(BeNil())
+		})
+	})
+
+	Context("When a WebApp runs on a plan", func() {
+		const resourceName = "plan-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			resource := &kleffv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.WebAppSpec{
+					Image: "nginx:1.25.3",
+					Port:  8080,
+					Plan:  "medium",
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			// Leave the namespace limits as the other tests expect them
+			Expect(reconcileNamespaceLimits(ctx, k8sClient, DefaultResourceConfig(), "default")).To(Succeed())
+		})
+
+		It("should size the container and bound the namespace from the config", func() {
+			config := DefaultResourceConfig()
+			config.NamespaceQuota[corev1.ResourcePods] = resource.MustParse("10")
+			controllerReconciler := &WebAppReconciler{
+				Client:    k8sClient,
+				Scheme:    k8sClient.Scheme(),
+				Resources: config,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			medium := config.Plans["medium"]
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			resources := deployment.Spec.Template.Spec.Containers[0].Resources
+			Expect(resources.Requests.Cpu().String()).To(Equal(medium.Requests.Cpu().String()))
+			Expect(resources.Requests.Memory().String()).To(Equal(medium.Requests.Memory().String()))
+			Expect(resources.Limits.Cpu().String()).To(Equal(medium.Limits.Cpu().String()))
+			Expect(resources.Limits.Memory().String()).To(Equal(medium.Limits.Memory().String()))
+
+			quota := &corev1.ResourceQuota{}
+			quotaName := types.NamespacedName{Name: namespaceQuotaName, Namespace: "default"}
+			Expect(k8sClient.Get(ctx, quotaName, quota)).To(Succeed())
+			Expect(quota.Spec.Hard.Pods().String()).To(Equal("10"))
+
+			small := config.Plans["small"]
+			limitRange := &corev1.LimitRange{}
+			limitRangeName := types.NamespacedName{Name: namespaceLimitRangeName, Namespace: "default"}
+			Expect(k8sClient.Get(ctx, limitRangeName, limitRange)).To(Succeed())
+			Expect(limitRange.Spec.Limits).To(HaveLen(1))
+			Expect(limitRange.Spec.Limits[0].Default.Memory().String()).To(Equal(small.Limits.Memory().String()))
+			Expect(limitRange.Spec.Limits[0].DefaultRequest.Memory().String()).To(Equal(small.Requests.Memory().String()))
+
+			By("Updating the limits once the config changes")
+			config.NamespaceQuota[corev1.ResourcePods] = resource.MustParse("20")
+			config.DefaultPlan = "medium"
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, quotaName, quota)).To(Succeed())
+			Expect(quota.Spec.Hard.Pods().String()).To(Equal("20"))
+			Expect(k8sClient.Get(ctx, limitRangeName, limitRange)).To(Succeed())
+			Expect(limitRange.Spec.Limits[0].Default.Memory().String()).To(Equal(medium.Limits.Memory().String()))
+			Expect(limitRange.Spec.Limits[0].DefaultRequest.Memory().String()).To(Equal(medium.Requests.Memory().String()))
+
+			By("Refusing a plan the config does not define")
+			webapp := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			webapp.Spec.Plan = "xlarge"
+			Expect(k8sClient.Update(ctx, webapp)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			available := meta.FindStatusCondition(webapp.Status.Conditions, kleffv1.ConditionAvailable)
+			Expect(available.Reason).To(Equal("InvalidPlan"))
+			Expect(available.Message).To(ContainSubstring(`unknown plan "xlarge"`))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Resources.Limits.Memory().String()).To(Equal(medium.Limits.Memory().String()))
+		})
+	})
+
+	Context("When a WebApp is rolling out", func() {
+		const resourceName = "status-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			resource := &kleffv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.WebAppSpec{
+					Image: "nginx:1.25.3",
+					Port:  8080,
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should report the rollout and pod failures in the status", func() {
+			controllerReconciler := &WebAppReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			webapp := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			Expect(webapp.Status.URL).To(Equal("https://" + resourceName + ".kleff.io"))
+			Expect(webapp.Status.ObservedGeneration).To(Equal(webapp.Generation))
+			Expect(webapp.Status.CurrentImage).To(BeEmpty())
+			Expect(meta.IsStatusConditionTrue(webapp.Status.Conditions, kleffv1.ConditionProgressing)).To(BeTrue())
+
+			By("Reporting a pod that cannot pull its image")
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName + "-pod",
+					Namespace: "default",
+					Labels:    map[string]string{"webapp": resourceName},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: "nginx:1.25.3"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, pod)
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+				Name:  "app",
+				Image: "nginx:1.25.3",
+				State: corev1.ContainerState{
+					Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"},
+				},
+			}}
+			Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			degraded := meta.FindStatusCondition(webapp.Status.Conditions, kleffv1.ConditionDegraded)
+			Expect(degraded).NotTo(BeNil())
+			Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+			Expect(degraded.Reason).To(Equal("ImagePullBackOff"))
+			Expect(meta.FindStatusCondition(webapp.Status.Conditions, kleffv1.ConditionAvailable).Reason).To(Equal("ImagePullBackOff"))
+		})
+	})
+
+	Context("When a WebApp uses the BlueGreen strategy", func() {
+		const resourceName = "bluegreen-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		routeName := types.NamespacedName{Name: resourceName + "-route", Namespace: "default"}
+
+		BeforeEach(func() {
+			resource := &kleffv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.WebAppSpec{
+					Image:    "nginx:1.25.3",
+					Port:     8080,
+					Strategy: &kleffv1.DeploymentStrategy{Type: kleffv1.StrategyBlueGreen},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should switch the HTTPRoute once the new slot is ready", func() {
+			controllerReconciler := &WebAppReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			backend := func() string {
+				route := &gatewayv1.HTTPRoute{}
+				Expect(k8sClient.Get(ctx, routeName, route)).To(Succeed())
+				return string(route.Spec.Rules[0].BackendRefs[0].Name)
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(backend()).To(Equal(resourceName))
+
+			By("Changing the image")
+			webapp := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			webapp.Spec.Image = "nginx:1.27.0"
+			Expect(k8sClient.Update(ctx, webapp)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(backend()).To(Equal(resourceName))
+
+			green := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-green", Namespace: "default"}, green)).To(Succeed())
+			Expect(green.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.27.0"))
+			blue := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, blue)).To(Succeed())
+			Expect(blue.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.25.3"))
+
+			By("Marking the green slot ready")
+			green.Status = appsv1.DeploymentStatus{
+				ObservedGeneration: green.Generation,
+				Replicas:           1,
+				UpdatedReplicas:    1,
+				ReadyReplicas:      1,
+				AvailableReplicas:  1,
+			}
+			Expect(k8sClient.Status().Update(ctx, green)).To(Succeed())
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			Expect(backend()).To(Equal(resourceName + "-green"))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			Expect(webapp.Status.BlueGreen.ActiveSlot).To(Equal(kleffv1.SlotGreen))
+			Expect(webapp.Status.CurrentImage).To(Equal("nginx:1.27.0"))
+		})
+	})
+
+	Context("When a WebApp uses the Canary strategy", func() {
+		const resourceName = "canary-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		routeName := types.NamespacedName{Name: resourceName + "-route", Namespace: "default"}
+		canaryName := types.NamespacedName{Name: resourceName + "-canary", Namespace: "default"}
+
+		BeforeEach(func() {
+			resource := &kleffv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.WebAppSpec{
+					Image: "nginx:1.25.3",
+					Port:  8080,
+					Strategy: &kleffv1.DeploymentStrategy{
+						Type:   kleffv1.StrategyCanary,
+						Canary: &kleffv1.CanaryStrategy{Steps: []kleffv1.CanaryStep{{Weight: 20}}},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should split the traffic until the canary is aborted", func() {
+			controllerReconciler := &WebAppReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			weights := func() map[string]int32 {
+				route := &gatewayv1.HTTPRoute{}
+				Expect(k8sClient.Get(ctx, routeName, route)).To(Succeed())
+				weights := map[string]int32{}
+				for _, ref := range route.Spec.Rules[0].BackendRefs {
+					weights[string(ref.Name)] = *ref.Weight
+				}
+				return weights
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(weights()).To(Equal(map[string]int32{resourceName: 100}))
+
+			By("Changing the image")
+			webapp := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			webapp.Spec.Image = "nginx:1.27.0"
+			Expect(k8sClient.Update(ctx, webapp)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(weights()).To(Equal(map[string]int32{resourceName: 100, resourceName + "-canary": 0}))
+
+			By("Marking the canary ready")
+			canary := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, canaryName, canary)).To(Succeed())
+			Expect(canary.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.27.0"))
+			canary.Status = appsv1.DeploymentStatus{
+				ObservedGeneration: canary.Generation,
+				Replicas:           1,
+				UpdatedReplicas:    1,
+				ReadyReplicas:      1,
+				AvailableReplicas:  1,
+			}
+			Expect(k8sClient.Status().Update(ctx, canary)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(weights()).To(Equal(map[string]int32{resourceName: 80, resourceName + "-canary": 20}))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			Expect(webapp.Status.Canary.Weight).To(Equal(int32(20)))
+			Expect(webapp.Status.CurrentImage).To(Equal("nginx:1.25.3"))
+
+			By("Aborting the canary")
+			webapp.Annotations = map[string]string{
+				kleffv1.CanaryActionAnnotation:   kleffv1.CanaryActionAbort,
+				kleffv1.CanaryActionIDAnnotation: "abort-1",
+			}
+			Expect(k8sClient.Update(ctx, webapp)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(weights()).To(Equal(map[string]int32{resourceName: 100}))
+			Expect(k8sClient.Get(ctx, canaryName, &appsv1.Deployment{})).NotTo(Succeed())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			Expect(webapp.Status.Canary.Aborted).To(BeTrue())
+			Expect(webapp.Status.Canary.LastAction).To(Equal("abort-1"))
+			Expect(webapp.Annotations).NotTo(HaveKey(kleffv1.CanaryActionAnnotation))
+			Expect(webapp.Annotations).NotTo(HaveKey(kleffv1.CanaryActionIDAnnotation))
+		})
+	})
+
+	Context("When a WebApp has volumes", func() {
+		const resourceName = "volume-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		claimName := types.NamespacedName{Name: resourceName + "-data", Namespace: "default"}
+
+		BeforeEach(func() {
+			replicas := int32(3)
+			size := resource.MustParse("1Gi")
+			resource := &kleffv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.WebAppSpec{
+					Image:    "nginx:1.25.3",
+					Port:     8080,
+					Replicas: &replicas,
+					Volumes: []kleffv1.Volume{{
+						Name:      "data",
+						MountPath: "/var/lib/app",
+						Size:      size,
+					}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			claim := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: claimName.Name, Namespace: claimName.Namespace}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, claim))).To(Succeed())
+		})
+
+		It("should mount a claim, run a single Recreate replica and keep the claim once removed", func() {
+			controllerReconciler := &WebAppReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			claim := &corev1.PersistentVolumeClaim{}
+			Expect(k8sClient.Get(ctx, claimName, claim)).To(Succeed())
+			Expect(claim.Spec.AccessModes).To(ConsistOf(corev1.ReadWriteOnce))
+			Expect(claim.Spec.Resources.Requests.Storage().String()).To(Equal("1Gi"))
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(1)))
+			Expect(deployment.Spec.Strategy.Type).To(Equal(appsv1.RecreateDeploymentStrategyType))
+			Expect(deployment.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal(claimName.Name))
+			Expect(deployment.Spec.Template.Spec.Containers[0].VolumeMounts[0].MountPath).To(Equal("/var/lib/app"))
+
+			By("Removing the volume")
+			webapp := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			webapp.Spec.Volumes = nil
+			Expect(k8sClient.Update(ctx, webapp)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, claimName, claim)).To(Succeed())
+			Expect(claim.DeletionTimestamp).To(BeNil())
+			Expect(claim.OwnerReferences).To(BeEmpty())
+			Expect(claim.Labels).To(HaveKeyWithValue(orphanedVolumeLabel, "true"))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(3)))
+			Expect(deployment.Spec.Strategy.Type).To(Equal(appsv1.RollingUpdateDeploymentStrategyType))
+		})
+	})
+
+	Context("When a WebApp is bound to a Database", func() {
+		const resourceName = "database-binding-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			resource := &kleffv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.WebAppSpec{
+					Image:     "nginx:1.25.3",
+					Port:      8080,
+					Databases: []kleffv1.DatabaseBinding{{Name: "binding-db"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			database := &kleffv1.Database{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "binding-db", Namespace: "default"}, database)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, database)).To(Succeed())
+		})
+
+		It("should inject the connection details once the Database exists", func() {
+			controllerReconciler := &WebAppReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			webapp := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			Expect(meta.FindStatusCondition(webapp.Status.Conditions, kleffv1.ConditionAvailable).Reason).To(Equal("DatabaseNotFound"))
+
+			By("Creating the Database")
+			size := resource.MustParse("1Gi")
+			Expect(k8sClient.Create(ctx, &kleffv1.Database{
+				ObjectMeta: metav1.ObjectMeta{Name: "binding-db", Namespace: "default"},
+				Spec:       kleffv1.DatabaseSpec{Engine: kleffv1.EngineRedis, Size: size},
+			})).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			env := deployment.Spec.Template.Spec.Containers[0].Env
+			Expect(env).To(ContainElement(corev1.EnvVar{
+				Name: "DATABASE_URL",
+				ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "binding-db-credentials"},
+					Key:                  "url",
+				}},
+			}))
+		})
+	})
+
+	Context("When a WebApp has extra ports", func() {
+		const resourceName = "ports-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		gameName := types.NamespacedName{Name: resourceName + "-port-game", Namespace: "default"}
+
+		BeforeEach(func() {
+			resource := &kleffv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.WebAppSpec{
+					Image: "nginx:1.25.3",
+					Port:  8080,
+					Ports: []kleffv1.AppPort{{
+						Name:     "game",
+						Port:     27015,
+						Protocol: kleffv1.ProtocolUDP,
+						Expose:   kleffv1.ExposeNodePort,
+					}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should expose them through their own Service and report the endpoint", func() {
+			controllerReconciler := &WebAppReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Ports).To(ContainElement(corev1.ContainerPort{
+				Name:          "game",
+				ContainerPort: 27015,
+				Protocol:      corev1.ProtocolUDP,
+			}))
+
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, gameName, service)).To(Succeed())
+			Expect(service.Spec.Type).To(Equal(corev1.ServiceTypeNodePort))
+			Expect(service.Spec.Selector).To(Equal(map[string]string{"app": resourceName}))
+			Expect(service.Spec.Ports[0].Protocol).To(Equal(corev1.ProtocolUDP))
+
+			webapp := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			Expect(webapp.Status.Endpoints).To(HaveLen(1))
+			Expect(webapp.Status.Endpoints[0].Port).To(Equal(service.Spec.Ports[0].NodePort))
+			Expect(webapp.Status.Endpoints[0].Ready).To(BeTrue())
+
+			By("Removing the port")
+			webapp.Spec.Ports = nil
+			Expect(k8sClient.Update(ctx, webapp)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = k8sClient.Get(ctx, gameName, service)
+			Expect(errors.IsNotFound(err) || service.DeletionTimestamp != nil).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			Expect(webapp.Status.Endpoints).To(BeEmpty())
+		})
+	})
+
+	Context("When a WebApp is deleted", func() {
+		const resourceName = "cleanup-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		jobName := types.NamespacedName{Name: "build-" + resourceName + "-2", Namespace: "default"}
+
+		var registry *httptest.Server
+		var mu sync.Mutex
+		var deleted []string
+
+		BeforeEach(func() {
+			deleted = nil
+			registry = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				reference := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+				switch req.Method {
+				case http.MethodHead:
+					// app:1 was pushed again as app:2
+					if reference == "1" {
+						reference = "2"
+					}
+					w.Header().Set("Docker-Content-Digest", "sha256:"+reference)
+				case http.MethodDelete:
+					mu.Lock()
+					deleted = append(deleted, reference)
+					mu.Unlock()
+					w.WriteHeader(http.StatusAccepted)
+				}
+			}))
+			host := strings.TrimPrefix(registry.URL, "https://")
+
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "cleanup-registry", Namespace: "default"},
+				Type:       corev1.SecretTypeDockerConfigJson,
+				Data: map[string][]byte{
+					corev1.DockerConfigJsonKey: []byte(`{"auths":{"` + host + `":{"username":"kleff","password":"secret"}}}`),
+				},
+			})).To(Succeed())
+
+			Expect(k8sClient.Create(ctx, &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      jobName.Name,
+					Namespace: "default",
+					Labels: map[string]string{
+						"managed-by": "paas-backend",
+						"project-id": "default",
+						"app":        resourceName,
+					},
+					Annotations: map[string]string{buildImageAnnotation: host + "/app:2"},
+				},
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							RestartPolicy: corev1.RestartPolicyNever,
+							Containers:    []corev1.Container{{Name: "kaniko", Image: "gcr.io/kaniko-project/executor:latest"}},
+						},
+					},
+				},
+			})).To(Succeed())
+
+			resource := &kleffv1.WebApp{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       resourceName,
+					Namespace:  "default",
+					Finalizers: []string{webAppFinalizer},
+				},
+				Spec: kleffv1.WebAppSpec{
+					Image: host + "/app:1",
+					Port:  8080,
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+			resource.Status.Revisions = []kleffv1.WebAppRevision{
+				{Revision: 1, Image: host + "/app:0", DeployedAt: metav1.Now()},
+				{Revision: 2, Image: host + "/app:1", DeployedAt: metav1.Now()},
+			}
+			Expect(k8sClient.Status().Update(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			registry.Close()
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "cleanup-registry", Namespace: "default"}, secret)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+		})
+
+		It("should delete the builds and the images beyond the retained ones", func() {
+			controllerReconciler := &WebAppReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+				Cleanup: &CleanupConfig{
+					BuildNamespace: "default",
+					RegistrySecret: "cleanup-registry",
+					RetainedImages: 1,
+				},
+				HTTPClient: registry.Client(),
+			}
+
+			webapp := &kleffv1.WebApp{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, webapp)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, webapp)).To(Succeed())
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			job := &batchv1.Job{}
+			err = k8sClient.Get(ctx, jobName, job)
+			Expect(errors.IsNotFound(err) || job.DeletionTimestamp != nil).To(BeTrue())
+
+			// app:2 is the most recent image, kept by the retention along
+			// with app:1, which shares its manifest
+			Expect(deleted).To(ConsistOf("sha256:0"))
+
+			err = k8sClient.Get(ctx, typeNamespacedName, webapp)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+	})
 })
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+const defaultDatabaseEnvPrefix = "DATABASE"
+
+// databaseEnvKeys maps the variable suffixes to the keys of a Database Secret
+var databaseEnvKeys = []struct{ suffix, key string }{
+	{"_URL", "url"},
+	{"_HOST", "host"},
+	{"_PORT", "port"},
+	{"_USER", "username"},
+	{"_PASSWORD", "password"},
+	{"_NAME", "database"},
+}
+
+// databaseEnvVars reference the connection details of the bound Databases
+func databaseEnvVars(bindings []kleffv1.DatabaseBinding) []corev1.EnvVar {
+	var envVars []corev1.EnvVar
+	for _, binding := range bindings {
+		prefix := binding.EnvPrefix
+		if prefix == "" {
+			prefix = defaultDatabaseEnvPrefix
+		}
+		for _, env := range databaseEnvKeys {
+			envVars = append(envVars, corev1.EnvVar{
+				Name: prefix + env.suffix,
+				ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: databaseSecretName(binding.Name)},
+					Key:                  env.key,
+				}},
+			})
+		}
+	}
+	return envVars
+}
+
+// missingDatabase returns the first bound Database that does not exist
+func missingDatabase(ctx context.Context, c client.Reader, namespace string, bindings []kleffv1.DatabaseBinding) (string, error) {
+	for _, binding := range bindings {
+		err := c.Get(ctx, types.NamespacedName{Name: binding.Name, Namespace: namespace}, &kleffv1.Database{})
+		if k8serrors.IsNotFound(err) {
+			return binding.Name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// webAppsForDatabase requeues the WebApps bound to a Database
+func (r *WebAppReconciler) webAppsForDatabase(ctx context.Context, obj client.Object) []reconcile.Request {
+	webapps := &kleffv1.WebAppList{}
+	if err := r.List(ctx, webapps, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, webapp := range webapps.Items {
+		for _, binding := range webapp.Spec.Databases {
+			if binding.Name == obj.GetName() {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Name: webapp.Name, Namespace: webapp.Namespace},
+				})
+				break
+			}
+		}
+	}
+	return requests
+}
@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+// templateHashAnnotation fingerprints the pod template a Deployment was last
+// synced with, so strategies can tell which version a Deployment runs
+const templateHashAnnotation = "kleff.io/template-hash"
+
+// podTemplate is the desired pod template of the WebApp. The "app" label is
+// set per Deployment by syncDeployment.
+func (r *WebAppReconciler) podTemplate(webapp *kleffv1.WebApp, labels map[string]string, platform kleffv1.PlatformSettings, resources corev1.ResourceRequirements, secretEnvHash string) corev1.PodTemplateSpec {
+	template := corev1.PodTemplateSpec{}
+
+	template.Labels = make(map[string]string, len(labels)+2)
+	for k, v := range labels {
+		template.Labels[k] = v
+	}
+	// Pods of every Deployment of the app share this label
+	template.Labels["webapp"] = webapp.Name
+	// Lets billing meter pods by plan
+	if webapp.Spec.Resources == nil {
+		template.Labels["plan"] = r.planName(webapp)
+	} else {
+		template.Labels["plan"] = "custom"
+	}
+
+	// Secret values are only referenced, so roll the pods when they change
+	if secretEnvHash != "" {
+		template.Annotations = map[string]string{secretEnvHashAnnotation: secretEnvHash}
+	}
+
+	if platform.ImagePullSecret != "" {
+		template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{
+			{Name: platform.ImagePullSecret},
+		}
+	}
+
+	// Environment Variables, sorted as any change to the template rolls the pods
+	keys := make([]string, 0, len(webapp.Spec.EnvVariables))
+	for key := range webapp.Spec.EnvVariables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var envVars []corev1.EnvVar
+	for _, key := range keys {
+		envVars = append(envVars, corev1.EnvVar{Name: key, Value: webapp.Spec.EnvVariables[key]})
+	}
+	envVars = append(envVars, secretEnvVars(webapp.Name, webapp.Spec.SecretEnv)...)
+	envVars = append(envVars, databaseEnvVars(webapp.Spec.Databases)...)
+
+	volumes, mounts := podVolumes(webapp)
+	template.Spec.Volumes = volumes
+
+	readiness, liveness, startup := containerProbes(webapp)
+	template.Spec.Containers = []corev1.Container{{
+		Name:            "app",
+		Image:           webapp.Spec.Image,
+		ImagePullPolicy: corev1.PullAlways,
+		Env:             envVars,
+		Resources:       resources,
+		Ports:           containerPorts(webapp),
+		VolumeMounts:    mounts,
+		ReadinessProbe:  readiness,
+		LivenessProbe:   liveness,
+		StartupProbe:    startup,
+	}}
+	return template
+}
+
+// templateHash fingerprints a pod template built by podTemplate
+func templateHash(template corev1.PodTemplateSpec) string {
+	data, _ := json.Marshal(template)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// syncDeployment creates or updates the Deployment name of the WebApp with
+// the given template. A nil replicas keeps the count of the WebApp's
+// scaling settings, leaving it to the HPA while autoscaling is on.
+func (r *WebAppReconciler) syncDeployment(ctx context.Context, webapp *kleffv1.WebApp, name string, labels map[string]string, template corev1.PodTemplateSpec, replicas *int32) (*appsv1.Deployment, error) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: webapp.Namespace,
+		},
+	}
+
+	hash := templateHash(template)
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, deployment, func() error {
+		deployment.Labels = labels
+		if deployment.Annotations == nil {
+			deployment.Annotations = make(map[string]string)
+		}
+		deployment.Annotations[templateHashAnnotation] = hash
+
+		// Selector is immutable after creation, so we set it only if new
+		if deployment.CreationTimestamp.IsZero() {
+			deployment.Spec.Selector = &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": name},
+			}
+		}
+
+		// The HPA owns the replica count while autoscaling is on
+		switch {
+		case replicas != nil:
+			deployment.Spec.Replicas = replicas
+		case !autoscalingEnabled(webapp):
+			desired := desiredReplicas(webapp)
+			deployment.Spec.Replicas = &desired
+		case deployment.Spec.Replicas == nil:
+			lowerBound := minReplicas(webapp)
+			deployment.Spec.Replicas = &lowerBound
+		}
+
+		deployment.Spec.Strategy = deploymentStrategy(webapp)
+
+		// Merged rather than replaced, so annotations such as the one of
+		// kubectl rollout restart survive
+		podTemplate := &deployment.Spec.Template
+		if podTemplate.Labels == nil {
+			podTemplate.Labels = make(map[string]string)
+		}
+		for k, v := range template.Labels {
+			podTemplate.Labels[k] = v
+		}
+		podTemplate.Labels["app"] = name
+		if secretHash, ok := template.Annotations[secretEnvHashAnnotation]; ok {
+			if podTemplate.Annotations == nil {
+				podTemplate.Annotations = make(map[string]string)
+			}
+			podTemplate.Annotations[secretEnvHashAnnotation] = secretHash
+		} else {
+			delete(podTemplate.Annotations, secretEnvHashAnnotation)
+		}
+		podTemplate.Spec.ImagePullSecrets = template.Spec.ImagePullSecrets
+		podTemplate.Spec.Volumes = template.Spec.Volumes
+		podTemplate.Spec.Containers = template.Spec.Containers
+
+		return controllerutil.SetControllerReference(webapp, deployment, r.Scheme)
+	})
+	return deployment, err
+}
+
+// deploymentStrategy maps the rolling parameters of the WebApp. The defaults
+// of Kubernetes are spelled out so the Deployment does not drift from them.
+// A pod holding a ReadWriteOnce volume has to stop before its replacement
+// can attach it, hence Recreate.
+func deploymentStrategy(webapp *kleffv1.WebApp) appsv1.DeploymentStrategy {
+	if exclusiveVolumes(webapp) {
+		return appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+	}
+
+	maxSurge := intstr.FromString("25%")
+	maxUnavailable := intstr.FromString("25%")
+	if webapp.Spec.Strategy != nil && webapp.Spec.Strategy.RollingUpdate != nil {
+		if webapp.Spec.Strategy.RollingUpdate.MaxSurge != nil {
+			maxSurge = *webapp.Spec.Strategy.RollingUpdate.MaxSurge
+		}
+		if webapp.Spec.Strategy.RollingUpdate.MaxUnavailable != nil {
+			maxUnavailable = *webapp.Spec.Strategy.RollingUpdate.MaxUnavailable
+		}
+	}
+	return appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxSurge:       &maxSurge,
+			MaxUnavailable: &maxUnavailable,
+		},
+	}
+}
+
+// deploymentReady reports whether every pod of the Deployment runs its
+// current template and is available
+func deploymentReady(deployment *appsv1.Deployment) bool {
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	progressing, _, _ := rolloutProgress(deployment, desired)
+	return !progressing && deployment.Status.ReadyReplicas >= desired
+}
+
+// syncService creates or updates the Service name in front of the Deployment
+// of the same name
+func (r *WebAppReconciler) syncService(ctx context.Context, webapp *kleffv1.WebApp, name string, labels map[string]string) error {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: webapp.Namespace,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, service, func() error {
+		service.Labels = labels
+		service.Spec.Selector = map[string]string{"app": name}
+		service.Spec.Type = corev1.ServiceTypeClusterIP
+		service.Spec.Ports = servicePorts(webapp)
+		return controllerutil.SetControllerReference(webapp, service, r.Scheme)
+	})
+	return err
+}
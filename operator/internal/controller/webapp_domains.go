@@ -0,0 +1,406 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+const (
+	// domainVerificationPrefix is prepended to a custom domain to name its TXT record
+	domainVerificationPrefix = "_kleff-verification."
+	// domainRecheckInterval paces the checks of pending domains and certificates
+	domainRecheckInterval = time.Minute
+	// maxGatewayListeners is the most listeners the Gateway API admits on a Gateway
+	maxGatewayListeners = 64
+	// maxProjectDomainListeners caps the listeners the custom domains of a
+	// project hold on the shared Gateway, so one project cannot use them all
+	maxProjectDomainListeners = 8
+)
+
+var certificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+// verificationToken is the value the TXT record of a domain must hold. It is
+// derived from the WebApp's UID so another app cannot claim the same domain.
+func verificationToken(webapp *kleffv1.WebApp, domain string) string {
+	sum := sha256.Sum256([]byte(string(webapp.UID) + "/" + domain))
+	return "kleff-verification=" + hex.EncodeToString(sum[:16])
+}
+
+// domainCertificateName names the Certificate of a custom domain
+func domainCertificateName(webapp *kleffv1.WebApp, domain string) string {
+	sum := sha256.Sum256([]byte(domain))
+	return fmt.Sprintf("%s-domain-%s", webapp.Name, hex.EncodeToString(sum[:4]))
+}
+
+// domainSecretName is the Secret cert-manager issues the certificate of a
+// custom domain into
+func domainSecretName(webapp *kleffv1.WebApp, domain string) string {
+	return domainCertificateName(webapp, domain) + "-tls"
+}
+
+// domainListenerPrefix starts the names of the Gateway listeners of the
+// WebApp, which share the Gateway with every other app
+func domainListenerPrefix(webapp *kleffv1.WebApp) string {
+	sum := sha256.Sum256([]byte(webapp.Namespace + "/" + webapp.Name))
+	return "domain-" + hex.EncodeToString(sum[:4]) + "-"
+}
+
+// domainListenerName names the HTTPS listener of a custom domain
+func domainListenerName(webapp *kleffv1.WebApp, domain string) gatewayv1.SectionName {
+	sum := sha256.Sum256([]byte(domain))
+	return gatewayv1.SectionName(domainListenerPrefix(webapp) + hex.EncodeToString(sum[:4]))
+}
+
+// lookupTXT resolves TXT records, through r.LookupTXT when set
+func (r *WebAppReconciler) lookupTXT(ctx context.Context, name string) ([]string, error) {
+	if r.LookupTXT != nil {
+		return r.LookupTXT(ctx, name)
+	}
+	return net.DefaultResolver.LookupTXT(ctx, name)
+}
+
+// reconcileDomainVerification checks the TXT record of every custom domain not
+// verified yet and records the outcome in the status. Verification is kept
+// once it succeeded. It returns the verified domains and whether some are
+// still pending.
+func (r *WebAppReconciler) reconcileDomainVerification(ctx context.Context, webapp *kleffv1.WebApp) ([]string, bool) {
+	previous := make(map[string]kleffv1.DomainStatus, len(webapp.Status.Domains))
+	for _, domain := range webapp.Status.Domains {
+		previous[domain.Domain] = domain
+	}
+
+	var verified []string
+	pending := false
+	statuses := make([]kleffv1.DomainStatus, 0, len(webapp.Spec.CustomDomains))
+	for _, domain := range webapp.Spec.CustomDomains {
+		domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+		status := kleffv1.DomainStatus{
+			Domain:             domain,
+			VerificationRecord: domainVerificationPrefix + domain,
+			VerificationToken:  verificationToken(webapp, domain),
+		}
+		if prev, ok := previous[domain]; ok && prev.Verified {
+			status = prev
+		} else {
+			records, err := r.lookupTXT(ctx, status.VerificationRecord)
+			switch {
+			case err != nil:
+				status.Message = fmt.Sprintf("Waiting for TXT record %s", status.VerificationRecord)
+			case containsString(records, status.VerificationToken):
+				now := metav1.Now()
+				status.Verified = true
+				status.VerifiedAt = &now
+				status.Message = ""
+			default:
+				status.Message = fmt.Sprintf("TXT record %s does not hold the verification token", status.VerificationRecord)
+			}
+		}
+
+		if status.Verified {
+			verified = append(verified, domain)
+		} else {
+			pending = true
+		}
+		statuses = append(statuses, status)
+	}
+
+	webapp.Status.Domains = statuses
+	return verified, pending
+}
+
+// reconcileDomainCertificates requests a cert-manager Certificate from
+// clusterIssuer for each verified domain, removes those of dropped domains
+// and reports whether each certificate is ready. It returns whether some are
+// still being issued.
+func (r *WebAppReconciler) reconcileDomainCertificates(ctx context.Context, webapp *kleffv1.WebApp, labels map[string]string, clusterIssuer string) (bool, error) {
+	desired := make(map[string]bool)
+	pending := false
+
+	for i := range webapp.Status.Domains {
+		status := &webapp.Status.Domains[i]
+		if !status.Verified {
+			continue
+		}
+
+		cert := &unstructured.Unstructured{}
+		cert.SetGroupVersionKind(certificateGVK)
+		cert.SetName(domainCertificateName(webapp, status.Domain))
+		cert.SetNamespace(webapp.Namespace)
+		desired[cert.GetName()] = true
+
+		_, err := controllerutil.CreateOrUpdate(ctx, r.Client, cert, func() error {
+			cert.SetLabels(labels)
+			spec := map[string]interface{}{
+				"secretName": domainSecretName(webapp, status.Domain),
+				"dnsNames":   []interface{}{status.Domain},
+				"issuerRef": map[string]interface{}{
+					"name": clusterIssuer,
+					"kind": "ClusterIssuer",
+				},
+			}
+			if err := unstructured.SetNestedMap(cert.Object, spec, "spec"); err != nil {
+				return err
+			}
+			return controllerutil.SetControllerReference(webapp, cert, r.Scheme)
+		})
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				status.Message = "cert-manager is not installed"
+				continue
+			}
+			return false, err
+		}
+
+		status.CertificateReady = certificateReady(cert)
+		if status.CertificateReady {
+			status.Message = ""
+		} else {
+			status.Message = "Waiting for the certificate to be issued"
+			pending = true
+		}
+	}
+
+	// Drop the certificates of domains that were removed
+	existing := &unstructured.UnstructuredList{}
+	existing.SetGroupVersionKind(certificateGVK.GroupVersion().WithKind("CertificateList"))
+	if err := r.List(ctx, existing, client.InNamespace(webapp.Namespace), client.MatchingLabels{"app": webapp.Name}); err != nil {
+		if meta.IsNoMatchError(err) {
+			return pending, nil
+		}
+		return pending, err
+	}
+	for i := range existing.Items {
+		if !desired[existing.Items[i].GetName()] && metav1.IsControlledBy(&existing.Items[i], webapp) {
+			if err := r.Delete(ctx, &existing.Items[i]); client.IgnoreNotFound(err) != nil {
+				return pending, err
+			}
+		}
+	}
+	return pending, nil
+}
+
+// reconcileDomainListeners serves every custom domain whose certificate is
+// issued on an HTTPS listener of the platform Gateway, terminating TLS with
+// the certificate Secret. A ReferenceGrant lets the Gateway read the Secret
+// from the namespace of the app, and only routes of that namespace attach to
+// the listener. Listeners of dropped domains are removed. A domain that
+// cannot get a listener, or a Gateway that cannot be updated, is reported in
+// the status of the domains concerned rather than failing the app. It
+// returns whether some domains should be retried.
+func (r *WebAppReconciler) reconcileDomainListeners(ctx context.Context, webapp *kleffv1.WebApp, labels map[string]string, platform kleffv1.PlatformSettings) (bool, error) {
+	var domains []string
+	desiredGrants := make(map[string]bool)
+	for i := range webapp.Status.Domains {
+		status := &webapp.Status.Domains[i]
+		if !status.Verified || !status.CertificateReady {
+			continue
+		}
+
+		grant := &gatewayv1beta1.ReferenceGrant{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      domainCertificateName(webapp, status.Domain),
+				Namespace: webapp.Namespace,
+			},
+		}
+		secretName := gatewayv1.ObjectName(domainSecretName(webapp, status.Domain))
+		_, err := controllerutil.CreateOrUpdate(ctx, r.Client, grant, func() error {
+			grant.Labels = labels
+			grant.Spec.From = []gatewayv1beta1.ReferenceGrantFrom{{
+				Group:     gatewayv1.GroupName,
+				Kind:      "Gateway",
+				Namespace: gatewayv1.Namespace(platform.GatewayNamespace),
+			}}
+			grant.Spec.To = []gatewayv1beta1.ReferenceGrantTo{{
+				Group: "",
+				Kind:  "Secret",
+				Name:  &secretName,
+			}}
+			return controllerutil.SetControllerReference(webapp, grant, r.Scheme)
+		})
+		if err != nil {
+			return false, err
+		}
+		desiredGrants[grant.Name] = true
+		domains = append(domains, status.Domain)
+	}
+
+	pending := false
+	refused, err := r.syncDomainListeners(ctx, webapp, domains, platform)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update the domain listeners of the Gateway")
+		refused = make(map[string]string, len(domains))
+		for _, domain := range domains {
+			refused[domain] = fmt.Sprintf("The Gateway could not be updated: %v", err)
+		}
+		pending = true
+	}
+	for i := range webapp.Status.Domains {
+		status := &webapp.Status.Domains[i]
+		if msg, ok := refused[status.Domain]; ok {
+			status.Message = msg
+		}
+	}
+
+	grants := &gatewayv1beta1.ReferenceGrantList{}
+	if err := r.List(ctx, grants, client.InNamespace(webapp.Namespace), client.MatchingLabels{"app": webapp.Name}); err != nil {
+		if meta.IsNoMatchError(err) && len(desiredGrants) == 0 {
+			return pending, nil
+		}
+		return pending, err
+	}
+	for i := range grants.Items {
+		if !desiredGrants[grants.Items[i].Name] && metav1.IsControlledBy(&grants.Items[i], webapp) {
+			if err := r.Delete(ctx, &grants.Items[i]); client.IgnoreNotFound(err) != nil {
+				return pending, err
+			}
+		}
+	}
+	return pending, nil
+}
+
+// syncDomainListeners sets the HTTPS listeners of the WebApp on the platform
+// Gateway to those of domains, leaving the listeners of other apps alone. A
+// domain gets no listener when another listener already serves it, when the
+// project holds maxProjectDomainListeners already, or when the Gateway is
+// full. It returns those domains with the reason they were refused.
+func (r *WebAppReconciler) syncDomainListeners(ctx context.Context, webapp *kleffv1.WebApp, domains []string, platform kleffv1.PlatformSettings) (map[string]string, error) {
+	gateway := &gatewayv1.Gateway{}
+	err := r.Get(ctx, types.NamespacedName{Name: platform.GatewayName, Namespace: platform.GatewayNamespace}, gateway)
+	if err != nil {
+		if len(domains) == 0 && (k8serrors.IsNotFound(err) || meta.IsNoMatchError(err)) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("gateway %s/%s: %w", platform.GatewayNamespace, platform.GatewayName, err)
+	}
+
+	prefix := domainListenerPrefix(webapp)
+	listeners := make([]gatewayv1.Listener, 0, len(gateway.Spec.Listeners)+len(domains))
+	taken := make(map[gatewayv1.Hostname]bool)
+	project := 0
+	for _, listener := range gateway.Spec.Listeners {
+		if strings.HasPrefix(string(listener.Name), prefix) {
+			continue
+		}
+		if listener.Hostname != nil {
+			taken[*listener.Hostname] = true
+		}
+		if isProjectDomainListener(listener, webapp.Namespace) {
+			project++
+		}
+		listeners = append(listeners, listener)
+	}
+
+	refused := make(map[string]string)
+	for _, domain := range domains {
+		switch {
+		case taken[gatewayv1.Hostname(domain)]:
+			refused[domain] = "The domain is served by another app"
+		case project >= maxProjectDomainListeners:
+			refused[domain] = fmt.Sprintf("The project already serves %d custom domains, the most it may", maxProjectDomainListeners)
+		case len(listeners) >= maxGatewayListeners:
+			refused[domain] = "The Gateway has no room left for another custom domain"
+		default:
+			listeners = append(listeners, domainListener(webapp, domain))
+			project++
+		}
+	}
+
+	if !equality.Semantic.DeepEqual(listeners, gateway.Spec.Listeners) {
+		gateway.Spec.Listeners = listeners
+		if err := r.Update(ctx, gateway); err != nil {
+			return nil, err
+		}
+	}
+	return refused, nil
+}
+
+// isProjectDomainListener tells whether listener serves a custom domain of an
+// app in namespace
+func isProjectDomainListener(listener gatewayv1.Listener, namespace string) bool {
+	if !strings.HasPrefix(string(listener.Name), "domain-") || listener.TLS == nil {
+		return false
+	}
+	for _, ref := range listener.TLS.CertificateRefs {
+		if ref.Namespace != nil && string(*ref.Namespace) == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// domainListener is the HTTPS listener of a custom domain
+func domainListener(webapp *kleffv1.WebApp, domain string) gatewayv1.Listener {
+	hostname := gatewayv1.Hostname(domain)
+	mode := gatewayv1.TLSModeTerminate
+	// Spelled out as the API server defaults them, so the listener compares
+	// equal once stored
+	secretGroup := gatewayv1.Group("")
+	secretKind := gatewayv1.Kind("Secret")
+	secretNamespace := gatewayv1.Namespace(webapp.Namespace)
+	from := gatewayv1.NamespacesFromSelector
+	return gatewayv1.Listener{
+		Name:     domainListenerName(webapp, domain),
+		Hostname: &hostname,
+		Port:     443,
+		Protocol: gatewayv1.HTTPSProtocolType,
+		TLS: &gatewayv1.GatewayTLSConfig{
+			Mode: &mode,
+			CertificateRefs: []gatewayv1.SecretObjectReference{{
+				Group:     &secretGroup,
+				Kind:      &secretKind,
+				Name:      gatewayv1.ObjectName(domainSecretName(webapp, domain)),
+				Namespace: &secretNamespace,
+			}},
+		},
+		AllowedRoutes: &gatewayv1.AllowedRoutes{
+			Namespaces: &gatewayv1.RouteNamespaces{
+				From: &from,
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{corev1.LabelMetadataName: webapp.Namespace},
+				},
+			},
+		},
+	}
+}
+
+// certificateReady reads the Ready condition of a cert-manager Certificate
+func certificateReady(cert *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(cert.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Ready" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, want string) bool {
+	for _, v := range values {
+		if strings.TrimSpace(v) == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,480 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+// endpointRecheckInterval paces the checks of endpoints waiting for an
+// address. Gateways and the experimental TCP and UDP routes are not watched.
+const endpointRecheckInterval = 30 * time.Second
+
+func portProtocol(port kleffv1.AppPort) kleffv1.PortProtocol {
+	if port.Protocol == "" {
+		return kleffv1.ProtocolTCP
+	}
+	return port.Protocol
+}
+
+func portExposure(port kleffv1.AppPort) kleffv1.PortExposure {
+	if port.Expose == "" {
+		return kleffv1.ExposeGateway
+	}
+	return port.Expose
+}
+
+// transportProtocol is the protocol Kubernetes carries a port over
+func transportProtocol(port kleffv1.AppPort) corev1.Protocol {
+	if portProtocol(port) == kleffv1.ProtocolUDP {
+		return corev1.ProtocolUDP
+	}
+	return corev1.ProtocolTCP
+}
+
+// portObjectName names the Service or route of an extra port. The port
+// segment keeps it apart from the Services of the deployment slots and the
+// canary, <app>-green and <app>-canary.
+func portObjectName(webapp *kleffv1.WebApp, port kleffv1.AppPort) string {
+	return webapp.Name + "-port-" + port.Name
+}
+
+// grpcHostname is where a GRPC port is routed, next to the app subdomain
+func grpcHostname(webapp *kleffv1.WebApp, port kleffv1.AppPort, baseDomain string) string {
+	return fmt.Sprintf("%s-%s.%s", port.Name, webapp.Name, baseDomain)
+}
+
+// servicePorts are the ports of the Services selecting the app pods: the
+// HTTP one and every extra port
+func servicePorts(webapp *kleffv1.WebApp) []corev1.ServicePort {
+	ports := []corev1.ServicePort{{
+		Name:       "http",
+		Port:       80,
+		TargetPort: intstr.FromInt(webapp.Spec.Port),
+		Protocol:   corev1.ProtocolTCP,
+	}}
+	for _, port := range webapp.Spec.Ports {
+		ports = append(ports, servicePort(port))
+	}
+	return ports
+}
+
+func servicePort(port kleffv1.AppPort) corev1.ServicePort {
+	servicePort := corev1.ServicePort{
+		Name:       port.Name,
+		Port:       port.Port,
+		TargetPort: intstr.FromInt32(port.Port),
+		Protocol:   transportProtocol(port),
+	}
+	// Lets the Gateway speak HTTP/2 to the pods
+	if portProtocol(port) == kleffv1.ProtocolGRPC {
+		h2c := "kubernetes.io/h2c"
+		servicePort.AppProtocol = &h2c
+	}
+	return servicePort
+}
+
+// containerPorts are the ports the app container declares
+func containerPorts(webapp *kleffv1.WebApp) []corev1.ContainerPort {
+	ports := []corev1.ContainerPort{{
+		Name:          "http",
+		ContainerPort: int32(webapp.Spec.Port),
+		Protocol:      corev1.ProtocolTCP,
+	}}
+	for _, port := range webapp.Spec.Ports {
+		ports = append(ports, corev1.ContainerPort{
+			Name:          port.Name,
+			ContainerPort: port.Port,
+			Protocol:      transportProtocol(port),
+		})
+	}
+	return ports
+}
+
+// reconcilePorts exposes the extra ports of the WebApp, sending their
+// traffic to the active Service, and returns where they are reachable.
+// Objects of ports that were removed or exposed another way are deleted.
+func (r *WebAppReconciler) reconcilePorts(ctx context.Context, webapp *kleffv1.WebApp, activeService string, labels map[string]string, platform kleffv1.PlatformSettings) ([]kleffv1.EndpointStatus, error) {
+	wanted := make(map[string]kleffv1.PortExposure, len(webapp.Spec.Ports))
+	endpoints := make([]kleffv1.EndpointStatus, 0, len(webapp.Spec.Ports))
+
+	for _, port := range webapp.Spec.Ports {
+		portLabels := make(map[string]string, len(labels)+2)
+		for k, v := range labels {
+			portLabels[k] = v
+		}
+		portLabels["webapp"] = webapp.Name
+		portLabels["port"] = port.Name
+
+		var endpoint kleffv1.EndpointStatus
+		var err error
+		exposure := portExposure(port)
+		switch {
+		case exposure != kleffv1.ExposeGateway:
+			endpoint, err = r.syncPortService(ctx, webapp, port, activeService, portLabels)
+		case portProtocol(port) == kleffv1.ProtocolGRPC:
+			endpoint, err = r.syncGRPCRoute(ctx, webapp, port, activeService, portLabels, platform)
+		default:
+			endpoint, err = r.syncL4Route(ctx, webapp, port, activeService, portLabels, platform)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("port %s: %w", port.Name, err)
+		}
+		endpoint.Name = port.Name
+		endpoint.Protocol = portProtocol(port)
+		endpoints = append(endpoints, endpoint)
+		wanted[port.Name] = exposure
+	}
+
+	if err := r.deleteStalePortObjects(ctx, webapp, wanted); err != nil {
+		return nil, err
+	}
+	if len(endpoints) == 0 {
+		return nil, nil
+	}
+	return endpoints, nil
+}
+
+// syncPortService gives the port a LoadBalancer or NodePort Service
+func (r *WebAppReconciler) syncPortService(ctx context.Context, webapp *kleffv1.WebApp, port kleffv1.AppPort, activeService string, labels map[string]string) (kleffv1.EndpointStatus, error) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      portObjectName(webapp, port),
+			Namespace: webapp.Namespace,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, service, func() error {
+		service.Labels = labels
+		service.Spec.Selector = map[string]string{"app": activeService}
+		desired := servicePort(port)
+		// The allocated node port is kept, a new one would break clients
+		if len(service.Spec.Ports) == 1 {
+			desired.NodePort = service.Spec.Ports[0].NodePort
+		}
+		if portExposure(port) == kleffv1.ExposeNodePort {
+			service.Spec.Type = corev1.ServiceTypeNodePort
+		} else {
+			service.Spec.Type = corev1.ServiceTypeLoadBalancer
+		}
+		service.Spec.Ports = []corev1.ServicePort{desired}
+		return controllerutil.SetControllerReference(webapp, service, r.Scheme)
+	})
+	if err != nil {
+		return kleffv1.EndpointStatus{}, err
+	}
+
+	if service.Spec.Type == corev1.ServiceTypeNodePort {
+		nodePort := service.Spec.Ports[0].NodePort
+		if nodePort == 0 {
+			return kleffv1.EndpointStatus{Message: "Waiting for a node port"}, nil
+		}
+		return kleffv1.EndpointStatus{Port: nodePort, Ready: true}, nil
+	}
+
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		host := ingress.IP
+		if ingress.Hostname != "" {
+			host = ingress.Hostname
+		}
+		if host != "" {
+			return kleffv1.EndpointStatus{Host: host, Port: port.Port, Ready: true}, nil
+		}
+	}
+	return kleffv1.EndpointStatus{Port: port.Port, Message: "Waiting for a load balancer address"}, nil
+}
+
+// syncGRPCRoute routes a GRPC port through the Gateway at its own hostname
+func (r *WebAppReconciler) syncGRPCRoute(ctx context.Context, webapp *kleffv1.WebApp, port kleffv1.AppPort, activeService string, labels map[string]string, platform kleffv1.PlatformSettings) (kleffv1.EndpointStatus, error) {
+	hostname := grpcHostname(webapp, port, platform.BaseDomain)
+	route := &gatewayv1.GRPCRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      portObjectName(webapp, port),
+			Namespace: webapp.Namespace,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, route, func() error {
+		route.Labels = labels
+		route.Annotations = routeAnnotations(route.Annotations, platform)
+		route.Spec.ParentRefs = []gatewayv1.ParentReference{platformGateway(platform, nil)}
+		route.Spec.Hostnames = []gatewayv1.Hostname{gatewayv1.Hostname(hostname)}
+		route.Spec.Rules = []gatewayv1.GRPCRouteRule{{
+			BackendRefs: []gatewayv1.GRPCBackendRef{{
+				BackendRef: portBackendRef(activeService, port),
+			}},
+		}}
+		return controllerutil.SetControllerReference(webapp, route, r.Scheme)
+	})
+	if err != nil {
+		return kleffv1.EndpointStatus{}, err
+	}
+
+	endpoint := kleffv1.EndpointStatus{Host: hostname, Port: 443}
+	if routeAccepted(route.Status.Parents, route.Generation) {
+		endpoint.Ready = true
+	} else {
+		endpoint.Message = "Waiting for the Gateway to accept the route"
+	}
+	return endpoint, nil
+}
+
+// syncL4Route attaches a TCP or UDP port to its listener of the Gateway
+// through a TCPRoute or UDPRoute. A listener serves a single port of a single
+// app: one another route already holds is refused.
+func (r *WebAppReconciler) syncL4Route(ctx context.Context, webapp *kleffv1.WebApp, port kleffv1.AppPort, activeService string, labels map[string]string, platform kleffv1.PlatformSettings) (kleffv1.EndpointStatus, error) {
+	listener := gatewayv1.SectionName(port.Listener)
+	parentRefs := []gatewayv1.ParentReference{platformGateway(platform, &listener)}
+	backendRefs := []gatewayv1.BackendRef{portBackendRef(activeService, port)}
+	objectMeta := metav1.ObjectMeta{Name: portObjectName(webapp, port), Namespace: webapp.Namespace}
+
+	holder, err := r.listenerHolder(ctx, objectMeta, listener, platform)
+	if err != nil {
+		return kleffv1.EndpointStatus{}, err
+	}
+	if holder != "" {
+		// Detach the port in case it held the listener before
+		var route client.Object = &gatewayv1alpha2.TCPRoute{ObjectMeta: objectMeta}
+		if portProtocol(port) == kleffv1.ProtocolUDP {
+			route = &gatewayv1alpha2.UDPRoute{ObjectMeta: objectMeta}
+		}
+		if err := r.Delete(ctx, route); client.IgnoreNotFound(err) != nil {
+			return kleffv1.EndpointStatus{}, err
+		}
+		return kleffv1.EndpointStatus{Message: fmt.Sprintf("The listener %s is used by %s", port.Listener, holder)}, nil
+	}
+
+	var parents []gatewayv1.RouteParentStatus
+	var generation int64
+	if portProtocol(port) == kleffv1.ProtocolUDP {
+		route := &gatewayv1alpha2.UDPRoute{ObjectMeta: objectMeta}
+		_, err = controllerutil.CreateOrUpdate(ctx, r.Client, route, func() error {
+			route.Labels = labels
+			route.Spec.ParentRefs = parentRefs
+			route.Spec.Rules = []gatewayv1alpha2.UDPRouteRule{{BackendRefs: backendRefs}}
+			return controllerutil.SetControllerReference(webapp, route, r.Scheme)
+		})
+		parents, generation = route.Status.Parents, route.Generation
+	} else {
+		route := &gatewayv1alpha2.TCPRoute{ObjectMeta: objectMeta}
+		_, err = controllerutil.CreateOrUpdate(ctx, r.Client, route, func() error {
+			route.Labels = labels
+			route.Spec.ParentRefs = parentRefs
+			route.Spec.Rules = []gatewayv1alpha2.TCPRouteRule{{BackendRefs: backendRefs}}
+			return controllerutil.SetControllerReference(webapp, route, r.Scheme)
+		})
+		parents, generation = route.Status.Parents, route.Generation
+	}
+	if err != nil {
+		return kleffv1.EndpointStatus{}, err
+	}
+
+	gateway := &gatewayv1.Gateway{}
+	if err := r.Get(ctx, types.NamespacedName{Name: platform.GatewayName, Namespace: platform.GatewayNamespace}, gateway); err != nil {
+		return kleffv1.EndpointStatus{}, fmt.Errorf("gateway %s/%s: %w", platform.GatewayNamespace, platform.GatewayName, err)
+	}
+	endpoint := kleffv1.EndpointStatus{Host: platform.DNSTarget}
+	if len(gateway.Status.Addresses) > 0 {
+		endpoint.Host = gateway.Status.Addresses[0].Value
+	}
+	for _, l := range gateway.Spec.Listeners {
+		if l.Name == listener {
+			endpoint.Port = int32(l.Port)
+		}
+	}
+
+	switch {
+	case endpoint.Port == 0:
+		endpoint.Message = fmt.Sprintf("The Gateway has no listener %s", port.Listener)
+	case !routeAccepted(parents, generation):
+		endpoint.Message = "Waiting for the Gateway to accept the route"
+	case endpoint.Host == "":
+		endpoint.Message = "Waiting for a Gateway address"
+	default:
+		endpoint.Ready = true
+	}
+	return endpoint, nil
+}
+
+// listenerHolder returns the TCPRoute or UDPRoute, as namespace/name, that
+// holds a listener of the platform Gateway other than the route of the port.
+// Of routes attached at the same time the oldest holds it, by name when they
+// were created in the same second.
+func (r *WebAppReconciler) listenerHolder(ctx context.Context, own metav1.ObjectMeta, listener gatewayv1.SectionName, platform kleffv1.PlatformSettings) (string, error) {
+	type attachedRoute struct {
+		meta       metav1.ObjectMeta
+		parentRefs []gatewayv1.ParentReference
+	}
+	var routes []attachedRoute
+
+	tcpRoutes := &gatewayv1alpha2.TCPRouteList{}
+	if err := r.List(ctx, tcpRoutes); err != nil && !meta.IsNoMatchError(err) {
+		return "", err
+	}
+	for _, route := range tcpRoutes.Items {
+		routes = append(routes, attachedRoute{route.ObjectMeta, route.Spec.ParentRefs})
+	}
+	udpRoutes := &gatewayv1alpha2.UDPRouteList{}
+	if err := r.List(ctx, udpRoutes); err != nil && !meta.IsNoMatchError(err) {
+		return "", err
+	}
+	for _, route := range udpRoutes.Items {
+		routes = append(routes, attachedRoute{route.ObjectMeta, route.Spec.ParentRefs})
+	}
+
+	var ownCreated *metav1.Time
+	for _, route := range routes {
+		if route.meta.Namespace == own.Namespace && route.meta.Name == own.Name {
+			ownCreated = &route.meta.CreationTimestamp
+		}
+	}
+	for _, route := range routes {
+		if route.meta.Namespace == own.Namespace && route.meta.Name == own.Name {
+			continue
+		}
+		if !attachesTo(route.parentRefs, route.meta.Namespace, listener, platform) {
+			continue
+		}
+		holder := route.meta.Namespace + "/" + route.meta.Name
+		if ownCreated == nil || route.meta.CreationTimestamp.Before(ownCreated) ||
+			(route.meta.CreationTimestamp.Equal(ownCreated) && holder < own.Namespace+"/"+own.Name) {
+			return holder, nil
+		}
+	}
+	return "", nil
+}
+
+// attachesTo reports whether parent references of a route in namespace name
+// a listener of the platform Gateway, directly or through the whole Gateway
+func attachesTo(parentRefs []gatewayv1.ParentReference, namespace string, listener gatewayv1.SectionName, platform kleffv1.PlatformSettings) bool {
+	for _, ref := range parentRefs {
+		refNamespace := namespace
+		if ref.Namespace != nil {
+			refNamespace = string(*ref.Namespace)
+		}
+		if string(ref.Name) != platform.GatewayName || refNamespace != platform.GatewayNamespace {
+			continue
+		}
+		if ref.SectionName == nil || *ref.SectionName == listener {
+			return true
+		}
+	}
+	return false
+}
+
+// platformGateway references the platform Gateway, or one of its listeners
+func platformGateway(platform kleffv1.PlatformSettings, listener *gatewayv1.SectionName) gatewayv1.ParentReference {
+	namespace := gatewayv1.Namespace(platform.GatewayNamespace)
+	return gatewayv1.ParentReference{
+		Name:        gatewayv1.ObjectName(platform.GatewayName),
+		Namespace:   &namespace,
+		SectionName: listener,
+	}
+}
+
+func portBackendRef(service string, port kleffv1.AppPort) gatewayv1.BackendRef {
+	number := gatewayv1.PortNumber(port.Port)
+	return gatewayv1.BackendRef{
+		BackendObjectReference: gatewayv1.BackendObjectReference{
+			Name: gatewayv1.ObjectName(service),
+			Port: &number,
+		},
+	}
+}
+
+// routeAnnotations sets the ExternalDNS target and the platform annotations
+// of a route, keeping the other annotations
+func routeAnnotations(annotations map[string]string, platform kleffv1.PlatformSettings) map[string]string {
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	if platform.DNSTarget != "" {
+		annotations["external-dns.alpha.kubernetes.io/target"] = platform.DNSTarget
+	} else {
+		delete(annotations, "external-dns.alpha.kubernetes.io/target")
+	}
+	for k, v := range platform.RouteAnnotations {
+		annotations[k] = v
+	}
+	return annotations
+}
+
+// routeAccepted reports whether a Gateway accepted the current generation
+// of a route
+func routeAccepted(parents []gatewayv1.RouteParentStatus, generation int64) bool {
+	for _, parent := range parents {
+		accepted := meta.FindStatusCondition(parent.Conditions, string(gatewayv1.RouteConditionAccepted))
+		if accepted != nil && accepted.Status == metav1.ConditionTrue && accepted.ObservedGeneration >= generation {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteStalePortObjects deletes the Services and routes of ports that are
+// gone or now exposed another way, and those left under a previous name.
+// The TCP and UDP routes are experimental Gateway API kinds, so their CRDs
+// may not be installed.
+func (r *WebAppReconciler) deleteStalePortObjects(ctx context.Context, webapp *kleffv1.WebApp, wanted map[string]kleffv1.PortExposure) error {
+	selector := client.MatchingLabels{"webapp": webapp.Name}
+	lists := []struct {
+		list client.ObjectList
+		keep func(kleffv1.AppPort) bool
+	}{
+		{&corev1.ServiceList{}, func(port kleffv1.AppPort) bool { return portExposure(port) != kleffv1.ExposeGateway }},
+		{&gatewayv1.GRPCRouteList{}, func(port kleffv1.AppPort) bool {
+			return portExposure(port) == kleffv1.ExposeGateway && portProtocol(port) == kleffv1.ProtocolGRPC
+		}},
+		{&gatewayv1alpha2.TCPRouteList{}, func(port kleffv1.AppPort) bool {
+			return portExposure(port) == kleffv1.ExposeGateway && portProtocol(port) == kleffv1.ProtocolTCP
+		}},
+		{&gatewayv1alpha2.UDPRouteList{}, func(port kleffv1.AppPort) bool {
+			return portExposure(port) == kleffv1.ExposeGateway && portProtocol(port) == kleffv1.ProtocolUDP
+		}},
+	}
+
+	ports := make(map[string]kleffv1.AppPort, len(webapp.Spec.Ports))
+	for _, port := range webapp.Spec.Ports {
+		ports[port.Name] = port
+	}
+
+	for _, l := range lists {
+		if err := r.List(ctx, l.list, client.InNamespace(webapp.Namespace), selector, client.HasLabels{"port"}); err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return err
+		}
+		objects, err := meta.ExtractList(l.list)
+		if err != nil {
+			return err
+		}
+		for _, item := range objects {
+			obj, ok := item.(client.Object)
+			if !ok || !metav1.IsControlledBy(obj, webapp) {
+				continue
+			}
+			port, listed := ports[obj.GetLabels()["port"]]
+			_, exposed := wanted[port.Name]
+			if listed && exposed && l.keep(port) && obj.GetName() == portObjectName(webapp, port) {
+				continue
+			}
+			if err := r.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
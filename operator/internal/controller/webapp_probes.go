@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+const (
+	defaultProbePeriodSeconds    = int32(10)
+	defaultProbeTimeoutSeconds   = int32(3)
+	defaultProbeFailureThreshold = int32(3)
+	defaultStartupTimeoutSeconds = int32(300)
+)
+
+// containerProbes maps the WebApp's health check to the readiness, liveness
+// and startup probes of its container. A probe left out of the check's list
+// is nil. Without a health check the app port is probed over TCP.
+func containerProbes(webapp *kleffv1.WebApp) (readiness, liveness, startup *corev1.Probe) {
+	check := webapp.Spec.HealthCheck
+	if check == nil {
+		check = &kleffv1.HealthCheck{}
+	}
+
+	port := intstr.FromInt(webapp.Spec.Port)
+	if check.Port != nil {
+		port = intstr.FromInt32(*check.Port)
+	}
+
+	var handler corev1.ProbeHandler
+	if check.Type == "tcp" || (check.Type == "" && check.Path == "") {
+		handler.TCPSocket = &corev1.TCPSocketAction{Port: port}
+	} else {
+		handler.HTTPGet = &corev1.HTTPGetAction{Path: check.Path, Port: port}
+	}
+
+	period := int32Or(check.PeriodSeconds, defaultProbePeriodSeconds)
+	probe := func() *corev1.Probe {
+		return &corev1.Probe{
+			ProbeHandler:     handler,
+			PeriodSeconds:    period,
+			TimeoutSeconds:   int32Or(check.TimeoutSeconds, defaultProbeTimeoutSeconds),
+			SuccessThreshold: 1,
+			FailureThreshold: int32Or(check.FailureThreshold, defaultProbeFailureThreshold),
+		}
+	}
+
+	enabled := func(kind kleffv1.ProbeKind) bool {
+		return len(check.Probes) == 0 || slices.Contains(check.Probes, kind)
+	}
+
+	// The startup probe holds the other two back until the app booted, so
+	// the initial delay only applies to whichever probe runs first
+	initialDelay := int32Or(check.InitialDelaySeconds, 0)
+	if enabled(kleffv1.StartupProbe) {
+		startup = probe()
+		startup.InitialDelaySeconds = initialDelay
+		startup.FailureThreshold = max((int32Or(check.StartupTimeoutSeconds, defaultStartupTimeoutSeconds)+period-1)/period, 1)
+		initialDelay = 0
+	}
+	if enabled(kleffv1.ReadinessProbe) {
+		readiness = probe()
+		readiness.InitialDelaySeconds = initialDelay
+		// Only readiness may require several successes
+		readiness.SuccessThreshold = int32Or(check.SuccessThreshold, 1)
+	}
+	if enabled(kleffv1.LivenessProbe) {
+		liveness = probe()
+		liveness.InitialDelaySeconds = initialDelay
+	}
+	return readiness, liveness, startup
+}
+
+func int32Or(v *int32, fallback int32) int32 {
+	if v == nil {
+		return fallback
+	}
+	return *v
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+// Names of the objects bounding the resources of a project namespace
+const (
+	namespaceQuotaName      = "kleff-quota"
+	namespaceLimitRangeName = "kleff-limits"
+)
+
+func (r *WebAppReconciler) resourceConfig() *ResourceConfig {
+	return orDefaultResourceConfig(r.Resources)
+}
+
+func orDefaultResourceConfig(config *ResourceConfig) *ResourceConfig {
+	if config != nil {
+		return config
+	}
+	return DefaultResourceConfig()
+}
+
+// planName is the plan a WebApp runs on
+func (r *WebAppReconciler) planName(webapp *kleffv1.WebApp) string {
+	return resolvePlan(r.resourceConfig(), webapp.Spec.Plan)
+}
+
+func resolvePlan(config *ResourceConfig, plan string) string {
+	if plan != "" {
+		return plan
+	}
+	return config.DefaultPlan
+}
+
+// containerResources resolves the requests and limits of the app container:
+// the explicit resources block wins over the plan
+func (r *WebAppReconciler) containerResources(webapp *kleffv1.WebApp) (corev1.ResourceRequirements, error) {
+	return resolveResources(r.resourceConfig(), webapp.Spec.Plan, webapp.Spec.Resources)
+}
+
+func resolveResources(config *ResourceConfig, plan string, resources *corev1.ResourceRequirements) (corev1.ResourceRequirements, error) {
+	if resources != nil {
+		return *resources.DeepCopy(), nil
+	}
+
+	requirements, ok := config.Plans[resolvePlan(config, plan)]
+	if !ok {
+		return corev1.ResourceRequirements{}, fmt.Errorf("unknown plan %q", resolvePlan(config, plan))
+	}
+	return *requirements.DeepCopy(), nil
+}
+
+func (r *WebAppReconciler) reconcileNamespaceLimits(ctx context.Context, namespace string) error {
+	return reconcileNamespaceLimits(ctx, r.Client, r.resourceConfig(), namespace)
+}
+
+// reconcileNamespaceLimits keeps the ResourceQuota and LimitRange of a project
+// namespace in line with the config. They are shared by every app of the
+// namespace, so no single WebApp owns them.
+func reconcileNamespaceLimits(ctx context.Context, c client.Client, config *ResourceConfig, namespace string) error {
+	quota := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      namespaceQuotaName,
+			Namespace: namespace,
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, c, quota, func() error {
+		quota.Labels = map[string]string{"controller": "webapp"}
+		quota.Spec.Hard = config.NamespaceQuota.DeepCopy()
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Defaults let containers without requests, e.g. sidecars, still be admitted under the quota
+	defaults := config.Plans[config.DefaultPlan]
+	limitRange := &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      namespaceLimitRangeName,
+			Namespace: namespace,
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, c, limitRange, func() error {
+		limitRange.Labels = map[string]string{"controller": "webapp"}
+		limitRange.Spec.Limits = []corev1.LimitRangeItem{{
+			Type:           corev1.LimitTypeContainer,
+			Default:        defaults.Limits.DeepCopy(),
+			DefaultRequest: defaults.Requests.DeepCopy(),
+		}}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+// recordRevision appends a revision to the status when the image or the
+// environment changed since the last one. It reports whether it did.
+func recordRevision(webapp *kleffv1.WebApp) bool {
+	envHash := hashEnv(webapp.Spec.EnvVariables)
+
+	revisions := webapp.Status.Revisions
+	next := int64(1)
+	if len(revisions) > 0 {
+		latest := revisions[len(revisions)-1]
+		if latest.Image == webapp.Spec.Image && latest.EnvHash == envHash {
+			return false
+		}
+		next = latest.Revision + 1
+	}
+
+	revisions = append(revisions, kleffv1.WebAppRevision{
+		Revision:    next,
+		Image:       webapp.Spec.Image,
+		Commit:      webapp.Spec.Commit,
+		EnvHash:     envHash,
+		DeployedAt:  metav1.Now(),
+		TriggeredBy: webapp.Annotations[kleffv1.TriggeredByAnnotation],
+	})
+	if len(revisions) > kleffv1.MaxRevisionHistory {
+		revisions = revisions[len(revisions)-kleffv1.MaxRevisionHistory:]
+	}
+	webapp.Status.Revisions = revisions
+	webapp.Status.Commit = webapp.Spec.Commit
+	return true
+}
+
+// hashEnv returns a short, order independent fingerprint of the environment
+func hashEnv(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(env[k]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// secretEnvHashAnnotation on the pod template changes with the secret values
+const secretEnvHashAnnotation = "kleff.io/secret-env-hash"
+
+// secretEnvName is the Secret server-apis keeps the secret variables of a
+// WebApp, Worker or CronJob in
+func secretEnvName(owner string) string {
+	return owner + "-env"
+}
+
+// secretEnvVars references every secret variable from the Secret of owner
+func secretEnvVars(owner string, secretEnv []string) []corev1.EnvVar {
+	keys := append([]string(nil), secretEnv...)
+	sort.Strings(keys)
+
+	envVars := make([]corev1.EnvVar, 0, len(keys))
+	for _, key := range keys {
+		envVars = append(envVars, corev1.EnvVar{
+			Name: key,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secretEnvName(owner)},
+					Key:                  key,
+				},
+			},
+		})
+	}
+	return envVars
+}
+
+// secretEnvHash fingerprints the secret variables, empty when there are none
+func secretEnvHash(ctx context.Context, c client.Reader, namespace, owner string, secretEnv []string) (string, error) {
+	if len(secretEnv) == 0 {
+		return "", nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: secretEnvName(owner), Namespace: namespace}, secret); err != nil {
+		return "", fmt.Errorf("secret %s: %w", secretEnvName(owner), err)
+	}
+
+	values := make(map[string]string, len(secretEnv))
+	for _, key := range secretEnv {
+		value, ok := secret.Data[key]
+		if !ok {
+			return "", fmt.Errorf("secret %s has no key %q", secretEnvName(owner), key)
+		}
+		values[key] = string(value)
+	}
+	return hashEnv(values), nil
+}
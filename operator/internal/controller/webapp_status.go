@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+// podFailureReasons are the waiting reasons of a container that will not
+// recover without a change to the WebApp
+var podFailureReasons = map[string]bool{
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CrashLoopBackOff":           true,
+	"CreateContainerConfigError": true,
+	"RunContainerError":          true,
+}
+
+// observeRollout copies the replica counts of the active Deployment into the
+// status and sets the Progressing and Degraded conditions from the updating
+// one. CurrentImage and LastDeployedAt move once a rollout completed, which
+// for a canary is its promotion.
+func (r *WebAppReconciler) observeRollout(ctx context.Context, webapp *kleffv1.WebApp, active, updating *appsv1.Deployment) error {
+	webapp.Status.Replicas = 1
+	if active.Spec.Replicas != nil {
+		webapp.Status.Replicas = *active.Spec.Replicas
+	}
+	webapp.Status.ReadyReplicas = active.Status.ReadyReplicas
+
+	desired := int32(1)
+	if updating.Spec.Replicas != nil {
+		desired = *updating.Spec.Replicas
+	}
+	progressing, reason, message := rolloutProgress(updating, desired)
+	if canary := webapp.Status.Canary; canary != nil {
+		// The stable pods run the previous image until the canary is promoted
+		switch {
+		case canary.Aborted:
+			setCondition(webapp, kleffv1.ConditionProgressing, metav1.ConditionFalse, "CanaryAborted", "The canary was aborted, the stable version serves all requests")
+		case progressing:
+			setCondition(webapp, kleffv1.ConditionProgressing, metav1.ConditionTrue, reason, message)
+		default:
+			setCondition(webapp, kleffv1.ConditionProgressing, metav1.ConditionTrue, "CanaryStep",
+				fmt.Sprintf("Step %d: the canary receives %d%% of the requests", canary.Step+1, canary.Weight))
+		}
+	} else if progressing {
+		setCondition(webapp, kleffv1.ConditionProgressing, metav1.ConditionTrue, reason, message)
+	} else {
+		setCondition(webapp, kleffv1.ConditionProgressing, metav1.ConditionFalse, reason, message)
+		if webapp.Status.CurrentImage != webapp.Spec.Image {
+			now := metav1.Now()
+			webapp.Status.CurrentImage = webapp.Spec.Image
+			webapp.Status.LastDeployedAt = &now
+		}
+	}
+
+	reason, message, err := podFailure(ctx, r.Client, webapp.Namespace, client.MatchingLabels{"webapp": webapp.Name})
+	if err != nil {
+		return err
+	}
+	if reason == "" {
+		if cond := deploymentCondition(updating, appsv1.DeploymentProgressing); cond != nil && cond.Reason == "ProgressDeadlineExceeded" {
+			reason, message = cond.Reason, cond.Message
+		}
+	}
+	if reason != "" {
+		setCondition(webapp, kleffv1.ConditionDegraded, metav1.ConditionTrue, reason, message)
+	} else {
+		setCondition(webapp, kleffv1.ConditionDegraded, metav1.ConditionFalse, "AsExpected", "All pods are healthy")
+	}
+	return nil
+}
+
+// rolloutProgress reports whether the Deployment is still replacing pods
+func rolloutProgress(deployment *appsv1.Deployment, desired int32) (bool, string, string) {
+	status := deployment.Status
+	switch {
+	case deployment.Generation > status.ObservedGeneration:
+		return true, "RollingOut", "Waiting for the Deployment to pick up the change"
+	case status.UpdatedReplicas < desired:
+		return true, "RollingOut", fmt.Sprintf("%d of %d pods updated", status.UpdatedReplicas, desired)
+	case status.Replicas > status.UpdatedReplicas:
+		return true, "RollingOut", fmt.Sprintf("%d old pods pending termination", status.Replicas-status.UpdatedReplicas)
+	case status.AvailableReplicas < status.UpdatedReplicas:
+		return true, "RollingOut", fmt.Sprintf("%d of %d updated pods available", status.AvailableReplicas, status.UpdatedReplicas)
+	}
+	return false, "RolloutComplete", "All pods run the current spec"
+}
+
+// podFailure looks for a pod matching selector stuck pulling its image or
+// crashing, and describes the first one found
+func podFailure(ctx context.Context, c client.Reader, namespace string, selector client.MatchingLabels) (string, string, error) {
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods, client.InNamespace(namespace), selector); err != nil {
+		return "", "", err
+	}
+
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, cs := range statuses {
+			if cs.State.Waiting == nil || !podFailureReasons[cs.State.Waiting.Reason] {
+				continue
+			}
+			message := cs.State.Waiting.Message
+			if last := cs.LastTerminationState.Terminated; last != nil && last.Reason == "OOMKilled" {
+				message = "The container was killed for exceeding its memory limit"
+			}
+			if message == "" {
+				message = cs.State.Waiting.Reason
+			}
+			return cs.State.Waiting.Reason, fmt.Sprintf("Pod %s: %s", pod.Name, message), nil
+		}
+	}
+	return "", "", nil
+}
+
+func deploymentCondition(deployment *appsv1.Deployment, condType appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range deployment.Status.Conditions {
+		if deployment.Status.Conditions[i].Type == condType {
+			return &deployment.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// setCondition sets a condition of the WebApp for its current generation
+func setCondition(webapp *kleffv1.WebApp, condType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&webapp.Status.Conditions, metav1.Condition{
+		Type:               condType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: webapp.Generation,
+		LastTransitionTime: metav1.Now(),
+	})
+}
+
+// ManagedPodSelector matches the pods of WebApps and Workers, the only pods
+// the controllers read. The manager caches no other pod of the cluster.
+func ManagedPodSelector() labels.Selector {
+	requirement, err := labels.NewRequirement("controller", selection.In, []string{"webapp", "worker"})
+	if err != nil {
+		panic(err)
+	}
+	return labels.NewSelector().Add(*requirement)
+}
+
+// webAppForPod requeues the WebApp of a pod so pod failures show up in its status
+func webAppForPod(_ context.Context, obj client.Object) []reconcile.Request {
+	name := obj.GetLabels()["webapp"]
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{Name: name, Namespace: obj.GetNamespace()},
+	}}
+}
@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+const defaultScaleDownDelaySeconds = int32(300)
+
+// routeBackend is a Service receiving weight percent of the requests
+type routeBackend struct {
+	service string
+	weight  int32
+}
+
+// soleBackend sends all the traffic to one Service
+func soleBackend(service string) []routeBackend {
+	return []routeBackend{{service: service, weight: 100}}
+}
+
+// rollout is the outcome of syncing the Deployments of a WebApp
+type rollout struct {
+	// active is the Deployment serving the traffic
+	active *appsv1.Deployment
+	// updating is the Deployment the latest change rolls out to, the
+	// active one unless a strategy brings the change up next to it
+	updating *appsv1.Deployment
+	// backends are the Services the HTTPRoute splits the traffic across
+	backends []routeBackend
+	// requeueAfter schedules the next step of the strategy, zero when none
+	requeueAfter time.Duration
+}
+
+// strategyType is the strategy the WebApp rolls out with. Blue/green and
+// canaries run two versions side by side, which a ReadWriteOnce volume does
+// not allow, so such WebApps are replaced in place.
+func strategyType(webapp *kleffv1.WebApp) kleffv1.StrategyType {
+	if webapp.Spec.Strategy == nil || webapp.Spec.Strategy.Type == "" || exclusiveVolumes(webapp) {
+		return kleffv1.StrategyRollingUpdate
+	}
+	return webapp.Spec.Strategy.Type
+}
+
+// slotName is the Deployment and Service name of a blue/green slot
+func slotName(webapp *kleffv1.WebApp, slot string) string {
+	if slot == kleffv1.SlotGreen {
+		return webapp.Name + "-green"
+	}
+	return webapp.Name
+}
+
+// reconcileRollout rolls the pod template out with the WebApp's strategy
+func (r *WebAppReconciler) reconcileRollout(ctx context.Context, webapp *kleffv1.WebApp, labels map[string]string, template corev1.PodTemplateSpec) (*rollout, error) {
+	strategy := strategyType(webapp)
+
+	// A canary left behind by a change of strategy is dropped
+	if strategy != kleffv1.StrategyCanary && webapp.Status.Canary != nil {
+		if err := r.removeWorkload(ctx, webapp, canaryName(webapp)); err != nil {
+			return nil, err
+		}
+		webapp.Status.Canary = nil
+	}
+
+	switch strategy {
+	case kleffv1.StrategyBlueGreen:
+		return r.reconcileBlueGreen(ctx, webapp, labels, template)
+	case kleffv1.StrategyCanary:
+		// Canaries run next to the WebApp's own Deployment, so leaving
+		// blue/green has to finish first
+		if webapp.Status.BlueGreen == nil {
+			return r.reconcileCanary(ctx, webapp, labels, template)
+		}
+	}
+	return r.reconcileRollingUpdate(ctx, webapp, labels, template)
+}
+
+// reconcileRollingUpdate updates the WebApp's own Deployment in place. When
+// the WebApp leaves blue/green on the green slot, that slot keeps the traffic
+// until the own Deployment caught up.
+func (r *WebAppReconciler) reconcileRollingUpdate(ctx context.Context, webapp *kleffv1.WebApp, labels map[string]string, template corev1.PodTemplateSpec) (*rollout, error) {
+	deployment, err := r.syncDeployment(ctx, webapp, webapp.Name, labels, template, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := &rollout{active: deployment, updating: deployment, backends: soleBackend(webapp.Name)}
+
+	if webapp.Status.BlueGreen == nil {
+		return result, nil
+	}
+	if webapp.Status.BlueGreen.ActiveSlot == kleffv1.SlotGreen && !deploymentReady(deployment) {
+		green := &appsv1.Deployment{}
+		err := r.Get(ctx, types.NamespacedName{Name: slotName(webapp, kleffv1.SlotGreen), Namespace: webapp.Namespace}, green)
+		if err == nil {
+			result.active = green
+			result.backends = soleBackend(green.Name)
+			return result, nil
+		}
+		if !k8serrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	if err := r.removeWorkload(ctx, webapp, slotName(webapp, kleffv1.SlotGreen)); err != nil {
+		return nil, err
+	}
+	webapp.Status.BlueGreen = nil
+	return result, nil
+}
+
+// reconcileBlueGreen keeps the active slot on the current template. A new
+// template is brought up in the idle slot with as many pods as the active
+// one, and the traffic switches once all of them are ready. The previous
+// slot keeps running for the scale down delay so switching back is instant.
+func (r *WebAppReconciler) reconcileBlueGreen(ctx context.Context, webapp *kleffv1.WebApp, labels map[string]string, template corev1.PodTemplateSpec) (*rollout, error) {
+	if webapp.Status.BlueGreen == nil {
+		webapp.Status.BlueGreen = &kleffv1.BlueGreenStatus{ActiveSlot: kleffv1.SlotBlue}
+	}
+	activeSlot, idleSlot := webapp.Status.BlueGreen.ActiveSlot, kleffv1.SlotGreen
+	if activeSlot == kleffv1.SlotGreen {
+		idleSlot = kleffv1.SlotBlue
+	}
+	activeName, idleName := slotName(webapp, activeSlot), slotName(webapp, idleSlot)
+
+	// Both slots keep a Service so a switch only touches the HTTPRoute
+	if err := r.syncService(ctx, webapp, slotName(webapp, kleffv1.SlotGreen), labels); err != nil {
+		return nil, err
+	}
+
+	active := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: activeName, Namespace: webapp.Namespace}, active)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	if k8serrors.IsNotFound(err) || active.Annotations[templateHashAnnotation] == templateHash(template) {
+		active, err := r.syncDeployment(ctx, webapp, activeName, labels, template, nil)
+		if err != nil {
+			return nil, err
+		}
+		requeueAfter, err := r.retireSlot(ctx, webapp, idleName)
+		if err != nil {
+			return nil, err
+		}
+		return &rollout{active: active, updating: active, backends: soleBackend(activeName), requeueAfter: requeueAfter}, nil
+	}
+
+	replicas := int32(1)
+	if active.Spec.Replicas != nil {
+		replicas = *active.Spec.Replicas
+	}
+	idle, err := r.syncDeployment(ctx, webapp, idleName, labels, template, &replicas)
+	if err != nil {
+		return nil, err
+	}
+	if !deploymentReady(idle) {
+		return &rollout{active: active, updating: idle, backends: soleBackend(activeName)}, nil
+	}
+
+	now := metav1.Now()
+	webapp.Status.BlueGreen = &kleffv1.BlueGreenStatus{ActiveSlot: idleSlot, SwitchedAt: &now}
+	return &rollout{active: idle, updating: idle, backends: soleBackend(idleName), requeueAfter: scaleDownDelay(webapp)}, nil
+}
+
+// retireSlot scales the idle slot to zero once the scale down delay since
+// the last switch passed. It returns the time left until then.
+func (r *WebAppReconciler) retireSlot(ctx context.Context, webapp *kleffv1.WebApp, name string) (time.Duration, error) {
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: webapp.Namespace}, deployment); err != nil {
+		return 0, client.IgnoreNotFound(err)
+	}
+	if deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == 0 {
+		return 0, nil
+	}
+
+	if switchedAt := webapp.Status.BlueGreen.SwitchedAt; switchedAt != nil {
+		if remaining := time.Until(switchedAt.Add(scaleDownDelay(webapp))); remaining > 0 {
+			return remaining, nil
+		}
+	}
+
+	patch := client.MergeFrom(deployment.DeepCopy())
+	zero := int32(0)
+	deployment.Spec.Replicas = &zero
+	return 0, r.Patch(ctx, deployment, patch)
+}
+
+func scaleDownDelay(webapp *kleffv1.WebApp) time.Duration {
+	seconds := defaultScaleDownDelaySeconds
+	if webapp.Spec.Strategy != nil && webapp.Spec.Strategy.BlueGreen != nil && webapp.Spec.Strategy.BlueGreen.ScaleDownDelaySeconds != nil {
+		seconds = *webapp.Spec.Strategy.BlueGreen.ScaleDownDelaySeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// removeWorkload deletes a Deployment and the Service of the same name
+func (r *WebAppReconciler) removeWorkload(ctx context.Context, webapp *kleffv1.WebApp, name string) error {
+	meta := metav1.ObjectMeta{Name: name, Namespace: webapp.Namespace}
+	if err := r.Delete(ctx, &appsv1.Deployment{ObjectMeta: meta}); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, &corev1.Service{ObjectMeta: meta}))
+}
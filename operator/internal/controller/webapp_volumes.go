@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+// orphanedVolumeLabel marks the claim of a volume removed from its WebApp.
+// The claim keeps its data until it is deleted explicitly or with the app.
+const orphanedVolumeLabel = "kleff.io/orphaned"
+
+// claimName is the PersistentVolumeClaim name of a volume of the WebApp
+func claimName(webapp *kleffv1.WebApp, volume kleffv1.Volume) string {
+	return webapp.Name + "-" + volume.Name
+}
+
+func accessMode(volume kleffv1.Volume) corev1.PersistentVolumeAccessMode {
+	if volume.AccessMode == kleffv1.ReadWriteMany {
+		return corev1.ReadWriteMany
+	}
+	return corev1.ReadWriteOnce
+}
+
+// exclusiveVolumes reports whether the WebApp mounts a volume only one pod
+// can attach, which pins it to a single replica replaced with Recreate
+func exclusiveVolumes(webapp *kleffv1.WebApp) bool {
+	for _, volume := range webapp.Spec.Volumes {
+		if accessMode(volume) == corev1.ReadWriteOnce {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileVolumes creates the PersistentVolumeClaims of the WebApp's
+// volumes and grows them with the spec. Claims of volumes removed from the
+// spec are released rather than deleted: they lose their owner reference and
+// are labeled orphaned, and adding the volume back adopts them again.
+func (r *WebAppReconciler) reconcileVolumes(ctx context.Context, webapp *kleffv1.WebApp, labels map[string]string) error {
+	wanted := make(map[string]bool, len(webapp.Spec.Volumes))
+	for _, volume := range webapp.Spec.Volumes {
+		claim := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      claimName(webapp, volume),
+				Namespace: webapp.Namespace,
+			},
+		}
+		wanted[claim.Name] = true
+
+		_, err := controllerutil.CreateOrUpdate(ctx, r.Client, claim, func() error {
+			claim.Labels = make(map[string]string, len(labels)+1)
+			for k, v := range labels {
+				claim.Labels[k] = v
+			}
+			claim.Labels["webapp"] = webapp.Name
+
+			// Everything but the requested size is immutable once bound
+			if claim.CreationTimestamp.IsZero() {
+				claim.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{accessMode(volume)}
+				claim.Spec.StorageClassName = volume.StorageClassName
+			}
+			current, ok := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+			if !ok || volume.Size.Cmp(current) > 0 {
+				claim.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: volume.Size}
+			}
+			return controllerutil.SetControllerReference(webapp, claim, r.Scheme)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	claims := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, claims, client.InNamespace(webapp.Namespace), client.MatchingLabels{"webapp": webapp.Name}); err != nil {
+		return err
+	}
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if wanted[claim.Name] || !metav1.IsControlledBy(claim, webapp) {
+			continue
+		}
+		claim.OwnerReferences = removeOwner(claim.OwnerReferences, webapp.UID)
+		claim.Labels[orphanedVolumeLabel] = "true"
+		if err := r.Update(ctx, claim); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteOrphanedVolumes deletes the claims the WebApp released, once it is
+// deleted itself
+func (r *WebAppReconciler) deleteOrphanedVolumes(ctx context.Context, webapp *kleffv1.WebApp) error {
+	claims := &corev1.PersistentVolumeClaimList{}
+	err := r.List(ctx, claims, client.InNamespace(webapp.Namespace), client.MatchingLabels{
+		"webapp":            webapp.Name,
+		orphanedVolumeLabel: "true",
+	})
+	if err != nil {
+		return err
+	}
+	for i := range claims.Items {
+		if err := r.Delete(ctx, &claims.Items[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeOwner(refs []metav1.OwnerReference, uid types.UID) []metav1.OwnerReference {
+	kept := refs[:0]
+	for _, ref := range refs {
+		if ref.UID != uid {
+			kept = append(kept, ref)
+		}
+	}
+	return kept
+}
+
+// podVolumes mounts the WebApp's volumes into its container
+func podVolumes(webapp *kleffv1.WebApp) ([]corev1.Volume, []corev1.VolumeMount) {
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+	for _, volume := range webapp.Spec.Volumes {
+		volumes = append(volumes, corev1.Volume{
+			Name: volume.Name,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName(webapp, volume)},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{Name: volume.Name, MountPath: volume.MountPath})
+	}
+	return volumes, mounts
+}
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+// WorkerReconciler runs a Worker as a Deployment, without Service or route
+type WorkerReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Resources holds the resource plans, DefaultResourceConfig when nil
+	Resources *ResourceConfig
+
+	// Platform holds the settings from the flags and config file,
+	// DefaultPlatformSettings when nil. The PlatformConfig overrides them.
+	Platform *kleffv1.PlatformSettings
+}
+
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=workers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=workers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=platformconfigs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=kleff.kleff.io,resources=databases,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=resourcequotas;limitranges,verbs=get;list;watch;create;update;patch
+
+func (r *WorkerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	worker := &kleffv1.Worker{}
+	if err := r.Get(ctx, req.NamespacedName, worker); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	before := worker.Status.DeepCopy()
+
+	// Nothing can run before the first build pushed an image
+	if worker.Spec.Image == "" {
+		return r.updateStatus(ctx, worker, before, metav1.ConditionFalse, "AwaitingBuild", "Waiting for the first build to succeed")
+	}
+
+	config := orDefaultResourceConfig(r.Resources)
+	labels := workloadLabels(worker.Name, "worker", &worker.Spec.WorkloadSpec)
+	w, reason, err := resolveWorkload(ctx, r.Client, config, r.Platform, worker.Namespace, worker.Name, &worker.Spec.WorkloadSpec, labels)
+	if err != nil {
+		logger.Error(err, "Failed to resolve worker settings", "reason", reason)
+		return r.updateStatus(ctx, worker, before, metav1.ConditionFalse, reason, err.Error())
+	}
+
+	deployment, err := r.syncDeployment(ctx, worker, labels, w.podTemplate(config))
+	if err != nil {
+		logger.Error(err, "Failed to reconcile Deployment")
+		return r.updateStatus(ctx, worker, before, metav1.ConditionFalse, "DeploymentFailed", err.Error())
+	}
+
+	if err := r.observeDeployment(ctx, worker, deployment); err != nil {
+		logger.Error(err, "Failed to read pod status")
+		return ctrl.Result{}, err
+	}
+	degraded := meta.FindStatusCondition(worker.Status.Conditions, kleffv1.ConditionDegraded)
+	switch {
+	case deployment.Status.ReadyReplicas > 0:
+		return r.updateStatus(ctx, worker, before, metav1.ConditionTrue, "Available",
+			fmt.Sprintf("%d of %d pods are running", deployment.Status.ReadyReplicas, *deployment.Spec.Replicas))
+	case *deployment.Spec.Replicas == 0:
+		return r.updateStatus(ctx, worker, before, metav1.ConditionFalse, "ScaledDown", "The worker has no replicas")
+	case degraded != nil && degraded.Status == metav1.ConditionTrue:
+		return r.updateStatus(ctx, worker, before, metav1.ConditionFalse, degraded.Reason, degraded.Message)
+	default:
+		return r.updateStatus(ctx, worker, before, metav1.ConditionFalse, "Progressing", "Waiting for pods to be ready")
+	}
+}
+
+// syncDeployment creates or updates the Deployment named after the Worker
+func (r *WorkerReconciler) syncDeployment(ctx context.Context, worker *kleffv1.Worker, labels map[string]string, template corev1.PodTemplateSpec) (*appsv1.Deployment, error) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      worker.Name,
+			Namespace: worker.Namespace,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, deployment, func() error {
+		deployment.Labels = labels
+
+		// Selector is immutable after creation, so we set it only if new
+		if deployment.CreationTimestamp.IsZero() {
+			deployment.Spec.Selector = &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": worker.Name},
+			}
+		}
+
+		replicas := int32(1)
+		if worker.Spec.Replicas != nil {
+			replicas = *worker.Spec.Replicas
+		}
+		deployment.Spec.Replicas = &replicas
+
+		// Merged rather than replaced, so annotations such as the one of
+		// kubectl rollout restart survive
+		podTemplate := &deployment.Spec.Template
+		if podTemplate.Labels == nil {
+			podTemplate.Labels = make(map[string]string)
+		}
+		for k, v := range template.Labels {
+			podTemplate.Labels[k] = v
+		}
+		if secretHash, ok := template.Annotations[secretEnvHashAnnotation]; ok {
+			if podTemplate.Annotations == nil {
+				podTemplate.Annotations = make(map[string]string)
+			}
+			podTemplate.Annotations[secretEnvHashAnnotation] = secretHash
+		} else {
+			delete(podTemplate.Annotations, secretEnvHashAnnotation)
+		}
+		podTemplate.Spec.ImagePullSecrets = template.Spec.ImagePullSecrets
+		podTemplate.Spec.Containers = template.Spec.Containers
+
+		return controllerutil.SetControllerReference(worker, deployment, r.Scheme)
+	})
+	return deployment, err
+}
+
+// observeDeployment records the replicas and rollout of the Deployment and
+// looks for failing pods. The image becomes current once every pod runs it.
+func (r *WorkerReconciler) observeDeployment(ctx context.Context, worker *kleffv1.Worker, deployment *appsv1.Deployment) error {
+	worker.Status.Replicas = *deployment.Spec.Replicas
+	worker.Status.ReadyReplicas = deployment.Status.ReadyReplicas
+
+	progressing, reason, message := rolloutProgress(deployment, *deployment.Spec.Replicas)
+	if progressing {
+		r.setCondition(worker, kleffv1.ConditionProgressing, metav1.ConditionTrue, reason, message)
+	} else {
+		r.setCondition(worker, kleffv1.ConditionProgressing, metav1.ConditionFalse, reason, message)
+		if worker.Status.CurrentImage != worker.Spec.Image {
+			now := metav1.Now()
+			worker.Status.CurrentImage = worker.Spec.Image
+			worker.Status.LastDeployedAt = &now
+		}
+	}
+
+	reason, message, err := podFailure(ctx, r.Client, worker.Namespace, client.MatchingLabels{"app": worker.Name})
+	if err != nil {
+		return err
+	}
+	if reason == "" {
+		if cond := deploymentCondition(deployment, appsv1.DeploymentProgressing); cond != nil && cond.Reason == "ProgressDeadlineExceeded" {
+			reason, message = cond.Reason, cond.Message
+		}
+	}
+	if reason != "" {
+		r.setCondition(worker, kleffv1.ConditionDegraded, metav1.ConditionTrue, reason, message)
+	} else {
+		r.setCondition(worker, kleffv1.ConditionDegraded, metav1.ConditionFalse, "AsExpected", "All pods are healthy")
+	}
+	return nil
+}
+
+func (r *WorkerReconciler) setCondition(worker *kleffv1.Worker, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&worker.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: worker.Generation,
+		LastTransitionTime: metav1.Now(),
+	})
+}
+
+// updateStatus sets the Available condition and writes the status when it
+// differs from before
+func (r *WorkerReconciler) updateStatus(ctx context.Context, worker *kleffv1.Worker, before *kleffv1.WorkerStatus, status metav1.ConditionStatus, reason, message string) (ctrl.Result, error) {
+	r.setCondition(worker, kleffv1.ConditionAvailable, status, reason, message)
+	worker.Status.ObservedGeneration = worker.Generation
+
+	if equality.Semantic.DeepEqual(before, &worker.Status) {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, r.Status().Update(ctx, worker)
+}
+
+// workersForDatabase requeues the Workers bound to a Database
+func (r *WorkerReconciler) workersForDatabase(ctx context.Context, obj client.Object) []reconcile.Request {
+	workers := &kleffv1.WorkerList{}
+	if err := r.List(ctx, workers, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, worker := range workers.Items {
+		if boundToDatabase(&worker.Spec.WorkloadSpec, obj.GetName()) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: worker.Name, Namespace: worker.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+// workerForPod maps a pod to the Worker running it, so crashes show up in
+// the status
+func workerForPod(_ context.Context, obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	if labels["controller"] != "worker" || labels["app"] == "" {
+		return nil
+	}
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{Name: labels["app"], Namespace: obj.GetNamespace()},
+	}}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *WorkerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kleffv1.Worker{}).
+		Owns(&appsv1.Deployment{}).
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(workerForPod)).
+		Watches(&kleffv1.Database{}, handler.EnqueueRequestsFromMapFunc(r.workersForDatabase)).
+		Named("worker").
+		Complete(r)
+}
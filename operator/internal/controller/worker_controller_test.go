@@ -0,0 +1,124 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+var _ = Describe("Worker Controller", func() {
+	Context("When reconciling a resource", func() {
+		const resourceName = "test-worker"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		BeforeEach(func() {
+			replicas := int32(2)
+			resource := &kleffv1.Worker{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: kleffv1.WorkerSpec{
+					WorkloadSpec: kleffv1.WorkloadSpec{
+						Command:      []string{"./consume"},
+						EnvVariables: map[string]string{"QUEUE": "jobs"},
+					},
+					Replicas: &replicas,
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			resource := &kleffv1.Worker{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should run the built image without a Service", func() {
+			controllerReconciler := &WorkerReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			By("Waiting for the first build")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			worker := &kleffv1.Worker{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, worker)).To(Succeed())
+			Expect(meta.FindStatusCondition(worker.Status.Conditions, kleffv1.ConditionAvailable).Reason).To(Equal("AwaitingBuild"))
+			Expect(k8serrors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, &appsv1.Deployment{}))).To(BeTrue())
+
+			By("Deploying the image once built")
+			worker.Spec.Image = "registry.kleff.io/worker:1"
+			Expect(k8sClient.Update(ctx, worker)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(2)))
+			container := deployment.Spec.Template.Spec.Containers[0]
+			Expect(container.Image).To(Equal("registry.kleff.io/worker:1"))
+			Expect(container.Command).To(Equal([]string{"./consume"}))
+			Expect(container.Ports).To(BeEmpty())
+			Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "QUEUE", Value: "jobs"}))
+			Expect(deployment.Spec.Template.Labels).To(HaveKeyWithValue("controller", "worker"))
+			Expect(k8serrors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, &corev1.Service{}))).To(BeTrue())
+
+			By("Reporting the rollout once the pods are ready")
+			deployment.Status = appsv1.DeploymentStatus{
+				ObservedGeneration: deployment.Generation,
+				Replicas:           2,
+				UpdatedReplicas:    2,
+				ReadyReplicas:      2,
+				AvailableReplicas:  2,
+			}
+			Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, worker)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(worker.Status.Conditions, kleffv1.ConditionAvailable)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(worker.Status.Conditions, kleffv1.ConditionProgressing)).To(BeTrue())
+			Expect(worker.Status.ReadyReplicas).To(Equal(int32(2)))
+			Expect(worker.Status.CurrentImage).To(Equal("registry.kleff.io/worker:1"))
+			Expect(worker.Status.LastDeployedAt).NotTo(BeNil())
+		})
+	})
+})
@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kleffv1 "kleff.io/api/v1"
+)
+
+// unsafeLabelChars are replaced so a display name fits in a label value
+var unsafeLabelChars = regexp.MustCompile(`[^a-z0-9A-Z._-]`)
+
+// workload is what the Worker and CronJob controllers resolve before they
+// can build the pod template
+type workload struct {
+	name          string
+	spec          *kleffv1.WorkloadSpec
+	labels        map[string]string
+	platform      kleffv1.PlatformSettings
+	resources     corev1.ResourceRequirements
+	secretEnvHash string
+}
+
+// workloadLabels are the labels of the objects of a Worker or CronJob,
+// controller being "worker" or "cronjob"
+func workloadLabels(name, controller string, spec *kleffv1.WorkloadSpec) map[string]string {
+	labels := map[string]string{
+		"app":          name,
+		"container-id": spec.ContainerID,
+		"controller":   controller,
+	}
+	if spec.DisplayName != "" {
+		labels["display-name"] = unsafeLabelChars.ReplaceAllString(spec.DisplayName, "-")
+	}
+	return labels
+}
+
+// resolveWorkload gathers the settings, secrets, databases and resources a
+// workload runs with. On failure it returns the reason to report on the
+// Available condition along with the error.
+func resolveWorkload(ctx context.Context, c client.Client, config *ResourceConfig, base *kleffv1.PlatformSettings, namespace, name string, spec *kleffv1.WorkloadSpec, labels map[string]string) (*workload, string, error) {
+	platform, err := resolvePlatformSettings(ctx, c, base, namespace)
+	if err != nil {
+		return nil, "PlatformConfigFailed", err
+	}
+
+	hash, err := secretEnvHash(ctx, c, namespace, name, spec.SecretEnv)
+	if err != nil {
+		return nil, "SecretEnvFailed", err
+	}
+
+	missing, err := missingDatabase(ctx, c, namespace, spec.Databases)
+	if err != nil {
+		return nil, "DatabaseFailed", err
+	}
+	if missing != "" {
+		return nil, "DatabaseNotFound", fmt.Errorf("database %s does not exist", missing)
+	}
+
+	resources, err := resolveResources(config, spec.Plan, spec.Resources)
+	if err != nil {
+		return nil, "InvalidPlan", err
+	}
+	if err := reconcileNamespaceLimits(ctx, c, config, namespace); err != nil {
+		return nil, "QuotaFailed", err
+	}
+
+	return &workload{
+		name:          name,
+		spec:          spec,
+		labels:        labels,
+		platform:      platform,
+		resources:     resources,
+		secretEnvHash: hash,
+	}, "", nil
+}
+
+// podTemplate is the pod template of the workload, built the way WebApps
+// build theirs minus the port and probes
+func (w *workload) podTemplate(config *ResourceConfig) corev1.PodTemplateSpec {
+	template := corev1.PodTemplateSpec{}
+
+	template.Labels = make(map[string]string, len(w.labels)+1)
+	for k, v := range w.labels {
+		template.Labels[k] = v
+	}
+	// Lets billing meter pods by plan
+	if w.spec.Resources == nil {
+		template.Labels["plan"] = resolvePlan(config, w.spec.Plan)
+	} else {
+		template.Labels["plan"] = "custom"
+	}
+
+	// Secret values are only referenced, so roll the pods when they change
+	if w.secretEnvHash != "" {
+		template.Annotations = map[string]string{secretEnvHashAnnotation: w.secretEnvHash}
+	}
+
+	if w.platform.ImagePullSecret != "" {
+		template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{
+			{Name: w.platform.ImagePullSecret},
+		}
+	}
+
+	// Sorted as any change to the template rolls the pods
+	keys := make([]string, 0, len(w.spec.EnvVariables))
+	for key := range w.spec.EnvVariables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var envVars []corev1.EnvVar
+	for _, key := range keys {
+		envVars = append(envVars, corev1.EnvVar{Name: key, Value: w.spec.EnvVariables[key]})
+	}
+	envVars = append(envVars, secretEnvVars(w.name, w.spec.SecretEnv)...)
+	envVars = append(envVars, databaseEnvVars(w.spec.Databases)...)
+
+	template.Spec.Containers = []corev1.Container{{
+		Name:            "app",
+		Image:           w.spec.Image,
+		ImagePullPolicy: corev1.PullAlways,
+		Command:         w.spec.Command,
+		Args:            w.spec.Args,
+		Env:             envVars,
+		Resources:       w.resources,
+	}}
+	return template
+}
+
+// boundToDatabase tells whether a workload binds the Database
+func boundToDatabase(spec *kleffv1.WorkloadSpec, database string) bool {
+	for _, binding := range spec.Databases {
+		if binding.Name == database {
+			return true
+		}
+	}
+	return false
+}
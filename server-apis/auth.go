@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Caller is the authenticated user behind a request
+type Caller struct {
+	Subject           string
+	Email             string
+	PreferredUsername string
+	Token             string // Bearer token, forwarded to the membership lookup
+}
+
+// Name identifies the caller in the revision history
+func (c *Caller) Name() string {
+	if c.PreferredUsername != "" {
+		return c.PreferredUsername
+	}
+	return c.Subject
+}
+
+// TokenValidator resolves a bearer token to the user it was issued to
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, bearerToken string) (*Caller, error)
+}
+
+// Project permissions granted by project-management-service through the
+// collaborator roles, a VIEWER only holding the read and view ones
+const (
+	permissionReadProject   = "READ_PROJECT"
+	permissionWriteProject  = "WRITE_PROJECT"
+	permissionDeploy        = "DEPLOY"
+	permissionManageEnvVars = "MANAGE_ENV_VARS"
+	permissionViewLogs      = "VIEW_LOGS"
+	permissionDeleteProject = "DELETE_PROJECT"
+)
+
+// MembershipLookup returns the permissions of a user on a project, none when
+// they do not belong to it
+type MembershipLookup interface {
+	ProjectPermissions(ctx context.Context, projectID string, caller *Caller) ([]string, error)
+}
+
+type callerContextKey struct{}
+
+// callerFromContext returns the caller stored by requireAuth
+func callerFromContext(ctx context.Context) *Caller {
+	caller, _ := ctx.Value(callerContextKey{}).(*Caller)
+	return caller
+}
+
+// requireAuth rejects requests without a valid bearer token
+func (s *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := extractBearerToken(r)
+		if token == "" {
+			http.Error(w, "Missing bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		caller, err := s.Auth.ValidateToken(r.Context(), token)
+		if err != nil {
+			s.Logger.Warn("Rejected bearer token", "path", r.URL.Path, "error", err)
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+		caller.Token = token
+
+		next(w, r.WithContext(context.WithValue(r.Context(), callerContextKey{}, caller)))
+	}
+}
+
+// authorizeProject checks that the caller holds permission on the project,
+// writing the error response when they do not. The project ID has to be in
+// the form of its namespace already, so the project authorized is always the
+// one acted on.
+func (s *Server) authorizeProject(w http.ResponseWriter, r *http.Request, projectID, permission string) (*Caller, bool) {
+	if namespaceName, err := validateAndSanitize(projectID); err != nil || namespaceName != projectID {
+		http.Error(w, "Invalid Project ID format", http.StatusBadRequest)
+		return nil, false
+	}
+
+	caller := callerFromContext(r.Context())
+	if caller == nil {
+		http.Error(w, "Missing bearer token", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	permissions, err := s.Members.ProjectPermissions(r.Context(), projectID, caller)
+	if err != nil {
+		s.Logger.Error("Failed to look up project permissions", "projectID", projectID, "user", caller.Subject, "error", err)
+		http.Error(w, "Failed to verify project access", http.StatusBadGateway)
+		return nil, false
+	}
+	if !slices.Contains(permissions, permission) {
+		s.Logger.Warn("Denied access to project", "projectID", projectID, "user", caller.Subject, "permission", permission, "path", r.URL.Path)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return caller, true
+}
+
+func extractBearerToken(r *http.Request) string {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
+
+// oidcTokenValidator validates tokens against the userinfo endpoint of the
+// OIDC provider, the same way user-service does
+type oidcTokenValidator struct {
+	userInfoURL string
+	http        *http.Client
+}
+
+func newOIDCTokenValidator(userInfoURL string) *oidcTokenValidator {
+	return &oidcTokenValidator{
+		userInfoURL: userInfoURL,
+		http:        &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (v *oidcTokenValidator) ValidateToken(ctx context.Context, bearerToken string) (*Caller, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.userInfoURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+bearerToken)
+
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("invalid or expired token")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("userinfo returned status %d", resp.StatusCode)
+	}
+
+	var info struct {
+		Sub               string `json:"sub"`
+		Email             string `json:"email"`
+		PreferredUsername string `json:"preferred_username"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if info.Sub == "" {
+		return nil, fmt.Errorf("missing sub claim")
+	}
+
+	return &Caller{
+		Subject:           info.Sub,
+		Email:             info.Email,
+		PreferredUsername: info.PreferredUsername,
+	}, nil
+}
+
+// projectServiceMembership asks project-management-service for the caller's
+// permissions on a project
+type projectServiceMembership struct {
+	baseURL string
+	http    *http.Client
+}
+
+func newProjectServiceMembership(baseURL string) *projectServiceMembership {
+	return &projectServiceMembership{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (m *projectServiceMembership) ProjectPermissions(ctx context.Context, projectID string, caller *Caller) ([]string, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/collaborators/%s/user/%s/permissions",
+		m.baseURL, url.PathEscape(projectID), url.PathEscape(caller.Subject))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+caller.Token)
+
+	resp, err := m.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden {
+		return nil, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("permissions lookup returned status %d", resp.StatusCode)
+	}
+
+	var permissions []string
+	if err := json.NewDecoder(resp.Body).Decode(&permissions); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return permissions, nil
+}
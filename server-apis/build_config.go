@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// Repository-relative paths: no absolute paths, no parent traversal
+	repoPathRegex    = regexp.MustCompile(`^[A-Za-z0-9._][A-Za-z0-9._/-]*$`)
+	buildArgKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	buildTargetRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+const maxBuildArgs = 64
+
+// BuildConfig holds the Kaniko options of a build. It is stored on the WebApp
+// spec under "build" so rebuilds use the same settings.
+type BuildConfig struct {
+	DockerfilePath string            `json:"dockerfilePath,omitempty"` // Relative to the build context, defaults to "Dockerfile"
+	ContextSubPath string            `json:"contextSubPath,omitempty"` // Repository subdirectory to build from
+	BuildArgs      map[string]string `json:"buildArgs,omitempty"`
+	Target         string            `json:"target,omitempty"` // Multi-stage build target
+}
+
+// validate checks the options and normalizes the paths in place
+func (c *BuildConfig) validate() error {
+	if c.DockerfilePath != "" {
+		cleaned, err := cleanRepoPath(c.DockerfilePath)
+		if err != nil {
+			return fmt.Errorf("dockerfilePath: %w", err)
+		}
+		c.DockerfilePath = cleaned
+	}
+
+	if c.ContextSubPath != "" {
+		cleaned, err := cleanRepoPath(c.ContextSubPath)
+		if err != nil {
+			return fmt.Errorf("contextSubPath: %w", err)
+		}
+		if cleaned == "." {
+			cleaned = ""
+		}
+		c.ContextSubPath = cleaned
+	}
+
+	if len(c.BuildArgs) > maxBuildArgs {
+		return fmt.Errorf("buildArgs: at most %d arguments are allowed", maxBuildArgs)
+	}
+	for key, value := range c.BuildArgs {
+		if !buildArgKeyRegex.MatchString(key) {
+			return fmt.Errorf("buildArgs: invalid name %q", key)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("buildArgs: value of %q must be a single line", key)
+		}
+	}
+
+	if c.Target != "" && !buildTargetRegex.MatchString(c.Target) {
+		return fmt.Errorf("target: invalid stage name %q", c.Target)
+	}
+
+	return nil
+}
+
+// kanikoArgs turns the options into Kaniko executor flags
+func (c BuildConfig) kanikoArgs() []string {
+	dockerfile := c.DockerfilePath
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	args := []string{"--dockerfile=" + dockerfile}
+
+	if c.ContextSubPath != "" {
+		args = append(args, "--context-sub-path="+c.ContextSubPath)
+	}
+
+	// Sorted so the same config always yields the same Job
+	keys := make([]string, 0, len(c.BuildArgs))
+	for key := range c.BuildArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, fmt.Sprintf("--build-arg=%s=%s", key, c.BuildArgs[key]))
+	}
+
+	if c.Target != "" {
+		args = append(args, "--target="+c.Target)
+	}
+	return args
+}
+
+// specValue renders the config for the WebApp spec, nil when nothing is set
+func (c BuildConfig) specValue() map[string]interface{} {
+	value := map[string]interface{}{}
+	if c.DockerfilePath != "" {
+		value["dockerfilePath"] = c.DockerfilePath
+	}
+	if c.ContextSubPath != "" {
+		value["contextSubPath"] = c.ContextSubPath
+	}
+	if len(c.BuildArgs) > 0 {
+		buildArgs := make(map[string]interface{}, len(c.BuildArgs))
+		for key, val := range c.BuildArgs {
+			buildArgs[key] = val
+		}
+		value["buildArgs"] = buildArgs
+	}
+	if c.Target != "" {
+		value["target"] = c.Target
+	}
+	if len(value) == 0 {
+		return nil
+	}
+	return value
+}
+
+func cleanRepoPath(p string) (string, error) {
+	if !repoPathRegex.MatchString(p) {
+		return "", fmt.Errorf("%q must be a relative path", p)
+	}
+	cleaned := path.Clean(p)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%q must stay inside the repository", p)
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// How often we look for a new build pod while the Job is still running
+const buildLogsPollInterval = 2 * time.Second
+
+// handleBuildLogs follows the git-clone and Kaniko output of a build as Server-Sent Events.
+// Every log line is sent as a "data" event; when the Job completes a final
+// "end" event carries the BuildStatus and the stream is closed.
+func (s *Server) handleBuildLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, ok := s.lookupBuildJob(w, r, permissionViewLogs)
+	if !ok {
+		return
+	}
+	jobName := job.Name
+
+	// Builds outlive the server WriteTimeout, so lift it for this response
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	ctx := r.Context()
+	followed := make(map[string]bool)
+
+	for {
+		job, err := s.KubeClient.BatchV1().Jobs(buildNamespace).Get(ctx, jobName, metav1.GetOptions{})
+		if err != nil {
+			if ctx.Err() == nil {
+				s.Logger.Error("Failed to get build job", "job", jobName, "error", err)
+				writeEvent(w, "error", "build is no longer available")
+				rc.Flush()
+			}
+			return
+		}
+
+		pods, err := s.listBuildPods(ctx, jobName)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.Logger.Error("Failed to list build pods", "job", jobName, "error", err)
+				writeEvent(w, "error", "failed to read build logs")
+				rc.Flush()
+			}
+			return
+		}
+
+		// Retries of the Job create new pods; follow each attempt in order
+		streamed := false
+		for _, pod := range pods {
+			for _, cs := range buildContainerStatuses(&pod) {
+				key := pod.Name + "/" + cs.Name
+				if followed[key] || (cs.State.Running == nil && cs.State.Terminated == nil) {
+					continue
+				}
+				followed[key] = true
+				streamed = true
+
+				if err := s.streamPodLogs(ctx, w, rc, pod.Name, cs.Name); err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					s.Logger.Error("Failed to stream build logs", "job", jobName, "pod", pod.Name, "container", cs.Name, "error", err)
+				}
+			}
+		}
+		if streamed {
+			continue
+		}
+
+		status, err := s.buildStatus(ctx, job)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.Logger.Error("Failed to resolve build status", "job", jobName, "error", err)
+			}
+			return
+		}
+		if status.Phase == BuildPhaseSucceeded || status.Phase == BuildPhaseFailed {
+			payload, _ := json.Marshal(status)
+			writeEvent(w, "end", string(payload))
+			rc.Flush()
+			return
+		}
+
+		// Keep intermediaries from closing an idle connection while the pod schedules
+		fmt.Fprint(w, ": waiting\n\n")
+		rc.Flush()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(buildLogsPollInterval):
+		}
+	}
+}
+
+// streamPodLogs copies the output of a build container to the client
+// until the container exits or the client goes away.
+func (s *Server) streamPodLogs(ctx context.Context, w http.ResponseWriter, rc *http.ResponseController, podName, container string) error {
+	stream, err := s.KubeClient.CoreV1().Pods(buildNamespace).GetLogs(podName, &corev1.PodLogOptions{
+		Container: container,
+		Follow:    true,
+	}).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		writeEvent(w, "", scanner.Text())
+		if err := rc.Flush(); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// writeEvent writes a single Server-Sent Event; an empty event name sends a plain message
+func writeEvent(w http.ResponseWriter, event, data string) {
+	if event != "" {
+		fmt.Fprintf(w, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", strings.TrimRight(line, "\r"))
+	}
+	fmt.Fprint(w, "\n")
+}
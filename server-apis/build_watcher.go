@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/util/retry"
+)
+
+// Annotations on the CR naming the build its spec.image comes from
+const (
+	deployedBuildAnnotation     = "kleff.io/deployed-build"
+	deployedBuildTimeAnnotation = "kleff.io/deployed-build-time"
+	// Read by the operator into the revision history; also set on build Jobs
+	triggeredByAnnotation = "kleff.io/triggered-by"
+)
+
+// Resyncs retry promotions that failed, e.g. while the API server was unavailable
+const buildWatcherResync = 5 * time.Minute
+
+// buildWatcherBackoff paces the retries of a list or watch that failed
+const buildWatcherBackoff = 5 * time.Second
+
+// watchBuilds follows the Kaniko Jobs and points a WebApp, Worker or CronJob
+// at its new image once the build succeeded. A failed build leaves the
+// running image untouched. The Jobs are listed again every resync, which
+// also picks the watch up after the API server closed it.
+func (s *Server) watchBuilds(ctx context.Context) {
+	go func() {
+		seen := make(map[types.UID]*batchv1.Job)
+		for ctx.Err() == nil {
+			if err := s.followBuildJobs(ctx, seen); err != nil {
+				s.Logger.Warn("Build watch interrupted", "error", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(buildWatcherBackoff):
+				}
+			}
+		}
+	}()
+}
+
+// followBuildJobs lists the build Jobs, then watches them until the resync
+// is due. seen holds the last version of every Job, to tell what changed.
+func (s *Server) followBuildJobs(ctx context.Context, seen map[types.UID]*batchv1.Job) error {
+	jobs := s.KubeClient.BatchV1().Jobs(buildNamespace)
+	selector := "managed-by=paas-backend"
+
+	list, err := jobs.List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return err
+	}
+	listed := make(map[types.UID]bool, len(list.Items))
+	for i := range list.Items {
+		job := &list.Items[i]
+		listed[job.UID] = true
+		s.onBuildJob(ctx, seen[job.UID], job)
+		seen[job.UID] = job
+	}
+	for uid := range seen {
+		if !listed[uid] {
+			delete(seen, uid)
+		}
+	}
+
+	timeout := int64(buildWatcherResync / time.Second)
+	watcher, err := jobs.Watch(ctx, metav1.ListOptions{
+		LabelSelector:   selector,
+		ResourceVersion: list.ResourceVersion,
+		TimeoutSeconds:  &timeout,
+	})
+	if err != nil {
+		return err
+	}
+	defer watcher.Stop()
+
+	for event := range watcher.ResultChan() {
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			if job, ok := event.Object.(*batchv1.Job); ok {
+				s.onBuildJob(ctx, seen[job.UID], job)
+				seen[job.UID] = job
+			}
+		case watch.Deleted:
+			if job, ok := event.Object.(*batchv1.Job); ok {
+				delete(seen, job.UID)
+			}
+		case watch.Error:
+			return k8serrors.FromObject(event.Object)
+		}
+	}
+	return nil
+}
+
+func (s *Server) onBuildJob(ctx context.Context, oldJob, job *batchv1.Job) {
+	if jobHasCondition(job, batchv1.JobFailed) {
+		if oldJob != nil && !jobHasCondition(oldJob, batchv1.JobFailed) {
+			s.Logger.Warn("Build failed, keeping the current image", "job", job.Name, "app", job.Labels["app"])
+		}
+		return
+	}
+	if !jobHasCondition(job, batchv1.JobComplete) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if err := s.promoteBuild(ctx, job); err != nil {
+		s.Logger.Error("Failed to deploy built image", "job", job.Name, "error", err)
+	}
+}
+
+// promoteBuild sets spec.image of the WebApp, Worker or CronJob a successful
+// build belongs to. Builds that finish out of order never replace the image
+// of a newer build.
+func (s *Server) promoteBuild(ctx context.Context, job *batchv1.Job) error {
+	namespace := job.Labels["project-id"]
+	name := job.Labels["app"]
+	image := job.Annotations[buildImageAnnotation]
+	if namespace == "" || name == "" || image == "" {
+		return nil
+	}
+	// Builds started before workers and cronjobs existed have no kind
+	kind, ok := lookupWorkloadKind(job.Labels["workload-kind"])
+	if !ok {
+		return fmt.Errorf("unknown workload kind %q", job.Labels["workload-kind"])
+	}
+
+	commit, err := s.buildCommit(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		webApp, err := s.DynamicClient.Resource(kind.GVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			// The app was removed while it was building
+			if k8serrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+
+		annotations := webApp.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		if deployedAt, err := time.Parse(time.RFC3339, annotations[deployedBuildTimeAnnotation]); err == nil &&
+			!job.CreationTimestamp.Time.After(deployedAt) {
+			return nil
+		}
+
+		if err := unstructured.SetNestedField(webApp.Object, image, "spec", "image"); err != nil {
+			return err
+		}
+		if commit != "" {
+			if err := unstructured.SetNestedField(webApp.Object, commit, "spec", "commit"); err != nil {
+				return err
+			}
+		} else {
+			unstructured.RemoveNestedField(webApp.Object, "spec", "commit")
+		}
+		annotations[deployedBuildAnnotation] = job.Name
+		annotations[triggeredByAnnotation] = job.Annotations[triggeredByAnnotation]
+		annotations[deployedBuildTimeAnnotation] = job.CreationTimestamp.UTC().Format(time.RFC3339)
+		webApp.SetAnnotations(annotations)
+
+		if _, err := s.DynamicClient.Resource(kind.GVR).Namespace(namespace).Update(ctx, webApp, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+
+		s.Logger.Info("Build succeeded, image deployed", "job", job.Name, "app", name, "image", image, "commit", commit)
+		return nil
+	})
+}
+
+// buildCommit returns the commit a build checked out. It is known upfront
+// unless an SSH repository was built from the head of its branch.
+func (s *Server) buildCommit(ctx context.Context, job *batchv1.Job) (string, error) {
+	if commit := job.Annotations[buildCommitAnnotation]; commit != "" {
+		return commit, nil
+	}
+	pods, err := s.listBuildPods(ctx, job.Name)
+	if err != nil {
+		return "", err
+	}
+	return clonedCommit(pods), nil
+}
+
+func jobHasCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == conditionType && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// buildImageAnnotation records the image a Kaniko Job pushes to
+const buildImageAnnotation = "kleff.io/image"
+
+type BuildPhase string
+
+const (
+	BuildPhasePending   BuildPhase = "pending"
+	BuildPhaseRunning   BuildPhase = "running"
+	BuildPhaseSucceeded BuildPhase = "succeeded"
+	BuildPhaseFailed    BuildPhase = "failed"
+)
+
+type BuildStatus struct {
+	JobName     string     `json:"jobName"`
+	ProjectID   string     `json:"projectID"`
+	ContainerID string     `json:"containerID"`
+	Phase       BuildPhase `json:"phase"`
+	Image       string     `json:"image,omitempty"`
+	Commit      string     `json:"commit,omitempty"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+	Reason      string     `json:"reason,omitempty"` // Failure reason from the Job conditions
+	Message     string     `json:"message,omitempty"`
+}
+
+func (s *Server) handleGetBuild(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, ok := s.lookupBuildJob(w, r, permissionReadProject)
+	if !ok {
+		return
+	}
+
+	status, err := s.buildStatus(r.Context(), job)
+	if err != nil {
+		s.Logger.Error("Failed to resolve build status", "job", job.Name, "error", err)
+		http.Error(w, "Failed to get build", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// lookupBuildJob fetches the build Job named in the path once the caller holds
+// permission on its project, writing the error response when it cannot
+func (s *Server) lookupBuildJob(w http.ResponseWriter, r *http.Request, permission string) (*batchv1.Job, bool) {
+	jobName := r.PathValue("jobName")
+	if !validNameRegex.MatchString(jobName) {
+		http.Error(w, "Invalid build name", http.StatusBadRequest)
+		return nil, false
+	}
+
+	job, err := s.KubeClient.BatchV1().Jobs(buildNamespace).Get(r.Context(), jobName, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			http.Error(w, "Build not found", http.StatusNotFound)
+			return nil, false
+		}
+		s.Logger.Error("Failed to get build job", "job", jobName, "error", err)
+		http.Error(w, "Failed to get build", http.StatusInternalServerError)
+		return nil, false
+	}
+	// Only expose Jobs this service created
+	if job.Labels["managed-by"] != "paas-backend" {
+		http.Error(w, "Build not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if _, ok := s.authorizeProject(w, r, job.Labels["project-id"], permission); !ok {
+		return nil, false
+	}
+	return job, true
+}
+
+// handleListBuilds lists the builds of a project, newest first, optionally filtered by containerID
+func (s *Server) handleListBuilds(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	projectID := r.URL.Query().Get("projectID")
+	if projectID == "" {
+		http.Error(w, "projectID is required", http.StatusBadRequest)
+		return
+	}
+	namespaceName, err := validateAndSanitize(projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.authorizeProject(w, r, projectID, permissionReadProject); !ok {
+		return
+	}
+
+	selector := labels.Set{"managed-by": "paas-backend", "project-id": namespaceName}
+	if containerID := r.URL.Query().Get("containerID"); containerID != "" {
+		if errs := validation.IsValidLabelValue(containerID); len(errs) > 0 {
+			http.Error(w, "Invalid Container ID format", http.StatusBadRequest)
+			return
+		}
+		selector["container-id"] = containerID
+	}
+
+	jobs, err := s.KubeClient.BatchV1().Jobs(buildNamespace).List(r.Context(), metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		s.Logger.Error("Failed to list build jobs", "error", err)
+		http.Error(w, "Failed to list builds", http.StatusInternalServerError)
+		return
+	}
+
+	sort.Slice(jobs.Items, func(i, j int) bool {
+		return jobs.Items[j].CreationTimestamp.Before(&jobs.Items[i].CreationTimestamp)
+	})
+
+	builds := make([]BuildStatus, 0, len(jobs.Items))
+	for i := range jobs.Items {
+		status, err := s.buildStatus(r.Context(), &jobs.Items[i])
+		if err != nil {
+			s.Logger.Error("Failed to resolve build status", "job", jobs.Items[i].Name, "error", err)
+			http.Error(w, "Failed to list builds", http.StatusInternalServerError)
+			return
+		}
+		builds = append(builds, *status)
+	}
+
+	writeJSON(w, http.StatusOK, builds)
+}
+
+// buildStatus derives the phase of a build from its Job and, for the details
+// the Job does not carry, from the Kaniko pods it created.
+func (s *Server) buildStatus(ctx context.Context, job *batchv1.Job) (*BuildStatus, error) {
+	status := &BuildStatus{
+		JobName:     job.Name,
+		ProjectID:   job.Labels["project-id"],
+		ContainerID: job.Labels["container-id"],
+		Image:       job.Annotations[buildImageAnnotation],
+		Commit:      job.Annotations[buildCommitAnnotation],
+		Phase:       BuildPhasePending,
+	}
+	if job.Status.StartTime != nil {
+		startedAt := job.Status.StartTime.Time
+		status.StartedAt = &startedAt
+	}
+
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			status.Phase = BuildPhaseSucceeded
+		case batchv1.JobFailed:
+			status.Phase = BuildPhaseFailed
+			status.Reason = cond.Reason
+			status.Message = cond.Message
+		default:
+			continue
+		}
+		finishedAt := cond.LastTransitionTime.Time
+		if job.Status.CompletionTime != nil {
+			finishedAt = job.Status.CompletionTime.Time
+		}
+		status.FinishedAt = &finishedAt
+	}
+
+	if status.Phase == BuildPhaseSucceeded && status.Commit != "" {
+		return status, nil
+	}
+
+	pods, err := s.listBuildPods(ctx, job.Name)
+	if err != nil {
+		return nil, err
+	}
+	if status.Commit == "" {
+		status.Commit = clonedCommit(pods)
+	}
+	if status.Phase == BuildPhaseSucceeded || len(pods) == 0 {
+		return status, nil
+	}
+
+	// The most recent attempt describes the build best
+	latest := pods[len(pods)-1]
+	for _, cs := range buildContainerStatuses(&latest) {
+		if cs.State.Running != nil && status.Phase == BuildPhasePending {
+			status.Phase = BuildPhaseRunning
+		}
+		if waiting := cs.State.Waiting; waiting != nil && status.Reason == "" {
+			status.Reason = waiting.Reason
+			status.Message = waiting.Message
+		}
+		if terminated := cs.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			if status.Reason == "" {
+				status.Reason = terminated.Reason
+			}
+			if terminated.Message != "" {
+				status.Message = strings.TrimSpace(terminated.Message)
+			}
+		}
+	}
+
+	return status, nil
+}
+
+// buildContainerStatuses returns the statuses of the git-clone and kaniko containers, in execution order
+func buildContainerStatuses(pod *corev1.Pod) []corev1.ContainerStatus {
+	var statuses []corev1.ContainerStatus
+	for _, cs := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if cs.Name == "git-clone" || cs.Name == "kaniko" {
+			statuses = append(statuses, cs)
+		}
+	}
+	return statuses
+}
+
+// listBuildPods returns the pods of a build Job, oldest first
+func (s *Server) listBuildPods(ctx context.Context, jobName string) ([]corev1.Pod, error) {
+	pods, err := s.KubeClient.CoreV1().Pods(buildNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set{"job-name": jobName}.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].CreationTimestamp.Before(&pods.Items[j].CreationTimestamp)
+	})
+	return pods.Items, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
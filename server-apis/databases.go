@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+)
+
+var databaseGVR = schema.GroupVersionResource{
+	Group:    "kleff.kleff.io",
+	Version:  "v1",
+	Resource: "databases",
+}
+
+// Upper bound of databases bound to a single app, matches the CRD
+const maxDatabaseBindings = 5
+
+var (
+	databaseVersionRegex = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+	envPrefixRegex       = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+)
+
+// CreateDatabaseRequest provisions a managed database in a project
+type CreateDatabaseRequest struct {
+	DatabaseID       string            `json:"databaseID"`
+	Engine           string            `json:"engine"`            // postgres or redis
+	Version          string            `json:"version,omitempty"` // Optional: 16 for postgres and 7 for redis by default
+	Size             resource.Quantity `json:"size"`              // Data volume such as 1Gi
+	StorageClassName *string           `json:"storageClassName,omitempty"`
+}
+
+// DatabaseDetails is a Database as returned to the frontend. The credentials
+// stay in the Secret named secretName.
+type DatabaseDetails struct {
+	Name       string             `json:"name"`
+	Namespace  string             `json:"namespace"`
+	Engine     string             `json:"engine"`
+	Version    string             `json:"version,omitempty"` // Version the server runs
+	Size       string             `json:"size"`
+	Host       string             `json:"host,omitempty"`
+	Port       int32              `json:"port,omitempty"`
+	SecretName string             `json:"secretName,omitempty"`
+	Conditions []metav1.Condition `json:"conditions"`
+	CreatedAt  metav1.Time        `json:"createdAt"`
+}
+
+// DatabaseBinding mirrors an entry of spec.databases of the WebApp CRD
+type DatabaseBinding struct {
+	Name      string `json:"name"`
+	EnvPrefix string `json:"envPrefix,omitempty"` // Defaults to DATABASE, giving DATABASE_URL and so on
+}
+
+// SetDatabasesRequest replaces the databases bound to a WebApp; an empty list
+// unbinds them all
+type SetDatabasesRequest struct {
+	ProjectID   string `json:"projectID"`
+	ContainerID string `json:"containerID"`
+	Databases   []struct {
+		DatabaseID string `json:"databaseID"`
+		EnvPrefix  string `json:"envPrefix,omitempty"`
+	} `json:"databases"`
+}
+
+// handleDatabases lists the Databases of a project or creates one
+func (s *Server) handleDatabases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	projectID := r.PathValue("projectID")
+	namespaceName, err := validateAndSanitize(projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		if _, ok := s.authorizeProject(w, r, projectID, permissionReadProject); !ok {
+			return
+		}
+		s.listDatabases(w, r, namespaceName)
+		return
+	}
+
+	var req CreateDatabaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.DatabaseID == "" {
+		http.Error(w, "databaseID is required", http.StatusBadRequest)
+		return
+	}
+	if req.Engine != "postgres" && req.Engine != "redis" {
+		http.Error(w, "engine must be postgres or redis", http.StatusBadRequest)
+		return
+	}
+	if req.Version != "" && !databaseVersionRegex.MatchString(req.Version) {
+		http.Error(w, "version must be a number such as 16 or 7.2", http.StatusBadRequest)
+		return
+	}
+	if req.Size.Sign() <= 0 {
+		http.Error(w, "size must be a positive quantity such as 1Gi", http.StatusBadRequest)
+		return
+	}
+	if req.Size.Cmp(maxVolumeSize) > 0 {
+		http.Error(w, fmt.Sprintf("size must not exceed %s", maxVolumeSize.String()), http.StatusBadRequest)
+		return
+	}
+	rawUUID, err := validateAndSanitize(req.DatabaseID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Database ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	resourceName := "db-" + rawUUID
+
+	if _, ok := s.authorizeProject(w, r, projectID, permissionDeploy); !ok {
+		return
+	}
+
+	if _, err := s.createNamespace(r.Context(), namespaceName); err != nil {
+		s.Logger.Error("Failed to create namespace", "namespace", namespaceName, "error", err)
+		http.Error(w, "Failed to create Database", http.StatusInternalServerError)
+		return
+	}
+
+	spec := map[string]interface{}{
+		"engine": req.Engine,
+		"size":   req.Size.String(),
+	}
+	if req.Version != "" {
+		spec["version"] = req.Version
+	}
+	if req.StorageClassName != nil {
+		spec["storageClassName"] = *req.StorageClassName
+	}
+	database := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "kleff.kleff.io/v1",
+			"kind":       "Database",
+			"metadata": map[string]interface{}{
+				"name":      resourceName,
+				"namespace": namespaceName,
+				"labels": map[string]interface{}{
+					"database-id": req.DatabaseID,
+				},
+			},
+			"spec": spec,
+		},
+	}
+
+	_, err = s.DynamicClient.Resource(databaseGVR).Namespace(namespaceName).Create(r.Context(), database, metav1.CreateOptions{})
+	if err != nil {
+		if k8serrors.IsAlreadyExists(err) {
+			http.Error(w, "Database already exists", http.StatusConflict)
+			return
+		}
+		s.Logger.Error("Failed to create Database", "namespace", namespaceName, "resourceName", resourceName, "error", err)
+		http.Error(w, "Failed to create Database", http.StatusInternalServerError)
+		return
+	}
+
+	s.Logger.Info("Database created", "namespace", namespaceName, "resourceName", resourceName, "engine", req.Engine)
+
+	writeJSON(w, http.StatusCreated, Response{
+		Namespace: namespaceName,
+		AppName:   resourceName,
+		Message:   fmt.Sprintf("%s database is being provisioned", req.Engine),
+	})
+}
+
+func (s *Server) listDatabases(w http.ResponseWriter, r *http.Request, namespace string) {
+	databases, err := s.DynamicClient.Resource(databaseGVR).Namespace(namespace).List(r.Context(), metav1.ListOptions{})
+	if err != nil {
+		s.Logger.Error("Failed to list Databases", "namespace", namespace, "error", err)
+		http.Error(w, "Failed to list Databases", http.StatusInternalServerError)
+		return
+	}
+
+	sort.Slice(databases.Items, func(i, j int) bool {
+		return databases.Items[i].GetName() < databases.Items[j].GetName()
+	})
+
+	result := make([]DatabaseDetails, 0, len(databases.Items))
+	for i := range databases.Items {
+		details, err := databaseDetails(&databases.Items[i])
+		if err != nil {
+			s.Logger.Error("Skipping Database with unreadable spec", "namespace", namespace, "name", databases.Items[i].GetName(), "error", err)
+			continue
+		}
+		result = append(result, *details)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func databaseDetails(database *unstructured.Unstructured) (*DatabaseDetails, error) {
+	var parsed struct {
+		Spec struct {
+			Engine  string            `json:"engine"`
+			Version string            `json:"version"`
+			Size    resource.Quantity `json:"size"`
+		} `json:"spec"`
+		Status struct {
+			Conditions []metav1.Condition `json:"conditions"`
+			Version    string             `json:"version"`
+			SecretName string             `json:"secretName"`
+			Host       string             `json:"host"`
+			Port       int32              `json:"port"`
+		} `json:"status"`
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(database.Object, &parsed); err != nil {
+		return nil, err
+	}
+
+	details := &DatabaseDetails{
+		Name:       database.GetName(),
+		Namespace:  database.GetNamespace(),
+		Engine:     parsed.Spec.Engine,
+		Version:    parsed.Status.Version,
+		Size:       parsed.Spec.Size.String(),
+		Host:       parsed.Status.Host,
+		Port:       parsed.Status.Port,
+		SecretName: parsed.Status.SecretName,
+		Conditions: parsed.Status.Conditions,
+		CreatedAt:  database.GetCreationTimestamp(),
+	}
+	if details.Conditions == nil {
+		details.Conditions = []metav1.Condition{}
+	}
+	return details, nil
+}
+
+// handleDeleteDatabase removes a Database CR along with its data. It refuses
+// while a WebApp is bound to it.
+func (s *Server) handleDeleteDatabase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	projectID := r.PathValue("projectID")
+	namespaceName, err := validateAndSanitize(projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	rawUUID, err := validateAndSanitize(r.PathValue("databaseID"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Database ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	resourceName := "db-" + rawUUID
+
+	if _, ok := s.authorizeProject(w, r, projectID, permissionWriteProject); !ok {
+		return
+	}
+
+	boundTo, err := s.databaseUsers(r.Context(), namespaceName, resourceName)
+	if err != nil {
+		s.Logger.Error("Failed to list database users", "namespace", namespaceName, "error", err)
+		http.Error(w, "Failed to delete Database", http.StatusInternalServerError)
+		return
+	}
+	if len(boundTo) > 0 {
+		http.Error(w, fmt.Sprintf("Database is bound to %d app(s), worker(s) or cron job(s); unbind it first", len(boundTo)), http.StatusConflict)
+		return
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	err = s.DynamicClient.Resource(databaseGVR).Namespace(namespaceName).Delete(r.Context(), resourceName, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			http.Error(w, "Database not found", http.StatusNotFound)
+			return
+		}
+		s.Logger.Error("Failed to delete Database", "namespace", namespaceName, "resourceName", resourceName, "error", err)
+		http.Error(w, "Failed to delete Database", http.StatusInternalServerError)
+		return
+	}
+
+	s.Logger.Info("Database deleted", "namespace", namespaceName, "resourceName", resourceName)
+
+	writeJSON(w, http.StatusOK, Response{
+		Namespace: namespaceName,
+		AppName:   resourceName,
+		Message:   "Database deleted",
+	})
+}
+
+// databaseUsers returns the WebApps, Workers and CronJobs bound to a Database
+func (s *Server) databaseUsers(ctx context.Context, namespace, name string) ([]string, error) {
+	var users []string
+	for _, kindName := range workloadKindNames {
+		workloads, err := s.DynamicClient.Resource(workloadKinds[kindName].GVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, workload := range workloads.Items {
+			bindings, _, _ := unstructured.NestedSlice(workload.Object, "spec", "databases")
+			for _, binding := range bindings {
+				if entry, ok := binding.(map[string]interface{}); ok && entry["name"] == name {
+					users = append(users, workload.GetName())
+					break
+				}
+			}
+		}
+	}
+	return users, nil
+}
+
+// errUnknownDatabase is returned when a binding names a Database that does not exist
+var errUnknownDatabase = errors.New("unknown database")
+
+// handleSetDatabases binds Databases to a WebApp. The operator injects their
+// connection details as <envPrefix>_URL, _HOST, _PORT, _USER, _PASSWORD and
+// _NAME.
+func (s *Server) handleSetDatabases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SetDatabasesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if req.ProjectID == "" || req.ContainerID == "" {
+		http.Error(w, "projectID and containerID are required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Databases) > maxDatabaseBindings {
+		http.Error(w, fmt.Sprintf("at most %d databases can be bound", maxDatabaseBindings), http.StatusBadRequest)
+		return
+	}
+
+	bindings := make([]DatabaseBinding, 0, len(req.Databases))
+	names := make(map[string]bool, len(req.Databases))
+	prefixes := make(map[string]bool, len(req.Databases))
+	for _, entry := range req.Databases {
+		rawUUID, err := validateAndSanitize(entry.DatabaseID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid Database ID format: %v", err), http.StatusBadRequest)
+			return
+		}
+		prefix := entry.EnvPrefix
+		if prefix == "" {
+			prefix = "DATABASE"
+		}
+		if !envPrefixRegex.MatchString(prefix) || len(prefix) > 50 {
+			http.Error(w, fmt.Sprintf("Invalid envPrefix %q", entry.EnvPrefix), http.StatusBadRequest)
+			return
+		}
+		binding := DatabaseBinding{Name: "db-" + rawUUID, EnvPrefix: entry.EnvPrefix}
+		if names[binding.Name] || prefixes[prefix] {
+			http.Error(w, "every database must be bound once and with its own envPrefix", http.StatusBadRequest)
+			return
+		}
+		names[binding.Name], prefixes[prefix] = true, true
+		bindings = append(bindings, binding)
+	}
+
+	namespaceName, err := validateAndSanitize(req.ProjectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	rawUUID, err := validateAndSanitize(req.ContainerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Container ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	resourceName := "app-" + rawUUID
+
+	if _, ok := s.authorizeProject(w, r, req.ProjectID, permissionDeploy); !ok {
+		return
+	}
+
+	if err := s.setDatabases(r.Context(), namespaceName, resourceName, bindings); err != nil {
+		switch {
+		case errors.Is(err, errUnknownDatabase):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case k8serrors.IsNotFound(err):
+			http.Error(w, "WebApp not found", http.StatusNotFound)
+		default:
+			s.Logger.Error("Failed to bind databases", "resourceName", resourceName, "error", err)
+			http.Error(w, "Failed to bind databases", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.Logger.Info("Databases bound", "resourceName", resourceName, "databases", len(bindings))
+
+	writeJSON(w, http.StatusOK, Response{
+		Namespace: namespaceName,
+		AppName:   resourceName,
+		Message:   fmt.Sprintf("%d database(s) bound", len(bindings)),
+	})
+}
+
+func (s *Server) setDatabases(ctx context.Context, namespace, name string, bindings []DatabaseBinding) error {
+	for _, binding := range bindings {
+		_, err := s.DynamicClient.Resource(databaseGVR).Namespace(namespace).Get(ctx, binding.Name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return fmt.Errorf("%w %s", errUnknownDatabase, binding.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		webApp, err := s.DynamicClient.Resource(webAppGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if len(bindings) == 0 {
+			unstructured.RemoveNestedField(webApp.Object, "spec", "databases")
+		} else {
+			value := make([]interface{}, len(bindings))
+			for i := range bindings {
+				item, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&bindings[i])
+				if err != nil {
+					return err
+				}
+				value[i] = item
+			}
+			if err := unstructured.SetNestedSlice(webApp.Object, value, "spec", "databases"); err != nil {
+				return err
+			}
+		}
+
+		_, err = s.DynamicClient.Resource(webAppGVR).Namespace(namespace).Update(ctx, webApp, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// buildCommitAnnotation records the commit a Kaniko Job builds
+	buildCommitAnnotation = "kleff.io/commit"
+	// imageRevisionLabel carries the commit on the pushed image
+	imageRevisionLabel = "org.opencontainers.image.revision"
+)
+
+// Kaniko only checks out full SHA-1 object names
+var commitRegex = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Carrier-grade NAT addresses are not covered by netip.Addr.IsPrivate
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicGitClient only connects to public addresses over HTTPS, checked on
+// the address dialed so a hostname cannot resolve into the cluster network
+var publicGitClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				addrPort, err := netip.ParseAddrPort(address)
+				if err != nil {
+					return err
+				}
+				if !isPublicAddr(addrPort.Addr()) {
+					return fmt.Errorf("%s is not a public address", addrPort.Addr())
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" {
+			return errors.New("redirected away from HTTPS")
+		}
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		return nil
+	},
+}
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// resolveCommit asks an HTTPS Git server which commit a branch points to, or
+// HEAD when no branch is given. secret is the basic-auth Secret of private
+// repositories and nil for public ones. Plain HTTP and servers on internal
+// addresses are refused, so neither the credentials nor the request leak.
+func resolveCommit(ctx context.Context, repoURL, branch string, secret *corev1.Secret) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	base := strings.TrimSuffix(repoURL, "/")
+	if rest, ok := strings.CutPrefix(base, "git://"); ok {
+		base = "https://" + rest
+	} else if strings.HasPrefix(base, "http://") {
+		return "", fmt.Errorf("only HTTPS repositories can be resolved")
+	} else if !strings.HasPrefix(base, "https://") {
+		base = "https://" + base
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/info/refs?service=git-upload-pack", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "git/2.0 (kleff)")
+	if secret != nil {
+		req.SetBasicAuth(string(secret.Data[corev1.BasicAuthUsernameKey]), string(secret.Data[corev1.BasicAuthPasswordKey]))
+	}
+
+	resp, err := publicGitClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("repository returned %s", resp.Status)
+	}
+
+	want := "HEAD"
+	if branch != "" {
+		want = "refs/heads/" + branch
+	}
+
+	refs, err := readRefAdvertisement(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return "", err
+	}
+	sha, ok := refs[want]
+	if !ok {
+		if branch == "" {
+			return "", fmt.Errorf("repository has no default branch")
+		}
+		return "", fmt.Errorf("branch %q not found", branch)
+	}
+	return sha, nil
+}
+
+// readRefAdvertisement parses the pkt-line ref listing of the smart HTTP
+// protocol into a map of ref name to commit.
+func readRefAdvertisement(r io.Reader) (map[string]string, error) {
+	refs := make(map[string]string)
+	br := bufio.NewReader(r)
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			if err == io.EOF {
+				return refs, nil
+			}
+			return nil, fmt.Errorf("invalid ref advertisement: %w", err)
+		}
+		length, err := strconv.ParseUint(string(header), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ref advertisement: %w", err)
+		}
+		// Flush packets separate the service announcement from the refs
+		if length < 4 {
+			continue
+		}
+
+		line := make([]byte, length-4)
+		if _, err := io.ReadFull(br, line); err != nil {
+			return nil, fmt.Errorf("invalid ref advertisement: %w", err)
+		}
+
+		// "<sha> <ref>", the first ref followed by "\x00<capabilities>"
+		text := strings.TrimSuffix(string(line), "\n")
+		text, _, _ = strings.Cut(text, "\x00")
+		sha, ref, ok := strings.Cut(text, " ")
+		if ok && commitRegex.MatchString(sha) {
+			refs[ref] = sha
+		}
+	}
+}
+
+// clonedCommit reads the commit the git-clone init container checked out from
+// its termination message, for SSH builds whose commit was not pinned upfront.
+func clonedCommit(pods []corev1.Pod) string {
+	for i := len(pods) - 1; i >= 0; i-- {
+		for _, cs := range pods[i].Status.InitContainerStatuses {
+			if cs.Name != "git-clone" || cs.State.Terminated == nil || cs.State.Terminated.ExitCode != 0 {
+				continue
+			}
+			if sha := strings.TrimSpace(cs.State.Terminated.Message); commitRegex.MatchString(sha) {
+				return sha
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Matches scp-like SSH remotes such as git@github.com:org/repo.git
+var scpLikeRepoRegex = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:`)
+
+// GitCredentialsRequest stores credentials for private repositories of a project.
+// Exactly one of Token (HTTPS) or SSHPrivateKey (deploy key) must be set.
+type GitCredentialsRequest struct {
+	ProjectID     string `json:"projectID"`
+	Name          string `json:"name"`               // Referenced by BuildRequest.GitCredentials
+	Username      string `json:"username,omitempty"` // HTTPS user, defaults to "git"
+	Token         string `json:"token,omitempty"`
+	SSHPrivateKey string `json:"sshPrivateKey,omitempty"`
+}
+
+// gitCredentialsSecretName maps a credentials name to its Secret in the project namespace
+func gitCredentialsSecretName(name string) string {
+	return "git-" + name
+}
+
+// validateGitCredentialsName sanitizes a credentials name. "webhook" is
+// refused, its Secret would be the webhook key of the project.
+func validateGitCredentialsName(name string) (string, error) {
+	credentialsName, err := validateAndSanitize(name)
+	if err != nil {
+		return "", err
+	}
+	if gitCredentialsSecretName(credentialsName) == gitWebhookSecretName {
+		return "", fmt.Errorf("%q is reserved", credentialsName)
+	}
+	return credentialsName, nil
+}
+
+// isSSHRepoURL reports whether a repository has to be cloned over SSH
+func isSSHRepoURL(repoURL string) bool {
+	return strings.HasPrefix(repoURL, "ssh://") || scpLikeRepoRegex.MatchString(repoURL)
+}
+
+// handleSaveGitCredentials creates or replaces a per-project Git credentials Secret.
+// The token or key is never echoed back.
+func (s *Server) handleSaveGitCredentials(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 65536)
+
+	var req GitCredentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if req.ProjectID == "" || req.Name == "" {
+		http.Error(w, "projectID and name are required", http.StatusBadRequest)
+		return
+	}
+	if (req.Token == "") == (req.SSHPrivateKey == "") {
+		http.Error(w, "exactly one of token or sshPrivateKey is required", http.StatusBadRequest)
+		return
+	}
+
+	namespaceName, err := validateAndSanitize(req.ProjectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	credentialsName, err := validateGitCredentialsName(req.Name)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid credentials name: %v", err), http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.authorizeProject(w, r, req.ProjectID, permissionWriteProject); !ok {
+		return
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gitCredentialsSecretName(credentialsName),
+			Namespace: namespaceName,
+			Labels: map[string]string{
+				"managed-by":      "paas-backend",
+				"git-credentials": credentialsName,
+			},
+		},
+	}
+	if req.Token != "" {
+		username := req.Username
+		if username == "" {
+			username = "git"
+		}
+		secret.Type = corev1.SecretTypeBasicAuth
+		secret.StringData = map[string]string{
+			corev1.BasicAuthUsernameKey: username,
+			corev1.BasicAuthPasswordKey: req.Token,
+		}
+	} else {
+		secret.Type = corev1.SecretTypeSSHAuth
+		secret.StringData = map[string]string{
+			corev1.SSHAuthPrivateKey: strings.TrimSpace(req.SSHPrivateKey) + "\n",
+		}
+	}
+
+	if _, err := s.createNamespace(r.Context(), namespaceName); err != nil {
+		s.Logger.Error("Failed to create namespace", "namespace", namespaceName, "error", err)
+		http.Error(w, "Failed to initialize environment", http.StatusInternalServerError)
+		return
+	}
+
+	secrets := s.KubeClient.CoreV1().Secrets(namespaceName)
+	_, err = secrets.Create(r.Context(), secret, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		// The type of a Secret is immutable, so switching between token and key means replacing it
+		if err = secrets.Delete(r.Context(), secret.Name, metav1.DeleteOptions{}); err == nil {
+			_, err = secrets.Create(r.Context(), secret, metav1.CreateOptions{})
+		}
+	}
+	if err != nil {
+		s.Logger.Error("Failed to store git credentials", "namespace", namespaceName, "name", credentialsName, "error", err)
+		http.Error(w, "Failed to store git credentials", http.StatusInternalServerError)
+		return
+	}
+
+	s.Logger.Info("Git credentials stored", "namespace", namespaceName, "name", credentialsName, "type", secret.Type)
+
+	writeJSON(w, http.StatusOK, Response{
+		Namespace: namespaceName,
+		Message:   fmt.Sprintf("Git credentials %q stored", credentialsName),
+	})
+}
+
+// copyGitCredentials copies a project's Git credentials into the build namespace,
+// since the Kaniko pod can only reference Secrets from its own namespace.
+// The copy is named after the build Job and removed together with it.
+func (s *Server) copyGitCredentials(ctx context.Context, projectNamespace, credentialsName, jobName, repoURL string) (*corev1.Secret, error) {
+	source, err := s.KubeClient.CoreV1().Secrets(projectNamespace).Get(ctx, gitCredentialsSecretName(credentialsName), metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, fmt.Errorf("git credentials %q not found", credentialsName)
+		}
+		return nil, err
+	}
+
+	wantType := corev1.SecretTypeBasicAuth
+	if isSSHRepoURL(repoURL) {
+		wantType = corev1.SecretTypeSSHAuth
+	}
+	if source.Type != wantType {
+		return nil, fmt.Errorf("git credentials %q cannot be used with %s", credentialsName, repoURL)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName + "-git",
+			Namespace: buildNamespace,
+			Labels: map[string]string{
+				"managed-by": "paas-backend",
+				"project-id": projectNamespace,
+			},
+		},
+		Type: source.Type,
+		Data: source.Data,
+	}
+
+	return s.KubeClient.CoreV1().Secrets(buildNamespace).Create(ctx, secret, metav1.CreateOptions{})
+}
+
+// ownGitCredentials hands the copied credentials over to the build Job so they
+// are garbage collected when the Job's TTL expires.
+func (s *Server) ownGitCredentials(ctx context.Context, secret *corev1.Secret, job *batchv1.Job) error {
+	secret.OwnerReferences = []metav1.OwnerReference{
+		*metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job")),
+	}
+	_, err := s.KubeClient.CoreV1().Secrets(buildNamespace).Update(ctx, secret, metav1.UpdateOptions{})
+	return err
+}
+
+// Push webhooks of a project are verified with a key of its own, kept next to
+// its Git credentials, so one project cannot trigger builds of another
+const (
+	gitWebhookSecretName = "git-webhook"
+	gitWebhookSecretKey  = "secret"
+)
+
+// GitWebhookRequest generates a new webhook key for a project, replacing the
+// previous one
+type GitWebhookRequest struct {
+	ProjectID string `json:"projectID"`
+}
+
+// GitWebhookResponse is the only time the webhook key is returned
+type GitWebhookResponse struct {
+	Namespace string `json:"namespace"`
+	Path      string `json:"path"`   // Payload URL of the webhook, relative to the API
+	Secret    string `json:"secret"` // Secret (GitHub, Gitea) or secret token (GitLab) of the webhook
+	Message   string `json:"message"`
+}
+
+// handleRotateGitWebhook creates or replaces the key push webhooks of a
+// project are signed with
+func (s *Server) handleRotateGitWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 65536)
+
+	var req GitWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.ProjectID == "" {
+		http.Error(w, "projectID is required", http.StatusBadRequest)
+		return
+	}
+
+	namespaceName, err := validateAndSanitize(req.ProjectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.authorizeProject(w, r, req.ProjectID, permissionWriteProject); !ok {
+		return
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		s.Logger.Error("Failed to generate webhook secret", "error", err)
+		http.Error(w, "Failed to generate webhook secret", http.StatusInternalServerError)
+		return
+	}
+	webhookSecret := hex.EncodeToString(key)
+
+	if _, err := s.createNamespace(r.Context(), namespaceName); err != nil {
+		s.Logger.Error("Failed to create namespace", "namespace", namespaceName, "error", err)
+		http.Error(w, "Failed to initialize environment", http.StatusInternalServerError)
+		return
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gitWebhookSecretName,
+			Namespace: namespaceName,
+			Labels:    map[string]string{"managed-by": "paas-backend"},
+		},
+		Type:       corev1.SecretTypeOpaque,
+		StringData: map[string]string{gitWebhookSecretKey: webhookSecret},
+	}
+	secrets := s.KubeClient.CoreV1().Secrets(namespaceName)
+	_, err = secrets.Create(r.Context(), secret, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		_, err = secrets.Update(r.Context(), secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		s.Logger.Error("Failed to store webhook secret", "namespace", namespaceName, "error", err)
+		http.Error(w, "Failed to store webhook secret", http.StatusInternalServerError)
+		return
+	}
+
+	s.Logger.Info("Git webhook secret rotated", "namespace", namespaceName)
+
+	writeJSON(w, http.StatusOK, GitWebhookResponse{
+		Namespace: namespaceName,
+		Path:      "/api/v1/webhooks/git/" + namespaceName,
+		Secret:    webhookSecret,
+		Message:   "Webhook secret generated, the previous one no longer verifies pushes",
+	})
+}
+
+// gitWebhookSecret reads the webhook key of a project, empty when none was generated
+func (s *Server) gitWebhookSecret(ctx context.Context, namespace string) (string, error) {
+	secret, err := s.KubeClient.CoreV1().Secrets(namespace).Get(ctx, gitWebhookSecretName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(secret.Data[gitWebhookSecretKey]), nil
+}
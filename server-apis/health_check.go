@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// HealthCheck mirrors spec.healthCheck of the WebApp CRD. The operator maps
+// it to the readiness, liveness and startup probes of the app.
+type HealthCheck struct {
+	Type                  string   `json:"type,omitempty"` // http or tcp, defaults to http when path is set
+	Path                  string   `json:"path,omitempty"`
+	Port                  *int32   `json:"port,omitempty"` // Defaults to the app port
+	InitialDelaySeconds   *int32   `json:"initialDelaySeconds,omitempty"`
+	PeriodSeconds         *int32   `json:"periodSeconds,omitempty"`
+	TimeoutSeconds        *int32   `json:"timeoutSeconds,omitempty"`
+	SuccessThreshold      *int32   `json:"successThreshold,omitempty"`
+	FailureThreshold      *int32   `json:"failureThreshold,omitempty"`
+	StartupTimeoutSeconds *int32   `json:"startupTimeoutSeconds,omitempty"` // How long the app may take to boot
+	Probes                []string `json:"probes,omitempty"`                // readiness, liveness and/or startup, all by default
+}
+
+// validate rejects what the CRD would, so the error reaches the caller
+// instead of failing the WebApp update
+func (h *HealthCheck) validate() error {
+	switch h.Type {
+	case "", "tcp":
+	case "http":
+		if h.Path == "" {
+			return fmt.Errorf("path is required for http health checks")
+		}
+	default:
+		return fmt.Errorf("type must be http or tcp")
+	}
+	if h.Path != "" && (!strings.HasPrefix(h.Path, "/") || len(h.Path) > 1024) {
+		return fmt.Errorf("path must start with / and be at most 1024 characters")
+	}
+	if h.Port != nil && (*h.Port < 1 || *h.Port > 65535) {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+	if h.InitialDelaySeconds != nil && *h.InitialDelaySeconds < 0 {
+		return fmt.Errorf("initialDelaySeconds must not be negative")
+	}
+
+	positive := map[string]*int32{
+		"periodSeconds":         h.PeriodSeconds,
+		"timeoutSeconds":        h.TimeoutSeconds,
+		"successThreshold":      h.SuccessThreshold,
+		"failureThreshold":      h.FailureThreshold,
+		"startupTimeoutSeconds": h.StartupTimeoutSeconds,
+	}
+	for field, value := range positive {
+		if value != nil && *value < 1 {
+			return fmt.Errorf("%s must be at least 1", field)
+		}
+	}
+
+	for i, probe := range h.Probes {
+		if probe != "readiness" && probe != "liveness" && probe != "startup" {
+			return fmt.Errorf("unknown probe %q", probe)
+		}
+		if slices.Contains(h.Probes[:i], probe) {
+			return fmt.Errorf("probe %q is listed twice", probe)
+		}
+	}
+	return nil
+}
+
+// specValue renders the health check for the WebApp spec
+func (h *HealthCheck) specValue() (map[string]interface{}, error) {
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(h)
+}
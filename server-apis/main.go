@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -28,38 +29,63 @@ import (
 
 // Server holds dependencies to avoid global state
 type Server struct {
-	KubeClient    kubernetes.Interface
-	DynamicClient dynamic.Interface
-	Logger        *slog.Logger
-	RegistryBase  string // Will default to "kleff.azurecr.io"
+	KubeClient     kubernetes.Interface
+	DynamicClient  dynamic.Interface
+	Logger         *slog.Logger
+	RegistryBase   string // Will default to "kleff.azurecr.io"
+	Auth           TokenValidator
+	Members        MembershipLookup
+	AllowedOrigins map[string]bool // CORS allow-list
 }
 
 type BuildRequest struct {
-	ContainerID  string            `json:"containerID"`
-	ProjectID    string            `json:"projectID"`
-	Name         string            `json:"name"`    // App name
-	RepoURL      string            `json:"repoUrl"` // Source Git URL
-	Branch       string            `json:"branch"`  // Git Branch
-	Port         int               `json:"port"`    // Optional: App Port
-	EnvVariables map[string]string `json:"envVariables,omitempty"` // Environment variables
+	Kind           string            `json:"kind,omitempty"` // Optional: webapp, worker or cronjob, defaults to webapp
+	ContainerID    string            `json:"containerID"`
+	ProjectID      string            `json:"projectID"`
+	Name           string            `json:"name"`                     // App name
+	RepoURL        string            `json:"repoUrl"`                  // Source Git URL
+	Branch         string            `json:"branch"`                   // Git Branch
+	Commit         string            `json:"commit,omitempty"`         // Optional: full commit SHA to build, defaults to the head of the branch
+	Port           int               `json:"port"`                     // Optional: App Port
+	Plan           string            `json:"plan,omitempty"`           // Optional: resource plan such as small, medium or large
+	EnvVariables   map[string]string `json:"envVariables,omitempty"`   // Environment variables
+	SecretEnv      map[string]string `json:"secretEnv,omitempty"`      // Optional: sensitive variables, kept in a Secret and never echoed
+	GitCredentials string            `json:"gitCredentials,omitempty"` // Optional: project Git credentials name, for private repos
+	HealthCheck    *HealthCheck      `json:"healthCheck,omitempty"`    // Optional: probes of the app, kept as is on rebuilds when omitted
+	Strategy       *Strategy         `json:"strategy,omitempty"`       // Optional: rolling parameters or blue/green, kept as is on rebuilds when omitted
+	Volumes        []Volume          `json:"volumes,omitempty"`        // Optional: persistent volumes, kept as is on rebuilds when omitted and removed when empty
+	Ports          []AppPort         `json:"ports,omitempty"`          // Optional: gRPC, TCP and UDP ports besides the HTTP one, kept as is on rebuilds when omitted and removed when empty
+	Command        []string          `json:"command,omitempty"`        // Optional, workers and cronjobs: entrypoint override, kept on rebuilds when omitted
+	Args           []string          `json:"args,omitempty"`           // Optional, workers and cronjobs: arguments override, kept on rebuilds when omitted
+	Replicas       *int32            `json:"replicas,omitempty"`       // Optional, workers: number of pods, defaults to 1
+	Cron           *CronSchedule     `json:"cron,omitempty"`           // Cronjobs: schedule of the runs, required on creation
+	TriggeredBy    string            `json:"-"`                        // Authenticated caller or webhook pusher, recorded in the revision history
+	BuildConfig                      // Optional: dockerfilePath, contextSubPath, buildArgs and target
 }
 
 type UpdateWebAppRequest struct {
-	ProjectID    string            `json:"projectID"`
-	ContainerID  string 		   `json:"containerID"`
-	Name         string            `json:"name"`          // App name
-	EnvVariables map[string]string `json:"envVariables"`  // Environment variables
+	ProjectID       string            `json:"projectID"`
+	ContainerID     string            `json:"containerID"`
+	Name            string            `json:"name"`                      // App name
+	EnvVariables    map[string]string `json:"envVariables"`              // Environment variables, replaced as a whole when set
+	SecretEnv       map[string]string `json:"secretEnv,omitempty"`       // Sensitive variables to set, never echoed
+	RemoveSecretEnv []string          `json:"removeSecretEnv,omitempty"` // Names of sensitive variables to remove
 }
 
 type Response struct {
-	Namespace string `json:"namespace"`
-	JobName   string `json:"job_name,omitempty"`
-	AppName   string `json:"app_name,omitempty"`
-	Image     string `json:"image,omitempty"`
-	Message   string `json:"message"`
-	Existed   bool   `json:"existed"`
+	Namespace string   `json:"namespace"`
+	JobName   string   `json:"job_name,omitempty"`
+	AppName   string   `json:"app_name,omitempty"`
+	Image     string   `json:"image,omitempty"`
+	Commit    string   `json:"commit,omitempty"`
+	SecretEnv []string `json:"secretEnv,omitempty"` // Names of the secret variables, without values
+	Message   string   `json:"message"`
+	Existed   bool     `json:"existed"`
 }
 
+// Kaniko build Jobs run in this namespace, next to the registry credentials
+const buildNamespace = "default"
+
 // Regex for DNS-1123 validation
 var validNameRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
 
@@ -88,6 +114,13 @@ func main() {
 	}
 
 	registry := flag.String("registry", defaultRegistry, "The container registry base URL")
+	authentikURL := flag.String("authentik-url", os.Getenv("AUTHENTIK_BASE_URL"), "Base URL of the OIDC provider validating bearer tokens")
+	projectServiceURL := flag.String("project-service-url", os.Getenv("PROJECT_SERVICE_URL"), "Base URL of project-management-service, used to check project membership")
+	defaultOrigins := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if defaultOrigins == "" {
+		defaultOrigins = "https://kleff.io,https://api.kleff.io,http://localhost:5173,http://localhost:8080,http://localhost:3000"
+	}
+	allowedOrigins := flag.String("allowed-origins", defaultOrigins, "Comma-separated origins allowed to call the API from a browser")
 	flag.Parse()
 
 	// Validate Registry
@@ -95,6 +128,18 @@ func main() {
 		logger.Error("Registry configuration missing.")
 		os.Exit(1)
 	}
+	// Every project endpoint is authenticated, so refuse to start without a way to check tokens
+	if *authentikURL == "" || *projectServiceURL == "" {
+		logger.Error("Authentication configuration missing: AUTHENTIK_BASE_URL and PROJECT_SERVICE_URL are required.")
+		os.Exit(1)
+	}
+
+	origins := make(map[string]bool)
+	for _, origin := range strings.Split(*allowedOrigins, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins[origin] = true
+		}
+	}
 
 	config, err := rest.InClusterConfig()
 	if err != nil {
@@ -123,16 +168,44 @@ func main() {
 	cleanRegistry := strings.TrimRight(*registry, "/")
 
 	server := &Server{
-		KubeClient:    clientset,
-		DynamicClient: dynClient,
-		Logger:        logger,
-		RegistryBase:  cleanRegistry,
+		KubeClient:     clientset,
+		DynamicClient:  dynClient,
+		Logger:         logger,
+		RegistryBase:   cleanRegistry,
+		Auth:           newOIDCTokenValidator(strings.TrimRight(*authentikURL, "/") + "/application/o/userinfo/"),
+		Members:        newProjectServiceMembership(*projectServiceURL),
+		AllowedOrigins: origins,
 	}
 
+	// Deploy images as their builds succeed
+	server.watchBuilds(context.Background())
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/api/v1/build/create", enableCors(server.handleCreateBuild))
-	mux.HandleFunc("/api/v1/build/hello", enableCors(server.handleHelloWorld))
-	mux.HandleFunc("/api/v1/webapp/update", enableCors(server.handleUpdateWebApp))
+	mux.HandleFunc("/api/v1/build/create", server.enableCors(server.requireAuth(server.handleCreateBuild)))
+	mux.HandleFunc("/api/v1/build/hello", server.enableCors(server.handleHelloWorld))
+	mux.HandleFunc("/api/v1/webapp/update", server.enableCors(server.requireAuth(server.handleUpdateWebApp)))
+	mux.HandleFunc("/api/v1/webapp/rollback", server.enableCors(server.requireAuth(server.handleRollbackWebApp)))
+	mux.HandleFunc("/api/v1/webapp/scale", server.enableCors(server.requireAuth(server.handleScaleWebApp)))
+	mux.HandleFunc("/api/v1/webapp/domains", server.enableCors(server.requireAuth(server.handleSetDomains)))
+	mux.HandleFunc("/api/v1/webapp/canary", server.enableCors(server.requireAuth(server.handleCanaryAction)))
+	mux.HandleFunc("/api/v1/webapp/databases", server.enableCors(server.requireAuth(server.handleSetDatabases)))
+	mux.HandleFunc("/api/v1/webapp/{projectID}/{containerID}", server.enableCors(server.requireAuth(server.handleDeleteWebApp)))
+	mux.HandleFunc("/api/v1/projects/{projectID}", server.enableCors(server.requireAuth(server.handleDeleteProject)))
+	mux.HandleFunc("/api/v1/projects/{projectID}/webapps", server.enableCors(server.requireAuth(server.handleListWebApps)))
+	mux.HandleFunc("/api/v1/projects/{projectID}/webapps/{containerID}", server.enableCors(server.requireAuth(server.handleGetWebApp)))
+	mux.HandleFunc("/api/v1/projects/{projectID}/webapps/{containerID}/volumes/{volume}", server.enableCors(server.requireAuth(server.handleDeleteVolume)))
+	mux.HandleFunc("/api/v1/projects/{projectID}/databases", server.enableCors(server.requireAuth(server.handleDatabases)))
+	mux.HandleFunc("/api/v1/projects/{projectID}/databases/{databaseID}", server.enableCors(server.requireAuth(server.handleDeleteDatabase)))
+	mux.HandleFunc("/api/v1/projects/{projectID}/workers", server.enableCors(server.requireAuth(server.handleListWorkloads(kindWorker))))
+	mux.HandleFunc("/api/v1/projects/{projectID}/workers/{containerID}", server.enableCors(server.requireAuth(server.handleDeleteWorkload(kindWorker))))
+	mux.HandleFunc("/api/v1/projects/{projectID}/cronjobs", server.enableCors(server.requireAuth(server.handleListWorkloads(kindCronJob))))
+	mux.HandleFunc("/api/v1/projects/{projectID}/cronjobs/{containerID}", server.enableCors(server.requireAuth(server.handleDeleteWorkload(kindCronJob))))
+	mux.HandleFunc("/api/v1/build/{jobName}", server.enableCors(server.requireAuth(server.handleGetBuild)))
+	mux.HandleFunc("/api/v1/build/{jobName}/logs", server.enableCors(server.requireAuth(server.handleBuildLogs)))
+	mux.HandleFunc("/api/v1/builds", server.enableCors(server.requireAuth(server.handleListBuilds)))
+	mux.HandleFunc("/api/v1/git/credentials", server.enableCors(server.requireAuth(server.handleSaveGitCredentials)))
+	mux.HandleFunc("/api/v1/git/webhook", server.enableCors(server.requireAuth(server.handleRotateGitWebhook)))
+	mux.HandleFunc("/api/v1/webhooks/git/{projectID}", server.handleGitWebhook)
 
 		srv := &http.Server{
 		Addr:         ":8080",
@@ -168,18 +241,95 @@ func (s *Server) handleCreateBuild(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	caller, ok := s.authorizeProject(w, r, req.ProjectID, permissionDeploy)
+	if !ok {
+		return
+	}
+	// Recorded in the revision history, never taken from the request body
+	req.TriggeredBy = caller.Name()
+
+	resp, buildErr := s.startBuild(r.Context(), req)
+	if buildErr != nil {
+		http.Error(w, buildErr.Message, buildErr.Status)
+		return
+	}
+
+	// 7. Success Response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// buildError carries the HTTP status and client-facing message of a rejected build
+type buildError struct {
+	Status  int
+	Message string
+}
+
+func (e *buildError) Error() string { return e.Message }
+
+// startBuild submits the Kaniko Job for a build request and syncs the WebApp,
+// Worker or CronJob CR it deploys to.
+// It is shared by the build API and the Git webhooks.
+func (s *Server) startBuild(ctx context.Context, req BuildRequest) (*Response, *buildError) {
 	// 1. Validation
 	if req.ProjectID == "" || req.ContainerID == "" || req.RepoURL == "" {
-		http.Error(w, "projectID, containerID, and repoUrl are required", http.StatusBadRequest)
-		return
+		return nil, &buildError{http.StatusBadRequest, "projectID, containerID, and repoUrl are required"}
+	}
+	if isSSHRepoURL(req.RepoURL) && req.GitCredentials == "" {
+		return nil, &buildError{http.StatusBadRequest, "gitCredentials are required for SSH repository URLs"}
+	}
+	if strings.HasPrefix(req.RepoURL, "http://") && req.GitCredentials != "" {
+		return nil, &buildError{http.StatusBadRequest, "gitCredentials require an HTTPS or SSH repository URL"}
+	}
+	req.Commit = strings.ToLower(strings.TrimSpace(req.Commit))
+	if req.Commit != "" && !commitRegex.MatchString(req.Commit) {
+		return nil, &buildError{http.StatusBadRequest, "commit must be a full 40 character SHA"}
+	}
+	if err := validateSecretEnv(req.SecretEnv, nil, req.EnvVariables); err != nil {
+		return nil, &buildError{http.StatusBadRequest, fmt.Sprintf("Invalid secretEnv: %v", err)}
+	}
+	if req.Plan != "" && !validNameRegex.MatchString(req.Plan) {
+		return nil, &buildError{http.StatusBadRequest, "Invalid plan name"}
+	}
+	if err := req.BuildConfig.validate(); err != nil {
+		return nil, &buildError{http.StatusBadRequest, fmt.Sprintf("Invalid build configuration: %v", err)}
+	}
+	if req.HealthCheck != nil {
+		if err := req.HealthCheck.validate(); err != nil {
+			return nil, &buildError{http.StatusBadRequest, fmt.Sprintf("Invalid healthCheck: %v", err)}
+		}
+	}
+	if req.Strategy != nil {
+		if err := req.Strategy.validate(); err != nil {
+			return nil, &buildError{http.StatusBadRequest, fmt.Sprintf("Invalid strategy: %v", err)}
+		}
+	}
+	if err := validateVolumes(req.Volumes); err != nil {
+		return nil, &buildError{http.StatusBadRequest, fmt.Sprintf("Invalid volumes: %v", err)}
+	}
+	httpPort := req.Port
+	if httpPort == 0 {
+		httpPort = 8080
+	}
+	if err := validatePorts(req.Ports, httpPort); err != nil {
+		return nil, &buildError{http.StatusBadRequest, fmt.Sprintf("Invalid ports: %v", err)}
+	}
+	kind, ok := lookupWorkloadKind(req.Kind)
+	if !ok {
+		return nil, &buildError{http.StatusBadRequest, "kind must be webapp, worker or cronjob"}
+	}
+	if req.Kind == "" {
+		req.Kind = kindWebApp
+	}
+	if err := validateWorkload(req.Kind, req); err != nil {
+		return nil, &buildError{http.StatusBadRequest, err.Error()}
 	}
 
 	// 2. Sanitize IDs
 	// Namespace Name = Project ID
 	namespaceName, err := validateAndSanitize(req.ProjectID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
-		return
+		return nil, &buildError{http.StatusBadRequest, fmt.Sprintf("Invalid Project ID format: %v", err)}
 	}
 
 	// SANITIZATION LOGIC:
@@ -187,10 +337,29 @@ func (s *Server) handleCreateBuild(w http.ResponseWriter, r *http.Request) {
 	// resourceName is the name for K8s objects (e.g. "app-68af67d3...")
 	rawUUID, err := validateAndSanitize(req.ContainerID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid Container ID format: %v", err), http.StatusBadRequest)
-		return
+		return nil, &buildError{http.StatusBadRequest, fmt.Sprintf("Invalid Container ID format: %v", err)}
+	}
+	resourceName := kind.Prefix + rawUUID
+
+	if err := s.checkEnvConflicts(ctx, kind, namespaceName, resourceName, req.EnvVariables, req.SecretEnv, nil); err != nil {
+		if errors.Is(err, errEnvConflict) {
+			return nil, &buildError{http.StatusBadRequest, fmt.Sprintf("Invalid secretEnv: %v", err)}
+		}
+		s.Logger.Error("Failed to get CR", "kind", kind.Kind, "id", resourceName, "error", err)
+		return nil, &buildError{http.StatusInternalServerError, "Failed to initialize environment"}
+	}
+
+	// A CronJob cannot be created without knowing when to run it
+	if req.Kind == kindCronJob && req.Cron == nil {
+		_, err := s.DynamicClient.Resource(cronJobGVR).Namespace(namespaceName).Get(ctx, resourceName, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return nil, &buildError{http.StatusBadRequest, "cron is required for a new cronjob"}
+		}
+		if err != nil {
+			s.Logger.Error("Failed to get CronJob", "id", resourceName, "error", err)
+			return nil, &buildError{http.StatusInternalServerError, "Failed to initialize environment"}
+		}
 	}
-	resourceName := "app-" + rawUUID
 
 	// App Name for Docker Registry (keep human name for registry readability)
 	imageRepoName, _ := validateAndSanitize(req.Name)
@@ -203,51 +372,119 @@ func (s *Server) handleCreateBuild(w http.ResponseWriter, r *http.Request) {
 	generatedImage := fmt.Sprintf("%s/%s:%s", s.RegistryBase, imageRepoName, tag)
 
 	// 4. Create Target Namespace (if not exists)
-	existed, err := s.createNamespace(r.Context(), namespaceName)
+	existed, err := s.createNamespace(ctx, namespaceName)
 	if err != nil {
 		s.Logger.Error("Failed to create namespace", "namespace", namespaceName, "error", err)
-		http.Error(w, "Failed to initialize environment", http.StatusInternalServerError)
-		return
+		return nil, &buildError{http.StatusInternalServerError, "Failed to initialize environment"}
 	}
 
 	// 5. Submit Kaniko Build Job
 	// Use the resourceName in the job name to keep it linked
 	jobName := fmt.Sprintf("build-%s-%s", resourceName, tag)
-	if err := s.createKanikoJob(r.Context(), "default", jobName, req.RepoURL, req.Branch, generatedImage); err != nil {
+	jobLabels := map[string]string{
+		"managed-by":   "paas-backend",
+		"project-id":   namespaceName,
+		"container-id": req.ContainerID,
+		"app":          resourceName,
+		// Tells watchBuilds which CR to point at the image
+		"workload-kind": req.Kind,
+	}
+	build := kanikoBuild{
+		JobName:          jobName,
+		Labels:           jobLabels,
+		GitRepo:          req.RepoURL,
+		Branch:           req.Branch,
+		Commit:           req.Commit,
+		DestinationImage: generatedImage,
+		Config:           req.BuildConfig,
+		TriggeredBy:      req.TriggeredBy,
+	}
+	if req.GitCredentials != "" {
+		credentialsName, err := validateGitCredentialsName(req.GitCredentials)
+		if err != nil {
+			return nil, &buildError{http.StatusBadRequest, fmt.Sprintf("Invalid gitCredentials: %v", err)}
+		}
+		build.GitSecret, err = s.copyGitCredentials(ctx, namespaceName, credentialsName, jobName, req.RepoURL)
+		if err != nil {
+			s.Logger.Error("Failed to prepare git credentials", "job", jobName, "error", err)
+			return nil, &buildError{http.StatusBadRequest, fmt.Sprintf("Failed to prepare git credentials: %v", err)}
+		}
+	}
+
+	// Pin the build to the current head of the branch so the image matches a
+	// known commit. SSH repositories are resolved by the git-clone container.
+	// Kaniko still builds the head of the branch when it cannot be resolved,
+	// the build then records no commit.
+	if build.Commit == "" && !isSSHRepoURL(req.RepoURL) {
+		build.Commit, err = resolveCommit(ctx, req.RepoURL, req.Branch, build.GitSecret)
+		if err != nil {
+			s.Logger.Warn("Failed to resolve commit, building the branch head", "job", jobName, "repo", req.RepoURL, "branch", req.Branch, "error", err)
+		}
+	}
+
+	job, err := s.createKanikoJob(ctx, buildNamespace, build)
+	if err != nil {
 		s.Logger.Error("Failed to create build job", "job", jobName, "error", err)
-		http.Error(w, "Failed to start build process", http.StatusInternalServerError)
-		return
+		if build.GitSecret != nil {
+			s.KubeClient.CoreV1().Secrets(buildNamespace).Delete(ctx, build.GitSecret.Name, metav1.DeleteOptions{})
+		}
+		return nil, &buildError{http.StatusInternalServerError, "Failed to start build process"}
+	}
+	if build.GitSecret != nil {
+		// The copy would otherwise stay behind in the build namespace once the
+		// Job is gone, so the build is abandoned with it
+		if err := s.ownGitCredentials(ctx, build.GitSecret, job); err != nil {
+			s.Logger.Error("Failed to attach git credentials to build job", "job", jobName, "error", err)
+			propagation := metav1.DeletePropagationBackground
+			s.KubeClient.BatchV1().Jobs(buildNamespace).Delete(ctx, job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+			s.KubeClient.CoreV1().Secrets(buildNamespace).Delete(ctx, build.GitSecret.Name, metav1.DeleteOptions{})
+			return nil, &buildError{http.StatusInternalServerError, "Failed to start build process"}
+		}
 	}
 
 	// 6. Create or Update the WebApp Custom Resource
 	// We pass resourceName ("app-UUID") as the K8s name, 
 	// but the original req (containing raw UUID) is stored in the Spec.
-	if err := s.createWebApp(r.Context(), namespaceName, resourceName, generatedImage, req); err != nil {
-		s.Logger.Error("Failed to create WebApp CR", "id", resourceName, "error", err)
-		http.Error(w, "Build started, but failed to sync deployment metadata", http.StatusInternalServerError)
-		return
+	// spec.image is left alone here: watchBuilds sets it once the build succeeded.
+	if req.Kind == kindWebApp {
+		err = s.createWebApp(ctx, namespaceName, resourceName, req)
+	} else {
+		err = s.createWorkload(ctx, kind, namespaceName, resourceName, req)
+	}
+	if err != nil {
+		s.Logger.Error("Failed to create CR", "kind", kind.Kind, "id", resourceName, "error", err)
+		return nil, &buildError{http.StatusInternalServerError, "Build started, but failed to sync deployment metadata"}
+	}
+	secretEnv, err := s.applySecretEnv(ctx, kind, namespaceName, resourceName, req.SecretEnv, nil)
+	if err != nil {
+		s.Logger.Error("Failed to store secret environment", "id", resourceName, "error", err)
+		return nil, &buildError{http.StatusInternalServerError, "Build started, but failed to store secret variables"}
 	}
 
 	s.Logger.Info("Build and Deployment triggered", 
 		"resourceName", resourceName, 
 		"rawUUID", rawUUID, 
 		"image", generatedImage,
+		"commit", build.Commit,
 	)
 	
-	// 7. Success Response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(Response{
+	// The URL depends on the base domain of the platform, the operator
+	// reports it in the WebApp status
+	message := "Build started"
+	return &Response{
 		Namespace: namespaceName,
 		JobName:   jobName,
 		AppName:   req.Name,
 		Image:     generatedImage,
-		// Update message to reflect the new URL format
-		Message:   fmt.Sprintf("Deployment created. URL: https://%s.kleff.io", resourceName),
+		Commit:    build.Commit,
+		SecretEnv: secretEnv,
+		// The build runs asynchronously; its progress is exposed on /api/v1/build/{jobName}
+		Message:   message,
 		Existed:   existed,
-	})
+	}, nil
 }
 // createWebApp uses the Dynamic Client to create or update the Custom Resource
-	func (s *Server) createWebApp(ctx context.Context, namespace, resourceName, image string, req BuildRequest) error {
+	func (s *Server) createWebApp(ctx context.Context, namespace, resourceName string, req BuildRequest) error {
 		port := req.Port
 		if port == 0 {
 			port = 8080
@@ -268,7 +505,6 @@ func (s *Server) handleCreateBuild(w http.ResponseWriter, r *http.Request) {
 				"spec": map[string]interface{}{
 					"containerID":  req.ContainerID,
 					"displayName":  req.Name, // User-friendly name
-					"image":        image,
 					"port":         int64(port),
 					"repoURL":      req.RepoURL,
 					"branch":       req.Branch,
@@ -277,6 +513,49 @@ func (s *Server) handleCreateBuild(w http.ResponseWriter, r *http.Request) {
 			},
 		}
 
+		buildSpec := req.BuildConfig.specValue()
+		var healthCheckSpec map[string]interface{}
+		if req.HealthCheck != nil {
+			var err error
+			if healthCheckSpec, err = req.HealthCheck.specValue(); err != nil {
+				return err
+			}
+			webApp.Object["spec"].(map[string]interface{})["healthCheck"] = healthCheckSpec
+		}
+		var strategySpec map[string]interface{}
+		if req.Strategy != nil {
+			var err error
+			if strategySpec, err = req.Strategy.specValue(); err != nil {
+				return err
+			}
+			webApp.Object["spec"].(map[string]interface{})["strategy"] = strategySpec
+		}
+		var volumes []interface{}
+		if len(req.Volumes) > 0 {
+			var err error
+			if volumes, err = volumesSpec(req.Volumes); err != nil {
+				return err
+			}
+			webApp.Object["spec"].(map[string]interface{})["volumes"] = volumes
+		}
+		var ports []interface{}
+		if len(req.Ports) > 0 {
+			var err error
+			if ports, err = portsSpec(req.Ports); err != nil {
+				return err
+			}
+			webApp.Object["spec"].(map[string]interface{})["ports"] = ports
+		}
+		if buildSpec != nil {
+			webApp.Object["spec"].(map[string]interface{})["build"] = buildSpec
+		}
+		if req.GitCredentials != "" {
+			webApp.Object["spec"].(map[string]interface{})["gitCredentials"] = req.GitCredentials
+		}
+		if req.Plan != "" {
+			webApp.Object["spec"].(map[string]interface{})["plan"] = req.Plan
+		}
+
 		_, err := s.DynamicClient.Resource(webAppGVR).Namespace(namespace).Create(ctx, webApp, metav1.CreateOptions{})
 		if err != nil {
 			if k8serrors.IsAlreadyExists(err) {
@@ -292,15 +571,45 @@ func (s *Server) handleCreateBuild(w http.ResponseWriter, r *http.Request) {
 					spec = make(map[string]interface{})
 				}
 				
-				// Update ALL fields to ensure they reflect the latest UI changes
+				// Update ALL fields to ensure they reflect the latest UI changes,
+				// except the image which keeps running until the new build succeeds
 				spec["displayName"] = req.Name
-				spec["image"]       = image
 				spec["port"]        = int64(port)
 				spec["branch"]      = req.Branch
 				spec["repoURL"]     = req.RepoURL
 				if req.EnvVariables != nil {
 					spec["envVariables"] = req.EnvVariables
 				}
+				// Keep the current plan unless a new one is picked
+				if req.Plan != "" {
+					spec["plan"] = req.Plan
+				}
+				if healthCheckSpec != nil {
+					spec["healthCheck"] = healthCheckSpec
+				}
+				if strategySpec != nil {
+					spec["strategy"] = strategySpec
+				}
+				if volumes != nil {
+					spec["volumes"] = volumes
+				} else if req.Volumes != nil {
+					delete(spec, "volumes")
+				}
+				if ports != nil {
+					spec["ports"] = ports
+				} else if req.Ports != nil {
+					delete(spec, "ports")
+				}
+				if buildSpec != nil {
+					spec["build"] = buildSpec
+				} else {
+					delete(spec, "build")
+				}
+				if req.GitCredentials != "" {
+					spec["gitCredentials"] = req.GitCredentials
+				} else {
+					delete(spec, "gitCredentials")
+				}
 				
 				existing.Object["spec"] = spec
 
@@ -329,15 +638,53 @@ func (s *Server) handleUpdateWebApp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	namespaceName, _ := validateAndSanitize(req.ProjectID)
-	
+	if err := validateSecretEnv(req.SecretEnv, req.RemoveSecretEnv, req.EnvVariables); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid secretEnv: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	namespaceName, err := validateAndSanitize(req.ProjectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	rawUUID, err := validateAndSanitize(req.ContainerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Container ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.authorizeProject(w, r, namespaceName, permissionManageEnvVars); !ok {
+		return
+	}
+
 	// Ensure we lookup the resource using the "app-" prefix
-	rawUUID, _      := validateAndSanitize(req.ContainerID)
-	resourceName    := "app-" + rawUUID
+	resourceName := "app-" + rawUUID
+
+	// Checked before anything is written, so a refused request changes nothing
+	if err := s.checkEnvConflicts(r.Context(), workloadKinds[kindWebApp], namespaceName, resourceName, req.EnvVariables, req.SecretEnv, req.RemoveSecretEnv); err != nil {
+		if errors.Is(err, errEnvConflict) {
+			http.Error(w, fmt.Sprintf("Invalid secretEnv: %v", err), http.StatusBadRequest)
+			return
+		}
+		s.Logger.Error("Failed to get WebApp", "resourceName", resourceName, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to update WebApp: %v", err), http.StatusInternalServerError)
+		return
+	}
 
 	// Update the WebApp CRD using the resourceName (app-<UUID>)
-	if err := s.updateWebAppEnvVariables(r.Context(), namespaceName, resourceName, req.EnvVariables); err != nil {
-		s.Logger.Error("Failed to update WebApp env vars", "resourceName", resourceName, "error", err)
+	// A request carrying only secret variables leaves the plain ones alone
+	if req.EnvVariables != nil {
+		if err := s.updateWebAppEnvVariables(r.Context(), namespaceName, resourceName, req.EnvVariables); err != nil {
+			s.Logger.Error("Failed to update WebApp env vars", "resourceName", resourceName, "error", err)
+			http.Error(w, fmt.Sprintf("Failed to update WebApp: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Values go to the app's Secret; only their names are returned
+	secretEnv, err := s.applySecretEnv(r.Context(), workloadKinds[kindWebApp], namespaceName, resourceName, req.SecretEnv, req.RemoveSecretEnv)
+	if err != nil {
+		s.Logger.Error("Failed to update WebApp secret env", "resourceName", resourceName, "error", err)
 		http.Error(w, fmt.Sprintf("Failed to update WebApp: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -348,6 +695,7 @@ func (s *Server) handleUpdateWebApp(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(Response{
 		Namespace: namespaceName,
 		AppName:   req.Name,
+		SecretEnv: secretEnv,
 		Message:   "Environment variables updated successfully",
 	})
 }
@@ -373,71 +721,195 @@ func (s *Server) createNamespace(ctx context.Context, name string) (bool, error)
 	return false, nil
 }
 
-func (s *Server) createKanikoJob(ctx context.Context, namespace, jobName, gitRepo, branch, destinationImage string) error {
-	// Fix Git Context for Kaniko (Needs git:// for private/public without auth, or https:// with tokens)
-	gitContext := gitRepo
-	if strings.HasPrefix(gitContext, "https://") {
-		// Convert https to git protocol to avoid interactive auth prompts for public repos
-		gitContext = "git://" + strings.TrimPrefix(gitContext, "https://")
-	} else if !strings.HasPrefix(gitContext, "git://") {
-		gitContext = "git://" + gitContext
+// kanikoBuild describes the source and destination of a single Kaniko build Job
+type kanikoBuild struct {
+	JobName          string
+	Labels           map[string]string
+	GitRepo          string
+	Branch           string
+	Commit           string // Full SHA to check out, empty to build the head of the branch
+	DestinationImage string
+	Config           BuildConfig
+	TriggeredBy      string
+	GitSecret        *corev1.Secret // basic-auth or ssh-auth Secret in the build namespace, nil for public repos
+}
+
+func (s *Server) createKanikoJob(ctx context.Context, namespace string, build kanikoBuild) (*batchv1.Job, error) {
+	kaniko := corev1.Container{
+		Name:  "kaniko",
+		Image: "gcr.io/kaniko-project/executor:latest",
+		// Surface the tail of the Kaniko output as the failure reason
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "acr-creds-vol",
+				MountPath: "/kaniko/.docker",
+			},
+		},
 	}
-	if branch != "" {
-		gitContext = fmt.Sprintf("%s#refs/heads/%s", gitContext, branch)
+	volumes := []corev1.Volume{
+		{
+			Name: "acr-creds-vol",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: "acr-creds",
+					Items: []corev1.KeyToPath{
+						{
+							Key:  ".dockerconfigjson",
+							Path: "config.json",
+						},
+					},
+				},
+			},
+		},
+	}
+	var initContainers []corev1.Container
+
+	var buildContext string
+	if isSSHRepoURL(build.GitRepo) {
+		// Kaniko cannot clone over SSH, so an init container checks the
+		// source out with the deploy key and Kaniko builds from disk
+		initContainers = append(initContainers, gitCloneContainer(build))
+		buildContext = "dir:///workspace"
+		kaniko.VolumeMounts = append(kaniko.VolumeMounts, corev1.VolumeMount{
+			Name:      "workspace",
+			MountPath: "/workspace",
+		})
+		volumes = append(volumes,
+			corev1.Volume{
+				Name:         "workspace",
+				VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+			},
+			corev1.Volume{
+				Name: "git-ssh-vol",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName:  build.GitSecret.Name,
+						DefaultMode: func(i int32) *int32 { return &i }(0400),
+					},
+				},
+			},
+		)
+	} else {
+		// Kaniko clones git:// contexts over HTTPS, authenticating with
+		// GIT_USERNAME/GIT_PASSWORD when they are set
+		buildContext = build.GitRepo
+		if strings.HasPrefix(buildContext, "https://") {
+			buildContext = "git://" + strings.TrimPrefix(buildContext, "https://")
+		} else if !strings.HasPrefix(buildContext, "git://") {
+			buildContext = "git://" + buildContext
+		}
+		ref := "HEAD"
+		if build.Branch != "" {
+			ref = "refs/heads/" + build.Branch
+		}
+		if build.Commit != "" {
+			buildContext = fmt.Sprintf("%s#%s#%s", buildContext, ref, build.Commit)
+		} else if build.Branch != "" {
+			buildContext = fmt.Sprintf("%s#%s", buildContext, ref)
+		}
+
+		if build.GitSecret != nil {
+			kaniko.Env = []corev1.EnvVar{
+				secretEnvVar("GIT_USERNAME", build.GitSecret.Name, corev1.BasicAuthUsernameKey),
+				secretEnvVar("GIT_PASSWORD", build.GitSecret.Name, corev1.BasicAuthPasswordKey),
+			}
+		}
 	}
+
+	kaniko.Args = append(build.Config.kanikoArgs(),
+		"--context="+buildContext,
+		"--destination="+build.DestinationImage,
+		"--cache=true",
+	)
+	if build.Commit != "" {
+		kaniko.Args = append(kaniko.Args, fmt.Sprintf("--label=%s=%s", imageRevisionLabel, build.Commit))
+	}
+
 	ttl := int32(3600)
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      jobName,
+			Name:      build.JobName,
 			Namespace: namespace,
+			Labels:    build.Labels,
+			Annotations: map[string]string{
+				buildImageAnnotation:  build.DestinationImage,
+				buildCommitAnnotation: build.Commit,
+				triggeredByAnnotation: build.TriggeredBy,
+			},
 		},
 		Spec: batchv1.JobSpec{
-			TTLSecondsAfterFinished: &ttl, 
-			BackoffLimit: func(i int32) *int32 { return &i }(2),
+			TTLSecondsAfterFinished: &ttl,
+			BackoffLimit:            func(i int32) *int32 { return &i }(2),
 			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: build.Labels,
+				},
 				Spec: corev1.PodSpec{
-					RestartPolicy: corev1.RestartPolicyNever,
-					Containers: []corev1.Container{
-						{
-							Name:  "kaniko",
-							Image: "gcr.io/kaniko-project/executor:latest",
-							Args: []string{
-								"--dockerfile=Dockerfile",
-								"--context=" + gitContext,
-								"--destination=" + destinationImage,
-								"--cache=true",
-							},
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "acr-creds-vol",
-									MountPath: "/kaniko/.docker",
-								},
-							},
-						},
-					},
-					Volumes: []corev1.Volume{
-						{
-							Name: "acr-creds-vol",
-							VolumeSource: corev1.VolumeSource{
-								Secret: &corev1.SecretVolumeSource{
-									SecretName: "acr-creds",
-									Items: []corev1.KeyToPath{
-										{
-											Key:  ".dockerconfigjson",
-											Path: "config.json",
-										},
-									},
-								},
-							},
-						},
-					},
+					RestartPolicy:  corev1.RestartPolicyNever,
+					InitContainers: initContainers,
+					Containers:     []corev1.Container{kaniko},
+					Volumes:        volumes,
 				},
 			},
 		},
 	}
 
-	_, err := s.KubeClient.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{})
-	return err
+	return s.KubeClient.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{})
+}
+
+// gitCloneScript checks out the pinned commit, or the head of the branch, and
+// reports the checked out commit as the termination message
+const gitCloneScript = `set -e
+if [ -n "$GIT_COMMIT" ]; then
+  git clone --no-checkout ${GIT_BRANCH:+--branch "$GIT_BRANCH"} -- "$GIT_REPO" /workspace
+  git -C /workspace checkout --detach "$GIT_COMMIT"
+else
+  git clone --depth=1 ${GIT_BRANCH:+--branch "$GIT_BRANCH"} -- "$GIT_REPO" /workspace
+fi
+git -C /workspace rev-parse HEAD > /dev/termination-log
+`
+
+// gitCloneContainer clones an SSH repository into the shared workspace volume
+func gitCloneContainer(build kanikoBuild) corev1.Container {
+	return corev1.Container{
+		Name:                     "git-clone",
+		Image:                    "alpine/git:latest",
+		Command:                  []string{"/bin/sh", "-c", gitCloneScript},
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		Env: []corev1.EnvVar{
+			{Name: "GIT_REPO", Value: build.GitRepo},
+			{Name: "GIT_BRANCH", Value: build.Branch},
+			{Name: "GIT_COMMIT", Value: build.Commit},
+			{
+				Name:  "GIT_SSH_COMMAND",
+				Value: "ssh -i /etc/git-ssh/" + corev1.SSHAuthPrivateKey + " -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=/tmp/known_hosts",
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "workspace",
+				MountPath: "/workspace",
+			},
+			{
+				Name:      "git-ssh-vol",
+				MountPath: "/etc/git-ssh",
+				ReadOnly:  true,
+			},
+		},
+	}
+}
+
+func secretEnvVar(name, secretName, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+				Key:                  key,
+			},
+		},
+	}
 }
 
 func validateAndSanitize(name string) (string, error) {
@@ -460,14 +932,16 @@ func validateAndSanitize(name string) (string, error) {
 	return name, nil
 }
 
-func enableCors(next http.HandlerFunc) http.HandlerFunc {
+func (s *Server) enableCors(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Only origins on the allow-list may send credentialed requests
+		w.Header().Add("Vary", "Origin")
 		origin := r.Header.Get("Origin")
-		if origin != "" {
+		if origin != "" && s.AllowedOrigins[origin] {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 		}
 
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Authorization")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Upper bound of extra ports on a single app, matches the CRD
+const maxPorts = 10
+
+var portNameRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// AppPort mirrors an entry of spec.ports of the WebApp CRD, a port besides
+// the HTTP one. GRPC ports are routed at <name>-<app>.kleff.io; TCP and UDP
+// ports attach to a listener of the Gateway, or get a LoadBalancer or
+// NodePort Service within the quota of the project.
+type AppPort struct {
+	Name     string `json:"name"`
+	Port     int32  `json:"port"`
+	Protocol string `json:"protocol,omitempty"` // GRPC, TCP or UDP, defaults to TCP
+	Expose   string `json:"expose,omitempty"`   // Gateway, LoadBalancer or NodePort, defaults to Gateway
+	Listener string `json:"listener,omitempty"` // Gateway listener of a TCP or UDP port exposed through the Gateway
+}
+
+// EndpointStatus mirrors an entry of status.endpoints, where a port is
+// reachable from outside the cluster
+type EndpointStatus struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Host     string `json:"host,omitempty"` // Empty for NodePort, which is open on every node
+	Port     int32  `json:"port,omitempty"`
+	Ready    bool   `json:"ready"`
+	Message  string `json:"message,omitempty"`
+}
+
+// validatePorts rejects what the CRD would, so the error reaches the caller
+// instead of failing the WebApp update
+func validatePorts(ports []AppPort, httpPort int) error {
+	if len(ports) > maxPorts {
+		return fmt.Errorf("at most %d ports are allowed", maxPorts)
+	}
+
+	names := make(map[string]bool, len(ports))
+	numbers := make(map[string]bool, len(ports))
+	for _, port := range ports {
+		if len(port.Name) > 15 || !portNameRegex.MatchString(port.Name) {
+			return fmt.Errorf("invalid port name %q", port.Name)
+		}
+		if port.Name == "http" {
+			return fmt.Errorf("http is reserved for the HTTP port")
+		}
+		if names[port.Name] {
+			return fmt.Errorf("port %q is listed twice", port.Name)
+		}
+		names[port.Name] = true
+
+		if port.Port < 1 || port.Port > 65535 {
+			return fmt.Errorf("port %q: port must be between 1 and 65535", port.Name)
+		}
+
+		protocol := port.Protocol
+		switch protocol {
+		case "":
+			protocol = "TCP"
+		case "GRPC", "TCP", "UDP":
+		default:
+			return fmt.Errorf("port %q: protocol must be GRPC, TCP or UDP", port.Name)
+		}
+		// GRPC rides on TCP like the HTTP port
+		if protocol != "UDP" && int(port.Port) == httpPort {
+			return fmt.Errorf("port %q: %d is the HTTP port", port.Name, port.Port)
+		}
+		key := fmt.Sprintf("%d/%s", port.Port, protocol)
+		if numbers[key] {
+			return fmt.Errorf("port %q: %d/%s is already exposed", port.Name, port.Port, protocol)
+		}
+		numbers[key] = true
+
+		switch port.Expose {
+		case "", "Gateway", "LoadBalancer", "NodePort":
+		default:
+			return fmt.Errorf("port %q: expose must be Gateway, LoadBalancer or NodePort", port.Name)
+		}
+		if protocol == "GRPC" && port.Expose != "" && port.Expose != "Gateway" {
+			return fmt.Errorf("port %q: GRPC ports are exposed through the Gateway", port.Name)
+		}
+
+		needsListener := (port.Expose == "" || port.Expose == "Gateway") && protocol != "GRPC"
+		if needsListener && !portNameRegex.MatchString(port.Listener) {
+			return fmt.Errorf("port %q: a listener is required for %s ports exposed through the Gateway", port.Name, protocol)
+		}
+		if !needsListener && port.Listener != "" {
+			return fmt.Errorf("port %q: listener only applies to TCP and UDP ports exposed through the Gateway", port.Name)
+		}
+	}
+	return nil
+}
+
+// portsSpec renders the ports for the WebApp spec
+func portsSpec(ports []AppPort) ([]interface{}, error) {
+	value := make([]interface{}, len(ports))
+	for i := range ports {
+		item, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&ports[i])
+		if err != nil {
+			return nil, err
+		}
+		value[i] = item
+	}
+	return value, nil
+}
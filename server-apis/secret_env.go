@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+)
+
+var envVarNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// secretEnvName is the Secret holding the secret variables of a WebApp. The
+// operator references it from the Deployment by this name.
+func secretEnvName(resourceName string) string {
+	return resourceName + "-env"
+}
+
+// validateSecretEnv checks the names of secret variables to set and remove,
+// and that none of them is also passed as a plain variable
+func validateSecretEnv(set map[string]string, remove []string, plain map[string]string) error {
+	for key := range set {
+		if !envVarNameRegex.MatchString(key) {
+			return fmt.Errorf("invalid variable name %q", key)
+		}
+		if _, ok := plain[key]; ok {
+			return fmt.Errorf("%q cannot be both a plain and a secret variable", key)
+		}
+	}
+	for _, key := range remove {
+		if !envVarNameRegex.MatchString(key) {
+			return fmt.Errorf("invalid variable name %q", key)
+		}
+	}
+	return nil
+}
+
+// errEnvConflict is returned when a variable would be both plain and secret
+var errEnvConflict = errors.New("cannot be both a plain and a secret variable")
+
+// checkEnvConflicts looks the CR up and checks the variables against its
+// current spec. A CR that does not exist yet has nothing to conflict with.
+func (s *Server) checkEnvConflicts(ctx context.Context, kind workloadKind, namespace, resourceName string, plain, set map[string]string, remove []string) error {
+	obj, err := s.DynamicClient.Resource(kind.GVR).Namespace(namespace).Get(ctx, resourceName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return envConflict(obj, plain, set, remove)
+}
+
+// envConflict checks that no variable is both plain and secret once the
+// change is applied to the CR: the plain variables replace
+// spec.envVariables unless nil, and set and remove edit spec.secretEnv
+func envConflict(obj *unstructured.Unstructured, plain, set map[string]string, remove []string) error {
+	plainKeys := make(map[string]bool)
+	if plain != nil {
+		for key := range plain {
+			plainKeys[key] = true
+		}
+	} else {
+		current, _, _ := unstructured.NestedMap(obj.Object, "spec", "envVariables")
+		for key := range current {
+			plainKeys[key] = true
+		}
+	}
+
+	secretKeys := make(map[string]bool)
+	current, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "secretEnv")
+	for _, key := range current {
+		secretKeys[key] = true
+	}
+	for _, key := range remove {
+		delete(secretKeys, key)
+	}
+	for key := range set {
+		secretKeys[key] = true
+	}
+
+	var conflicts []string
+	for key := range secretKeys {
+		if plainKeys[key] {
+			conflicts = append(conflicts, key)
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return fmt.Errorf("%q %w", conflicts[0], errEnvConflict)
+	}
+	return nil
+}
+
+// applySecretEnv merges secret variables into the Secret of a WebApp, Worker
+// or CronJob and lists their names, never their values, in spec.secretEnv.
+// The Secret is owned by the CR so it is deleted along with it. Variables
+// the CR already passes as plain ones are refused.
+func (s *Server) applySecretEnv(ctx context.Context, kind workloadKind, namespace, resourceName string, set map[string]string, remove []string) ([]string, error) {
+	if len(set) == 0 && len(remove) == 0 {
+		return nil, nil
+	}
+
+	webApps := s.DynamicClient.Resource(kind.GVR).Namespace(namespace)
+	webApp, err := webApps.Get(ctx, resourceName, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%s not found: %s/%s", kind.Kind, namespace, resourceName)
+		}
+		return nil, err
+	}
+	if err := envConflict(webApp, nil, set, remove); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	secrets := s.KubeClient.CoreV1().Secrets(namespace)
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := secrets.Get(ctx, secretEnvName(resourceName), metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      secretEnvName(resourceName),
+					Namespace: namespace,
+					Labels: map[string]string{
+						"managed-by": "paas-backend",
+						"app":        resourceName,
+					},
+					OwnerReferences: []metav1.OwnerReference{
+						*metav1.NewControllerRef(webApp, kind.GVR.GroupVersion().WithKind(kind.Kind)),
+					},
+				},
+				Type: corev1.SecretTypeOpaque,
+			}
+		} else if err != nil {
+			return err
+		}
+
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		for key, value := range set {
+			secret.Data[key] = []byte(value)
+		}
+		for _, key := range remove {
+			delete(secret.Data, key)
+		}
+
+		keys = make([]string, 0, len(secret.Data))
+		for key := range secret.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		if secret.ResourceVersion == "" {
+			_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+		} else {
+			_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		webApp, err := webApps.Get(ctx, resourceName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			unstructured.RemoveNestedField(webApp.Object, "spec", "secretEnv")
+		} else {
+			value := make([]interface{}, len(keys))
+			for i, key := range keys {
+				value[i] = key
+			}
+			if err := unstructured.SetNestedSlice(webApp.Object, value, "spec", "secretEnv"); err != nil {
+				return err
+			}
+		}
+		_, err = webApps.Update(ctx, webApp, metav1.UpdateOptions{})
+		return err
+	})
+	return keys, err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Strategy mirrors spec.strategy of the WebApp CRD
+type Strategy struct {
+	Type          string                 `json:"type,omitempty"` // RollingUpdate, BlueGreen or Canary, defaults to RollingUpdate
+	RollingUpdate *RollingUpdateStrategy `json:"rollingUpdate,omitempty"`
+	BlueGreen     *BlueGreenStrategy     `json:"blueGreen,omitempty"`
+	Canary        *CanaryStrategy        `json:"canary,omitempty"`
+}
+
+// RollingUpdateStrategy takes a pod count or a percentage such as "25%"
+type RollingUpdateStrategy struct {
+	MaxSurge       *intstr.IntOrString `json:"maxSurge,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// BlueGreenStrategy sets how long the previous version keeps running after a switch
+type BlueGreenStrategy struct {
+	ScaleDownDelaySeconds *int32 `json:"scaleDownDelaySeconds,omitempty"`
+}
+
+// CanaryStrategy lists the traffic steps of a canary release, 10% then 50%
+// for five minutes each when empty
+type CanaryStrategy struct {
+	Steps []CanaryStep `json:"steps,omitempty"`
+}
+
+// CanaryStep sends weight percent of the requests to the canary. Without
+// pauseSeconds the step lasts until the release is promoted.
+type CanaryStep struct {
+	Weight       int32  `json:"weight"`
+	PauseSeconds *int32 `json:"pauseSeconds,omitempty"`
+}
+
+// Upper bound of canary steps, matches the CRD
+const maxCanarySteps = 10
+
+func (s *Strategy) validate() error {
+	switch s.Type {
+	case "", "RollingUpdate", "BlueGreen", "Canary":
+	default:
+		return fmt.Errorf("type must be RollingUpdate, BlueGreen or Canary")
+	}
+
+	if s.RollingUpdate != nil {
+		for name, value := range map[string]*intstr.IntOrString{
+			"maxSurge":       s.RollingUpdate.MaxSurge,
+			"maxUnavailable": s.RollingUpdate.MaxUnavailable,
+		} {
+			if value == nil {
+				continue
+			}
+			if scaled, err := intstr.GetScaledValueFromIntOrPercent(value, 100, true); err != nil || scaled < 0 {
+				return fmt.Errorf("%s must be a pod count or a percentage", name)
+			}
+		}
+		if isZero(s.RollingUpdate.MaxSurge) && isZero(s.RollingUpdate.MaxUnavailable) {
+			return fmt.Errorf("maxSurge and maxUnavailable cannot both be 0")
+		}
+	}
+
+	if s.BlueGreen != nil && s.BlueGreen.ScaleDownDelaySeconds != nil && *s.BlueGreen.ScaleDownDelaySeconds < 0 {
+		return fmt.Errorf("scaleDownDelaySeconds must not be negative")
+	}
+
+	if s.Canary != nil {
+		if len(s.Canary.Steps) > maxCanarySteps {
+			return fmt.Errorf("at most %d canary steps are allowed", maxCanarySteps)
+		}
+		for i, step := range s.Canary.Steps {
+			if step.Weight < 0 || step.Weight > 100 {
+				return fmt.Errorf("canary step %d: weight must be between 0 and 100", i+1)
+			}
+			if step.PauseSeconds != nil && *step.PauseSeconds < 0 {
+				return fmt.Errorf("canary step %d: pauseSeconds must not be negative", i+1)
+			}
+		}
+	}
+	return nil
+}
+
+// specValue renders the strategy for the WebApp spec
+func (s *Strategy) specValue() (map[string]interface{}, error) {
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(s)
+}
+
+func isZero(value *intstr.IntOrString) bool {
+	return value != nil && (value.String() == "0" || value.String() == "0%")
+}
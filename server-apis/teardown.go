@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// handleDeleteWebApp removes a WebApp CR. Its Deployment, Service and
+// HTTPRoute are owned by the CR and garbage collected with it; the operator
+// holds it until its build Jobs and registry images are cleaned up.
+func (s *Server) handleDeleteWebApp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	projectID := r.PathValue("projectID")
+	namespaceName, err := validateAndSanitize(projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	rawUUID, err := validateAndSanitize(r.PathValue("containerID"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Container ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	resourceName := "app-" + rawUUID
+
+	if _, ok := s.authorizeProject(w, r, projectID, permissionWriteProject); !ok {
+		return
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	err = s.DynamicClient.Resource(webAppGVR).Namespace(namespaceName).Delete(r.Context(), resourceName, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			http.Error(w, "WebApp not found", http.StatusNotFound)
+			return
+		}
+		s.Logger.Error("Failed to delete WebApp", "namespace", namespaceName, "resourceName", resourceName, "error", err)
+		http.Error(w, "Failed to delete WebApp", http.StatusInternalServerError)
+		return
+	}
+
+	s.Logger.Info("WebApp deleted", "namespace", namespaceName, "resourceName", resourceName)
+
+	writeJSON(w, http.StatusOK, Response{
+		Namespace: namespaceName,
+		AppName:   resourceName,
+		Message:   "WebApp deleted",
+	})
+}
+
+// orphanedVolumeLabel marks the claim of a volume removed from its WebApp,
+// set by the operator
+const orphanedVolumeLabel = "kleff.io/orphaned"
+
+// handleDeleteVolume deletes the claim of a volume removed from a WebApp,
+// and its data with it. Claims of volumes the app still mounts are refused.
+func (s *Server) handleDeleteVolume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	projectID := r.PathValue("projectID")
+	namespaceName, err := validateAndSanitize(projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	rawUUID, err := validateAndSanitize(r.PathValue("containerID"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Container ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	volumeName := r.PathValue("volume")
+	if len(volumeName) > 40 || !validNameRegex.MatchString(volumeName) {
+		http.Error(w, "Invalid volume name", http.StatusBadRequest)
+		return
+	}
+	resourceName := "app-" + rawUUID
+	claimName := resourceName + "-" + volumeName
+
+	if _, ok := s.authorizeProject(w, r, projectID, permissionWriteProject); !ok {
+		return
+	}
+
+	claims := s.KubeClient.CoreV1().PersistentVolumeClaims(namespaceName)
+	claim, err := claims.Get(r.Context(), claimName, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			http.Error(w, "Volume not found", http.StatusNotFound)
+			return
+		}
+		s.Logger.Error("Failed to get volume claim", "namespace", namespaceName, "claim", claimName, "error", err)
+		http.Error(w, "Failed to delete volume", http.StatusInternalServerError)
+		return
+	}
+	if claim.Labels["webapp"] != resourceName {
+		http.Error(w, "Volume not found", http.StatusNotFound)
+		return
+	}
+	if claim.Labels[orphanedVolumeLabel] != "true" {
+		http.Error(w, "The volume is still mounted, remove it from the app first", http.StatusConflict)
+		return
+	}
+
+	err = claims.Delete(r.Context(), claimName, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &claim.ResourceVersion},
+	})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		if k8serrors.IsConflict(err) {
+			http.Error(w, "The volume changed, try again", http.StatusConflict)
+			return
+		}
+		s.Logger.Error("Failed to delete volume claim", "namespace", namespaceName, "claim", claimName, "error", err)
+		http.Error(w, "Failed to delete volume", http.StatusInternalServerError)
+		return
+	}
+
+	s.Logger.Info("Volume deleted", "namespace", namespaceName, "resourceName", resourceName, "volume", volumeName)
+
+	writeJSON(w, http.StatusOK, Response{
+		Namespace: namespaceName,
+		AppName:   resourceName,
+		Message:   fmt.Sprintf("Volume %s deleted", volumeName),
+	})
+}
+
+// handleDeleteProject tears down the namespace of a project. It refuses while
+// WebApps, Workers or CronJobs remain in it unless ?force=true is given.
+// Only callers allowed to delete the project, its owners, may do either.
+func (s *Server) handleDeleteProject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	projectID := r.PathValue("projectID")
+	namespaceName, err := validateAndSanitize(projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	force := false
+	if value := r.URL.Query().Get("force"); value != "" {
+		force, err = strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "force must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if _, ok := s.authorizeProject(w, r, projectID, permissionDeleteProject); !ok {
+		return
+	}
+
+	namespace, err := s.KubeClient.CoreV1().Namespaces().Get(r.Context(), namespaceName, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			http.Error(w, "Project not found", http.StatusNotFound)
+			return
+		}
+		s.Logger.Error("Failed to get namespace", "namespace", namespaceName, "error", err)
+		http.Error(w, "Failed to delete project", http.StatusInternalServerError)
+		return
+	}
+	// Never touch namespaces this service did not create
+	if namespace.Labels["managed-by"] != "paas-backend" {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	workloads := 0
+	for _, kindName := range workloadKindNames {
+		kind := workloadKinds[kindName]
+		list, err := s.DynamicClient.Resource(kind.GVR).Namespace(namespaceName).List(r.Context(), metav1.ListOptions{})
+		if err != nil {
+			s.Logger.Error("Failed to list workloads", "kind", kind.Kind, "namespace", namespaceName, "error", err)
+			http.Error(w, "Failed to delete project", http.StatusInternalServerError)
+			return
+		}
+		workloads += len(list.Items)
+	}
+	if workloads > 0 && !force {
+		http.Error(w, fmt.Sprintf("Project still has %d app(s), worker(s) or cron job(s); delete them first or pass force=true", workloads), http.StatusConflict)
+		return
+	}
+
+	if err := s.KubeClient.CoreV1().Namespaces().Delete(r.Context(), namespaceName, metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+		s.Logger.Error("Failed to delete namespace", "namespace", namespaceName, "error", err)
+		http.Error(w, "Failed to delete project", http.StatusInternalServerError)
+		return
+	}
+
+	// Builds run outside the project namespace, so they are not removed with it
+	if err := s.deleteProjectBuilds(r.Context(), namespaceName); err != nil {
+		s.Logger.Error("Failed to delete project builds", "namespace", namespaceName, "error", err)
+	}
+
+	s.Logger.Info("Project torn down", "namespace", namespaceName, "workloads", workloads, "force", force)
+
+	writeJSON(w, http.StatusOK, Response{
+		Namespace: namespaceName,
+		Message:   fmt.Sprintf("Project deleted with %d app(s), worker(s) or cron job(s)", workloads),
+	})
+}
+
+// deleteProjectBuilds removes the build Jobs of a project, their pods and copied Git credentials
+func (s *Server) deleteProjectBuilds(ctx context.Context, namespaceName string) error {
+	propagation := metav1.DeletePropagationBackground
+	return s.KubeClient.BatchV1().Jobs(buildNamespace).DeleteCollection(ctx,
+		metav1.DeleteOptions{PropagationPolicy: &propagation},
+		metav1.ListOptions{LabelSelector: labels.Set{"managed-by": "paas-backend", "project-id": namespaceName}.String()},
+	)
+}
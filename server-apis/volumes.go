@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Upper bound of volumes on a single app, matches the CRD
+const maxVolumes = 10
+
+// Upper bound of the size of a volume or database, matches the CRD. The
+// storage of a project is capped by its quota as well.
+var maxVolumeSize = resource.MustParse("50Gi")
+
+// Volume mirrors an entry of spec.volumes of the WebApp CRD. The operator
+// keeps a PersistentVolumeClaim per volume; a ReadWriteOnce volume pins the
+// app to a single replica. The claim of a removed volume is kept, labeled
+// orphaned, until handleDeleteVolume deletes it or the app is deleted.
+type Volume struct {
+	Name             string            `json:"name"`
+	MountPath        string            `json:"mountPath"`
+	Size             resource.Quantity `json:"size"` // Such as 1Gi, can grow but not shrink
+	StorageClassName *string           `json:"storageClassName,omitempty"`
+	AccessMode       string            `json:"accessMode,omitempty"` // ReadWriteOnce or ReadWriteMany, defaults to ReadWriteOnce
+}
+
+// validateVolumes rejects what the CRD would, so the error reaches the caller
+// instead of failing the WebApp update
+func validateVolumes(volumes []Volume) error {
+	if len(volumes) > maxVolumes {
+		return fmt.Errorf("at most %d volumes are allowed", maxVolumes)
+	}
+
+	names := make(map[string]bool, len(volumes))
+	paths := make(map[string]bool, len(volumes))
+	for _, volume := range volumes {
+		if len(volume.Name) > 40 || !validNameRegex.MatchString(volume.Name) {
+			return fmt.Errorf("invalid volume name %q", volume.Name)
+		}
+		if names[volume.Name] {
+			return fmt.Errorf("volume %q is listed twice", volume.Name)
+		}
+		names[volume.Name] = true
+
+		if !strings.HasPrefix(volume.MountPath, "/") {
+			return fmt.Errorf("volume %q: mountPath must be absolute", volume.Name)
+		}
+		if paths[volume.MountPath] {
+			return fmt.Errorf("volume %q: %s is already mounted", volume.Name, volume.MountPath)
+		}
+		paths[volume.MountPath] = true
+
+		if volume.Size.Sign() <= 0 {
+			return fmt.Errorf("volume %q: size must be a positive quantity such as 1Gi", volume.Name)
+		}
+		if volume.Size.Cmp(maxVolumeSize) > 0 {
+			return fmt.Errorf("volume %q: size must not exceed %s", volume.Name, maxVolumeSize.String())
+		}
+		switch volume.AccessMode {
+		case "", "ReadWriteOnce", "ReadWriteMany":
+		default:
+			return fmt.Errorf("volume %q: accessMode must be ReadWriteOnce or ReadWriteMany", volume.Name)
+		}
+	}
+	return nil
+}
+
+// volumesSpec renders the volumes for the WebApp spec
+func volumesSpec(volumes []Volume) ([]interface{}, error) {
+	value := make([]interface{}, len(volumes))
+	for i := range volumes {
+		item, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&volumes[i])
+		if err != nil {
+			return nil, err
+		}
+		value[i] = item
+	}
+	return value, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+)
+
+// canaryActionAnnotation hands a promote or abort to the operator, which
+// removes it once handled. canaryActionIDAnnotation tells requests apart, so
+// the operator applies each one once.
+const (
+	canaryActionAnnotation   = "kleff.io/canary-action"
+	canaryActionIDAnnotation = "kleff.io/canary-action-id"
+)
+
+// errNoCanary is returned when a WebApp has no canary release to act on
+var errNoCanary = errors.New("no canary release in progress")
+
+// CanaryStatus mirrors status.canary of the WebApp CRD
+type CanaryStatus struct {
+	Image         string       `json:"image"`
+	TemplateHash  string       `json:"templateHash"`
+	Step          int32        `json:"step"`   // Index in spec.strategy.canary.steps
+	Weight        int32        `json:"weight"` // Percentage of requests the canary receives
+	StepStartedAt *metav1.Time `json:"stepStartedAt,omitempty"`
+	Aborted       bool         `json:"aborted,omitempty"`
+	LastAction    string       `json:"lastAction,omitempty"` // ID of the last action the operator applied
+}
+
+// CanaryActionRequest promotes a canary to its next step, or aborts it and
+// sends all the traffic back to the stable version
+type CanaryActionRequest struct {
+	ProjectID   string `json:"projectID"`
+	ContainerID string `json:"containerID"`
+	Action      string `json:"action"` // promote or abort
+}
+
+// handleCanaryAction promotes or aborts the canary release of a WebApp
+func (s *Server) handleCanaryAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CanaryActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if req.ProjectID == "" || req.ContainerID == "" {
+		http.Error(w, "projectID and containerID are required", http.StatusBadRequest)
+		return
+	}
+	if req.Action != "promote" && req.Action != "abort" {
+		http.Error(w, "action must be promote or abort", http.StatusBadRequest)
+		return
+	}
+
+	namespaceName, err := validateAndSanitize(req.ProjectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	rawUUID, err := validateAndSanitize(req.ContainerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Container ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	resourceName := "app-" + rawUUID
+
+	if _, ok := s.authorizeProject(w, r, req.ProjectID, permissionDeploy); !ok {
+		return
+	}
+
+	if err := s.requestCanaryAction(r.Context(), namespaceName, resourceName, req.Action); err != nil {
+		switch {
+		case k8serrors.IsNotFound(err):
+			http.Error(w, "WebApp not found", http.StatusNotFound)
+		case errors.Is(err, errNoCanary):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			s.Logger.Error("Failed to request canary action", "resourceName", resourceName, "action", req.Action, "error", err)
+			http.Error(w, "Failed to request canary action", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.Logger.Info("Canary action requested", "resourceName", resourceName, "action", req.Action)
+
+	writeJSON(w, http.StatusAccepted, Response{
+		Namespace: namespaceName,
+		AppName:   resourceName,
+		Message:   fmt.Sprintf("Canary %s requested", req.Action),
+	})
+}
+
+func (s *Server) requestCanaryAction(ctx context.Context, namespace, name, action string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		webApp, err := s.DynamicClient.Resource(webAppGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		canary, found, err := unstructured.NestedMap(webApp.Object, "status", "canary")
+		if err != nil {
+			return err
+		}
+		if !found || canary["aborted"] == true {
+			return errNoCanary
+		}
+
+		annotations := webApp.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[canaryActionAnnotation] = action
+		annotations[canaryActionIDAnnotation] = strconv.FormatInt(time.Now().UnixNano(), 36)
+		webApp.SetAnnotations(annotations)
+
+		_, err = s.DynamicClient.Resource(webAppGVR).Namespace(namespace).Update(ctx, webApp, metav1.UpdateOptions{})
+		return err
+	})
+}
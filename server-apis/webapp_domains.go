@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
+)
+
+// Upper bound of custom domains on a single app, matches the CRD
+const maxCustomDomains = 10
+
+// WebAppDomainStatus mirrors an entry of status.domains
+type WebAppDomainStatus struct {
+	Domain             string       `json:"domain"`
+	VerificationRecord string       `json:"verificationRecord"`
+	VerificationToken  string       `json:"verificationToken"`
+	Verified           bool         `json:"verified"`
+	VerifiedAt         *metav1.Time `json:"verifiedAt,omitempty"`
+	CertificateReady   bool         `json:"certificateReady"`
+	Message            string       `json:"message,omitempty"`
+}
+
+// SetDomainsRequest replaces the custom domains of a WebApp; an empty list
+// removes them all
+type SetDomainsRequest struct {
+	ProjectID     string   `json:"projectID"`
+	ContainerID   string   `json:"containerID"`
+	CustomDomains []string `json:"customDomains"`
+}
+
+// normalizeDomains lowercases the domains, drops duplicates and rejects
+// anything that is not a fully qualified name or is a platform subdomain
+func normalizeDomains(domains []string) ([]string, error) {
+	if len(domains) > maxCustomDomains {
+		return nil, fmt.Errorf("at most %d custom domains are allowed", maxCustomDomains)
+	}
+
+	seen := make(map[string]bool, len(domains))
+	result := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+		if errs := validation.IsDNS1123Subdomain(domain); len(errs) > 0 || !strings.Contains(domain, ".") {
+			return nil, fmt.Errorf("invalid domain %q", domain)
+		}
+		if domain == "kleff.io" || strings.HasSuffix(domain, ".kleff.io") {
+			return nil, fmt.Errorf("%q is a platform domain", domain)
+		}
+		if seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		result = append(result, domain)
+	}
+	return result, nil
+}
+
+// handleSetDomains sets the custom domains of a WebApp. The operator reports
+// the TXT record each domain needs in status.domains.
+func (s *Server) handleSetDomains(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SetDomainsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if req.ProjectID == "" || req.ContainerID == "" {
+		http.Error(w, "projectID and containerID are required", http.StatusBadRequest)
+		return
+	}
+	domains, err := normalizeDomains(req.CustomDomains)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	namespaceName, err := validateAndSanitize(req.ProjectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	rawUUID, err := validateAndSanitize(req.ContainerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Container ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	resourceName := "app-" + rawUUID
+
+	if _, ok := s.authorizeProject(w, r, req.ProjectID, permissionDeploy); !ok {
+		return
+	}
+
+	if err := s.setDomains(r.Context(), namespaceName, resourceName, domains); err != nil {
+		if k8serrors.IsNotFound(err) {
+			http.Error(w, "WebApp not found", http.StatusNotFound)
+			return
+		}
+		s.Logger.Error("Failed to set custom domains", "resourceName", resourceName, "error", err)
+		http.Error(w, "Failed to set custom domains", http.StatusInternalServerError)
+		return
+	}
+
+	s.Logger.Info("Custom domains updated", "resourceName", resourceName, "domains", domains)
+
+	writeJSON(w, http.StatusOK, Response{
+		Namespace: namespaceName,
+		AppName:   resourceName,
+		Message:   fmt.Sprintf("%d custom domain(s) set, see status.domains for the TXT records to create", len(domains)),
+	})
+}
+
+func (s *Server) setDomains(ctx context.Context, namespace, name string, domains []string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		webApp, err := s.DynamicClient.Resource(webAppGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if len(domains) == 0 {
+			unstructured.RemoveNestedField(webApp.Object, "spec", "customDomains")
+		} else {
+			value := make([]interface{}, len(domains))
+			for i, domain := range domains {
+				value[i] = domain
+			}
+			if err := unstructured.SetNestedSlice(webApp.Object, value, "spec", "customDomains"); err != nil {
+				return err
+			}
+		}
+
+		_, err = s.DynamicClient.Resource(webAppGVR).Namespace(namespace).Update(ctx, webApp, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+)
+
+type RollbackWebAppRequest struct {
+	ProjectID   string `json:"projectID"`
+	ContainerID string `json:"containerID"`
+	Revision    int64  `json:"revision"` // Entry of status.revisions to restore
+}
+
+var errRevisionNotFound = errors.New("revision not found")
+
+// handleRollbackWebApp points spec.image back to an earlier revision without rebuilding.
+// The operator records the rollback itself as a new revision.
+func (s *Server) handleRollbackWebApp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RollbackWebAppRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if req.ProjectID == "" || req.ContainerID == "" || req.Revision <= 0 {
+		http.Error(w, "projectID, containerID and revision are required", http.StatusBadRequest)
+		return
+	}
+
+	namespaceName, err := validateAndSanitize(req.ProjectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	rawUUID, err := validateAndSanitize(req.ContainerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Container ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	resourceName := "app-" + rawUUID
+
+	caller, ok := s.authorizeProject(w, r, req.ProjectID, permissionDeploy)
+	if !ok {
+		return
+	}
+
+	image, err := s.rollbackWebApp(r.Context(), namespaceName, resourceName, req.Revision, caller.Name())
+	if err != nil {
+		switch {
+		case k8serrors.IsNotFound(err):
+			http.Error(w, "WebApp not found", http.StatusNotFound)
+		case errors.Is(err, errRevisionNotFound):
+			http.Error(w, fmt.Sprintf("Revision %d not found", req.Revision), http.StatusNotFound)
+		default:
+			s.Logger.Error("Failed to roll back WebApp", "resourceName", resourceName, "error", err)
+			http.Error(w, "Failed to roll back WebApp", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.Logger.Info("WebApp rolled back", "resourceName", resourceName, "revision", req.Revision, "image", image)
+
+	writeJSON(w, http.StatusOK, Response{
+		Namespace: namespaceName,
+		AppName:   resourceName,
+		Image:     image,
+		Message:   fmt.Sprintf("Rolled back to revision %d", req.Revision),
+	})
+}
+
+func (s *Server) rollbackWebApp(ctx context.Context, namespace, name string, revision int64, triggeredBy string) (string, error) {
+	var image string
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		webApp, err := s.DynamicClient.Resource(webAppGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		revisions, _, err := unstructured.NestedSlice(webApp.Object, "status", "revisions")
+		if err != nil {
+			return err
+		}
+		image = ""
+		var commit string
+		for _, entry := range revisions {
+			rev, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if number, _, _ := unstructured.NestedInt64(rev, "revision"); number == revision {
+				image, _, _ = unstructured.NestedString(rev, "image")
+				commit, _, _ = unstructured.NestedString(rev, "commit")
+				break
+			}
+		}
+		if image == "" {
+			return errRevisionNotFound
+		}
+
+		if err := unstructured.SetNestedField(webApp.Object, image, "spec", "image"); err != nil {
+			return err
+		}
+		if commit != "" {
+			if err := unstructured.SetNestedField(webApp.Object, commit, "spec", "commit"); err != nil {
+				return err
+			}
+		} else {
+			unstructured.RemoveNestedField(webApp.Object, "spec", "commit")
+		}
+		annotations := webApp.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[triggeredByAnnotation] = triggeredBy
+		webApp.SetAnnotations(annotations)
+
+		_, err = s.DynamicClient.Resource(webAppGVR).Namespace(namespace).Update(ctx, webApp, metav1.UpdateOptions{})
+		return err
+	})
+	return image, err
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+)
+
+// Upper bound of replicas a user can request for a single app
+const maxScaleReplicas = 20
+
+// ScaleWebAppRequest sets either a fixed replica count or, with maxReplicas,
+// turns autoscaling on
+type ScaleWebAppRequest struct {
+	ProjectID            string `json:"projectID"`
+	ContainerID          string `json:"containerID"`
+	Replicas             *int32 `json:"replicas,omitempty"`
+	MinReplicas          *int32 `json:"minReplicas,omitempty"`
+	MaxReplicas          *int32 `json:"maxReplicas,omitempty"`
+	TargetCPUUtilization *int32 `json:"targetCPUUtilization,omitempty"` // Percent of the requested CPU, defaults to 80
+}
+
+func (req *ScaleWebAppRequest) validate() error {
+	if req.MaxReplicas == nil {
+		if req.Replicas == nil {
+			return fmt.Errorf("replicas or maxReplicas is required")
+		}
+		if req.MinReplicas != nil || req.TargetCPUUtilization != nil {
+			return fmt.Errorf("minReplicas and targetCPUUtilization require maxReplicas")
+		}
+		if *req.Replicas < 0 || *req.Replicas > maxScaleReplicas {
+			return fmt.Errorf("replicas must be between 0 and %d", maxScaleReplicas)
+		}
+		return nil
+	}
+
+	if req.Replicas != nil {
+		return fmt.Errorf("replicas cannot be combined with maxReplicas")
+	}
+	if *req.MaxReplicas < 1 || *req.MaxReplicas > maxScaleReplicas {
+		return fmt.Errorf("maxReplicas must be between 1 and %d", maxScaleReplicas)
+	}
+	if req.MinReplicas != nil && (*req.MinReplicas < 1 || *req.MinReplicas > *req.MaxReplicas) {
+		return fmt.Errorf("minReplicas must be between 1 and maxReplicas")
+	}
+	if req.TargetCPUUtilization != nil && (*req.TargetCPUUtilization < 1 || *req.TargetCPUUtilization > 100) {
+		return fmt.Errorf("targetCPUUtilization must be between 1 and 100")
+	}
+	return nil
+}
+
+// handleScaleWebApp changes the replica count or autoscaling bounds of a WebApp
+func (s *Server) handleScaleWebApp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ScaleWebAppRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if req.ProjectID == "" || req.ContainerID == "" {
+		http.Error(w, "projectID and containerID are required", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	namespaceName, err := validateAndSanitize(req.ProjectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	rawUUID, err := validateAndSanitize(req.ContainerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Container ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	resourceName := "app-" + rawUUID
+
+	if _, ok := s.authorizeProject(w, r, req.ProjectID, permissionDeploy); !ok {
+		return
+	}
+
+	if err := s.scaleWebApp(r.Context(), namespaceName, resourceName, req); err != nil {
+		if k8serrors.IsNotFound(err) {
+			http.Error(w, "WebApp not found", http.StatusNotFound)
+			return
+		}
+		s.Logger.Error("Failed to scale WebApp", "resourceName", resourceName, "error", err)
+		http.Error(w, "Failed to scale WebApp", http.StatusInternalServerError)
+		return
+	}
+
+	message := fmt.Sprintf("Scaled to %d replica(s)", derefInt32(req.Replicas))
+	if req.MaxReplicas != nil {
+		message = fmt.Sprintf("Autoscaling between %d and %d replicas", max(derefInt32(req.MinReplicas), 1), *req.MaxReplicas)
+	}
+	s.Logger.Info("WebApp scaled", "resourceName", resourceName, "message", message)
+
+	writeJSON(w, http.StatusOK, Response{
+		Namespace: namespaceName,
+		AppName:   resourceName,
+		Message:   message,
+	})
+}
+
+// scaleWebApp writes the scaling fields of the spec; fields of the other
+// mode are cleared so the operator knows whether to run an HPA
+func (s *Server) scaleWebApp(ctx context.Context, namespace, name string, req ScaleWebAppRequest) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		webApp, err := s.DynamicClient.Resource(webAppGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		fields := map[string]*int32{
+			"replicas":             req.Replicas,
+			"minReplicas":          req.MinReplicas,
+			"maxReplicas":          req.MaxReplicas,
+			"targetCPUUtilization": req.TargetCPUUtilization,
+		}
+		for field, value := range fields {
+			if value == nil {
+				unstructured.RemoveNestedField(webApp.Object, "spec", field)
+				continue
+			}
+			if err := unstructured.SetNestedField(webApp.Object, int64(*value), "spec", field); err != nil {
+				return err
+			}
+		}
+
+		_, err = s.DynamicClient.Resource(webAppGVR).Namespace(namespace).Update(ctx, webApp, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func derefInt32(v *int32) int32 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
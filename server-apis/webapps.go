@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// WebAppSpec mirrors the spec of the WebApp CRD
+type WebAppSpec struct {
+	ContainerID          string            `json:"containerID"`
+	DisplayName          string            `json:"displayName,omitempty"`
+	RepoURL              string            `json:"repoURL,omitempty"`
+	Branch               string            `json:"branch,omitempty"`
+	GitCredentials       string            `json:"gitCredentials,omitempty"`
+	Image                string            `json:"image,omitempty"`
+	Commit               string            `json:"commit,omitempty"`
+	Port                 int               `json:"port,omitempty"`
+	Replicas             *int32            `json:"replicas,omitempty"`
+	MinReplicas          *int32            `json:"minReplicas,omitempty"`
+	MaxReplicas          *int32            `json:"maxReplicas,omitempty"`
+	TargetCPUUtilization *int32            `json:"targetCPUUtilization,omitempty"`
+	Plan                 string            `json:"plan,omitempty"`
+	EnvVariables         map[string]string `json:"envVariables,omitempty"`
+	SecretEnv            []string          `json:"secretEnv,omitempty"` // Names only, the values stay in the Secret
+	CustomDomains        []string          `json:"customDomains,omitempty"`
+	Strategy             *Strategy         `json:"strategy,omitempty"`
+	HealthCheck          *HealthCheck      `json:"healthCheck,omitempty"`
+	Volumes              []Volume          `json:"volumes,omitempty"`
+	Ports                []AppPort         `json:"ports,omitempty"`
+	Databases            []DatabaseBinding `json:"databases,omitempty"`
+	Build                *BuildConfig      `json:"build,omitempty"`
+}
+
+// WebAppRevision mirrors an entry of status.revisions
+type WebAppRevision struct {
+	Revision    int64       `json:"revision"`
+	Image       string      `json:"image"`
+	Commit      string      `json:"commit,omitempty"`
+	DeployedAt  metav1.Time `json:"deployedAt"`
+	TriggeredBy string      `json:"triggeredBy,omitempty"`
+}
+
+// WebAppStatus mirrors the status of the WebApp CRD
+type WebAppStatus struct {
+	Conditions         []metav1.Condition   `json:"conditions,omitempty"`
+	ObservedGeneration int64                `json:"observedGeneration,omitempty"`
+	URL                string               `json:"url,omitempty"`
+	Replicas           int32                `json:"replicas,omitempty"`
+	ReadyReplicas      int32                `json:"readyReplicas,omitempty"`
+	CurrentImage       string               `json:"currentImage,omitempty"`
+	LastDeployedAt     *metav1.Time         `json:"lastDeployedAt,omitempty"`
+	Commit             string               `json:"commit,omitempty"`
+	Domains            []WebAppDomainStatus `json:"domains,omitempty"`
+	Revisions          []WebAppRevision     `json:"revisions,omitempty"`
+	Canary             *CanaryStatus        `json:"canary,omitempty"`
+	Endpoints          []EndpointStatus     `json:"endpoints,omitempty"`
+}
+
+// WebAppDetails is a WebApp as returned to the frontend
+type WebAppDetails struct {
+	Name           string               `json:"name"`
+	Namespace      string               `json:"namespace"`
+	URL            string               `json:"url"` // Empty until the operator reported it, once the app has an image
+	ReadyReplicas  int32                `json:"readyReplicas"`
+	CurrentImage   string               `json:"currentImage,omitempty"` // Image of the last completed rollout
+	LastDeployedAt *metav1.Time         `json:"lastDeployedAt,omitempty"`
+	Spec           WebAppSpec           `json:"spec"`
+	Conditions     []metav1.Condition   `json:"conditions"`
+	Domains        []WebAppDomainStatus `json:"domains,omitempty"`
+	Revisions      []WebAppRevision     `json:"revisions,omitempty"`
+	Canary         *CanaryStatus        `json:"canary,omitempty"`    // Release under way with the Canary strategy
+	Endpoints      []EndpointStatus     `json:"endpoints,omitempty"` // Where the extra ports are reachable
+	LatestBuild    *BuildStatus         `json:"latestBuild,omitempty"`
+	CreatedAt      metav1.Time          `json:"createdAt"`
+}
+
+// handleListWebApps lists the WebApps of a project, optionally filtered by containerID
+func (s *Server) handleListWebApps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	projectID := r.PathValue("projectID")
+	namespaceName, err := validateAndSanitize(projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	selector := labels.Set{}
+	if containerID := r.URL.Query().Get("containerID"); containerID != "" {
+		if errs := validation.IsValidLabelValue(containerID); len(errs) > 0 {
+			http.Error(w, "Invalid Container ID format", http.StatusBadRequest)
+			return
+		}
+		selector["container-id"] = containerID
+	}
+
+	if _, ok := s.authorizeProject(w, r, projectID, permissionReadProject); !ok {
+		return
+	}
+
+	webApps, err := s.DynamicClient.Resource(webAppGVR).Namespace(namespaceName).List(r.Context(), metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		s.Logger.Error("Failed to list WebApps", "namespace", namespaceName, "error", err)
+		http.Error(w, "Failed to list WebApps", http.StatusInternalServerError)
+		return
+	}
+
+	// One list per kind instead of a lookup per app
+	deployments, err := s.KubeClient.AppsV1().Deployments(namespaceName).List(r.Context(), metav1.ListOptions{
+		LabelSelector: labels.Set{"controller": "webapp"}.String(),
+	})
+	if err != nil {
+		s.Logger.Error("Failed to list deployments", "namespace", namespaceName, "error", err)
+		http.Error(w, "Failed to list WebApps", http.StatusInternalServerError)
+		return
+	}
+	deploymentsByName := make(map[string]*appsv1.Deployment, len(deployments.Items))
+	for i := range deployments.Items {
+		deploymentsByName[deployments.Items[i].Name] = &deployments.Items[i]
+	}
+
+	latestBuilds, err := s.latestBuilds(r.Context(), namespaceName, "")
+	if err != nil {
+		s.Logger.Error("Failed to list builds", "namespace", namespaceName, "error", err)
+		http.Error(w, "Failed to list WebApps", http.StatusInternalServerError)
+		return
+	}
+
+	sort.Slice(webApps.Items, func(i, j int) bool {
+		return webApps.Items[i].GetName() < webApps.Items[j].GetName()
+	})
+
+	result := make([]WebAppDetails, 0, len(webApps.Items))
+	for i := range webApps.Items {
+		details, err := webAppDetails(&webApps.Items[i], deploymentsByName[webApps.Items[i].GetName()])
+		if err != nil {
+			s.Logger.Error("Skipping WebApp with unreadable spec", "namespace", namespaceName, "name", webApps.Items[i].GetName(), "error", err)
+			continue
+		}
+		details.LatestBuild = latestBuilds[details.Name]
+		result = append(result, *details)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleGetWebApp returns a single WebApp of a project
+func (s *Server) handleGetWebApp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	projectID := r.PathValue("projectID")
+	namespaceName, err := validateAndSanitize(projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	rawUUID, err := validateAndSanitize(r.PathValue("containerID"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Container ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	resourceName := "app-" + rawUUID
+
+	if _, ok := s.authorizeProject(w, r, projectID, permissionReadProject); !ok {
+		return
+	}
+
+	webApp, err := s.DynamicClient.Resource(webAppGVR).Namespace(namespaceName).Get(r.Context(), resourceName, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			http.Error(w, "WebApp not found", http.StatusNotFound)
+			return
+		}
+		s.Logger.Error("Failed to get WebApp", "namespace", namespaceName, "resourceName", resourceName, "error", err)
+		http.Error(w, "Failed to get WebApp", http.StatusInternalServerError)
+		return
+	}
+
+	// The Deployment only exists once the first build succeeded
+	deployment, err := s.KubeClient.AppsV1().Deployments(namespaceName).Get(r.Context(), resourceName, metav1.GetOptions{})
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			s.Logger.Error("Failed to get deployment", "namespace", namespaceName, "resourceName", resourceName, "error", err)
+			http.Error(w, "Failed to get WebApp", http.StatusInternalServerError)
+			return
+		}
+		deployment = nil
+	}
+
+	details, err := webAppDetails(webApp, deployment)
+	if err != nil {
+		s.Logger.Error("Failed to read WebApp", "namespace", namespaceName, "resourceName", resourceName, "error", err)
+		http.Error(w, "Failed to get WebApp", http.StatusInternalServerError)
+		return
+	}
+
+	latestBuilds, err := s.latestBuilds(r.Context(), namespaceName, resourceName)
+	if err != nil {
+		s.Logger.Error("Failed to list builds", "namespace", namespaceName, "error", err)
+		http.Error(w, "Failed to get WebApp", http.StatusInternalServerError)
+		return
+	}
+	details.LatestBuild = latestBuilds[resourceName]
+
+	writeJSON(w, http.StatusOK, details)
+}
+
+// decodeWebApp converts a WebApp CR read through the dynamic client
+func decodeWebApp(webApp *unstructured.Unstructured) (WebAppSpec, WebAppStatus, error) {
+	var spec WebAppSpec
+	var status WebAppStatus
+
+	rawSpec, _, err := unstructured.NestedMap(webApp.Object, "spec")
+	if err != nil {
+		return spec, status, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawSpec, &spec); err != nil {
+		return spec, status, err
+	}
+
+	rawStatus, _, err := unstructured.NestedMap(webApp.Object, "status")
+	if err != nil {
+		return spec, status, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawStatus, &status); err != nil {
+		return spec, status, err
+	}
+	return spec, status, nil
+}
+
+func webAppDetails(webApp *unstructured.Unstructured, deployment *appsv1.Deployment) (*WebAppDetails, error) {
+	spec, status, err := decodeWebApp(webApp)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &WebAppDetails{
+		Name:           webApp.GetName(),
+		Namespace:      webApp.GetNamespace(),
+		URL:            status.URL,
+		ReadyReplicas:  status.ReadyReplicas,
+		CurrentImage:   status.CurrentImage,
+		LastDeployedAt: status.LastDeployedAt,
+		Spec:           spec,
+		Conditions:     status.Conditions,
+		Domains:        status.Domains,
+		Revisions:      status.Revisions,
+		Canary:         status.Canary,
+		Endpoints:      status.Endpoints,
+		CreatedAt:      webApp.GetCreationTimestamp(),
+	}
+	if details.Conditions == nil {
+		details.Conditions = []metav1.Condition{}
+	}
+	// The status counts the pods of whichever Deployment serves the traffic;
+	// the WebApp's own one is only a fallback until the operator reported
+	if deployment != nil && status.ObservedGeneration == 0 {
+		details.ReadyReplicas = deployment.Status.ReadyReplicas
+	}
+	return details, nil
+}
+
+// latestBuilds returns the newest build of each app in a project, keyed by app
+// name. An empty appName includes every app.
+func (s *Server) latestBuilds(ctx context.Context, namespaceName, appName string) (map[string]*BuildStatus, error) {
+	selector := labels.Set{"managed-by": "paas-backend", "project-id": namespaceName}
+	if appName != "" {
+		selector["app"] = appName
+	}
+	jobs, err := s.KubeClient.BatchV1().Jobs(buildNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]int)
+	for i := range jobs.Items {
+		app := jobs.Items[i].Labels["app"]
+		if j, ok := latest[app]; !ok || jobs.Items[j].CreationTimestamp.Before(&jobs.Items[i].CreationTimestamp) {
+			latest[app] = i
+		}
+	}
+
+	builds := make(map[string]*BuildStatus, len(latest))
+	for app, i := range latest {
+		status, err := s.buildStatus(ctx, &jobs.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		builds[app] = status
+	}
+	return builds, nil
+}
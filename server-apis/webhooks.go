@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// pushPayload holds the fields we need from GitHub, GitLab and Gitea push events
+type pushPayload struct {
+	Ref     string `json:"ref"`
+	After   string `json:"after"`
+	Deleted bool   `json:"deleted"`
+
+	Repository struct {
+		CloneURL      string `json:"clone_url"`    // GitHub, Gitea
+		SSHURL        string `json:"ssh_url"`      // GitHub, Gitea
+		HTMLURL       string `json:"html_url"`     // GitHub, Gitea
+		GitHTTPURL    string `json:"git_http_url"` // GitLab
+		GitSSHURL     string `json:"git_ssh_url"`  // GitLab
+		Homepage      string `json:"homepage"`     // GitLab
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+
+	Project struct {
+		DefaultBranch string `json:"default_branch"` // GitLab
+	} `json:"project"`
+
+	Pusher struct {
+		Name     string `json:"name"`     // GitHub
+		Username string `json:"username"` // Gitea
+	} `json:"pusher"`
+	UserUsername string `json:"user_username"` // GitLab
+}
+
+type WebhookResponse struct {
+	Message string     `json:"message"`
+	Builds  []Response `json:"builds"`
+}
+
+// handleGitWebhook rebuilds every WebApp, Worker and CronJob of a project
+// whose repository and branch match a push. Payloads are authenticated with
+// the webhook secret of the project: GitHub and Gitea sign the body with
+// HMAC-SHA256, GitLab echoes the secret token.
+func (s *Server) handleGitWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	namespaceName, err := validateAndSanitize(r.PathValue("projectID"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+		return
+	}
+	webhookSecret, err := s.gitWebhookSecret(r.Context(), namespaceName)
+	if err != nil {
+		s.Logger.Error("Failed to read webhook secret", "namespace", namespaceName, "error", err)
+		http.Error(w, "Failed to verify webhook", http.StatusInternalServerError)
+		return
+	}
+	if webhookSecret == "" {
+		http.Error(w, "Git webhooks are not configured for this project", http.StatusNotFound)
+		return
+	}
+
+	// Push payloads of large pushes can be several MB
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 10<<20))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	provider, event := webhookEvent(r.Header)
+	if provider == "" {
+		http.Error(w, "Unsupported webhook provider", http.StatusBadRequest)
+		return
+	}
+	if !verifyWebhook(provider, r.Header, body, webhookSecret) {
+		s.Logger.Warn("Rejected git webhook with invalid signature", "provider", provider, "namespace", namespaceName)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	if event != "push" && event != "Push Hook" {
+		writeJSON(w, http.StatusOK, WebhookResponse{Message: fmt.Sprintf("Ignored %s event", event), Builds: []Response{}})
+		return
+	}
+
+	var payload pushPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	branch, isBranch := strings.CutPrefix(payload.Ref, "refs/heads/")
+	if !isBranch || payload.Deleted {
+		writeJSON(w, http.StatusOK, WebhookResponse{Message: "Ignored push without a branch head", Builds: []Response{}})
+		return
+	}
+
+	builds, err := s.rebuildOnPush(r.Context(), namespaceName, provider, branch, &payload)
+	if err != nil {
+		s.Logger.Error("Failed to handle git push", "provider", provider, "namespace", namespaceName, "error", err)
+		http.Error(w, "Failed to trigger builds", http.StatusInternalServerError)
+		return
+	}
+
+	s.Logger.Info("Git push handled", "provider", provider, "namespace", namespaceName, "branch", branch, "builds", len(builds))
+	writeJSON(w, http.StatusAccepted, WebhookResponse{
+		Message: fmt.Sprintf("Triggered %d build(s)", len(builds)),
+		Builds:  builds,
+	})
+}
+
+// rebuildOnPush starts a build for each WebApp, Worker and CronJob of the
+// namespace tracking the pushed repository and branch
+func (s *Server) rebuildOnPush(ctx context.Context, namespace, provider, branch string, payload *pushPayload) ([]Response, error) {
+	repoURLs := make(map[string]bool)
+	for _, u := range []string{
+		payload.Repository.CloneURL,
+		payload.Repository.SSHURL,
+		payload.Repository.HTMLURL,
+		payload.Repository.GitHTTPURL,
+		payload.Repository.GitSSHURL,
+		payload.Repository.Homepage,
+	} {
+		if u != "" {
+			repoURLs[normalizeRepoURL(u)] = true
+		}
+	}
+
+	defaultBranch := payload.Repository.DefaultBranch
+	if defaultBranch == "" {
+		defaultBranch = payload.Project.DefaultBranch
+	}
+
+	triggeredBy := payload.Pusher.Name
+	if triggeredBy == "" {
+		triggeredBy = payload.Pusher.Username
+	}
+	if triggeredBy == "" {
+		triggeredBy = payload.UserUsername
+	}
+	triggeredBy = provider + ":" + triggeredBy
+
+	builds := []Response{}
+	for _, kindName := range workloadKindNames {
+		kind := workloadKinds[kindName]
+		workloads, err := s.DynamicClient.Resource(kind.GVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range workloads.Items {
+			workload := &workloads.Items[i]
+
+			var req BuildRequest
+			if kindName == kindWebApp {
+				req, err = buildRequestFromWebApp(workload)
+			} else {
+				req, err = buildRequestFromWorkload(kindName, workload)
+			}
+			if err != nil {
+				s.Logger.Error("Skipping CR with unreadable spec", "kind", kind.Kind, "namespace", workload.GetNamespace(), "name", workload.GetName(), "error", err)
+				continue
+			}
+			if req.ContainerID == "" || !repoURLs[normalizeRepoURL(req.RepoURL)] {
+				continue
+			}
+			trackedBranch := req.Branch
+			if trackedBranch == "" {
+				trackedBranch = defaultBranch
+			}
+			if trackedBranch != branch {
+				continue
+			}
+
+			req.TriggeredBy = triggeredBy
+			// Build exactly the pushed commit, even if the branch moved on since
+			if after := strings.ToLower(payload.After); commitRegex.MatchString(after) {
+				req.Commit = after
+			}
+			resp, buildErr := s.startBuild(ctx, req)
+			if buildErr != nil {
+				s.Logger.Error("Failed to rebuild on push", "kind", kind.Kind, "namespace", workload.GetNamespace(), "name", workload.GetName(), "error", buildErr)
+				continue
+			}
+			builds = append(builds, *resp)
+		}
+	}
+	return builds, nil
+}
+
+// buildRequestFromWebApp rebuilds the BuildRequest a WebApp was created from.
+// Environment variables are left out so the current ones are kept.
+func buildRequestFromWebApp(webApp *unstructured.Unstructured) (BuildRequest, error) {
+	spec, _, err := decodeWebApp(webApp)
+	if err != nil {
+		return BuildRequest{}, err
+	}
+
+	req := BuildRequest{
+		ContainerID:    spec.ContainerID,
+		ProjectID:      webApp.GetNamespace(),
+		Name:           spec.DisplayName,
+		RepoURL:        spec.RepoURL,
+		Branch:         spec.Branch,
+		Port:           spec.Port,
+		GitCredentials: spec.GitCredentials,
+	}
+	if spec.Build != nil {
+		req.BuildConfig = *spec.Build
+	}
+	return req, nil
+}
+
+// webhookEvent identifies the provider and event type of a webhook delivery.
+// Gitea also sends the GitHub headers, so it is checked first.
+func webhookEvent(header http.Header) (provider, event string) {
+	switch {
+	case header.Get("X-Gitea-Event") != "":
+		return "gitea", header.Get("X-Gitea-Event")
+	case header.Get("X-Gitlab-Event") != "":
+		return "gitlab", header.Get("X-Gitlab-Event")
+	case header.Get("X-GitHub-Event") != "":
+		return "github", header.Get("X-GitHub-Event")
+	}
+	return "", ""
+}
+
+func verifyWebhook(provider string, header http.Header, body []byte, secret string) bool {
+	switch provider {
+	case "github":
+		signature, ok := strings.CutPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+		return ok && validHMAC(body, signature, secret)
+	case "gitea":
+		return validHMAC(body, header.Get("X-Gitea-Signature"), secret)
+	case "gitlab":
+		token := header.Get("X-Gitlab-Token")
+		return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+	return false
+}
+
+// validHMAC checks a hex encoded HMAC-SHA256 signature of the body
+func validHMAC(body []byte, signature, secret string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// normalizeRepoURL reduces the HTTPS, SSH and scp-like forms of a repository
+// URL to "host/owner/repo" so they can be compared.
+func normalizeRepoURL(repoURL string) string {
+	u := strings.ToLower(strings.TrimSpace(repoURL))
+	for _, scheme := range []string{"https://", "http://", "ssh://", "git://"} {
+		u = strings.TrimPrefix(u, scheme)
+	}
+
+	// Drop user info such as "git@" or "oauth2:token@"
+	if at := strings.Index(u, "@"); at >= 0 && (strings.Index(u, "/") < 0 || at < strings.Index(u, "/")) {
+		u = u[at+1:]
+	}
+
+	// "host:port/path" or scp-like "host:owner/repo"
+	if colon := strings.Index(u, ":"); colon >= 0 && (strings.Index(u, "/") < 0 || colon < strings.Index(u, "/")) {
+		rest := u[colon+1:]
+		if slash := strings.Index(rest, "/"); slash > 0 && strings.Trim(rest[:slash], "0123456789") == "" {
+			rest = rest[slash+1:]
+		}
+		u = u[:colon] + "/" + rest
+	}
+
+	u = strings.TrimSuffix(u, "/")
+	return strings.TrimSuffix(u, ".git")
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+)
+
+var workerGVR = schema.GroupVersionResource{
+	Group:    "kleff.kleff.io",
+	Version:  "v1",
+	Resource: "workers",
+}
+
+var cronJobGVR = schema.GroupVersionResource{
+	Group:    "kleff.kleff.io",
+	Version:  "v1",
+	Resource: "cronjobs",
+}
+
+// Values of BuildRequest.Kind, also set as the workload-kind label of build Jobs
+const (
+	kindWebApp  = "webapp"
+	kindWorker  = "worker"
+	kindCronJob = "cronjob"
+)
+
+// workloadKind is a CRD the build pipeline deploys images to
+type workloadKind struct {
+	Kind   string // Kind of the CR
+	GVR    schema.GroupVersionResource
+	Prefix string // Put before the container UUID to name the CR
+}
+
+var workloadKinds = map[string]workloadKind{
+	kindWebApp:  {Kind: "WebApp", GVR: webAppGVR, Prefix: "app-"},
+	kindWorker:  {Kind: "Worker", GVR: workerGVR, Prefix: "worker-"},
+	kindCronJob: {Kind: "CronJob", GVR: cronJobGVR, Prefix: "cron-"},
+}
+
+// workloadKindNames lists the kinds in a stable order
+var workloadKindNames = []string{kindWebApp, kindWorker, kindCronJob}
+
+// lookupWorkloadKind resolves a BuildRequest.Kind, empty meaning a WebApp
+func lookupWorkloadKind(name string) (workloadKind, bool) {
+	if name == "" {
+		name = kindWebApp
+	}
+	kind, ok := workloadKinds[name]
+	return kind, ok
+}
+
+// CronSchedule mirrors the scheduling fields of the CronJob CRD
+type CronSchedule struct {
+	Schedule              string `json:"schedule"`                        // Cron expression such as "0 3 * * *"
+	TimeZone              string `json:"timeZone,omitempty"`              // Such as Europe/Paris, UTC when empty
+	ConcurrencyPolicy     string `json:"concurrencyPolicy,omitempty"`     // Allow, Forbid or Replace, defaults to Forbid
+	Suspend               bool   `json:"suspend,omitempty"`               // Stops scheduling new runs
+	BackoffLimit          *int32 `json:"backoffLimit,omitempty"`          // Retries of a failed run, 0 to 10, defaults to 0
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"` // Stops a longer run, defaults to one hour
+}
+
+// validate rejects what the CRD would, so the error reaches the caller
+// instead of failing the CronJob update
+func (c *CronSchedule) validate() error {
+	if len(strings.Fields(c.Schedule)) != 5 && !strings.HasPrefix(c.Schedule, "@") {
+		return fmt.Errorf("schedule must be a cron expression of five fields")
+	}
+	switch c.ConcurrencyPolicy {
+	case "", "Allow", "Forbid", "Replace":
+	default:
+		return fmt.Errorf("concurrencyPolicy must be Allow, Forbid or Replace")
+	}
+	if c.BackoffLimit != nil && (*c.BackoffLimit < 0 || *c.BackoffLimit > 10) {
+		return fmt.Errorf("backoffLimit must be between 0 and 10")
+	}
+	if c.ActiveDeadlineSeconds != nil && *c.ActiveDeadlineSeconds < 1 {
+		return fmt.Errorf("activeDeadlineSeconds must be positive")
+	}
+	return nil
+}
+
+// apply sets the scheduling fields on a CronJob spec
+func (c *CronSchedule) apply(spec map[string]interface{}) {
+	spec["schedule"] = c.Schedule
+	spec["suspend"] = c.Suspend
+	if c.TimeZone != "" {
+		spec["timeZone"] = c.TimeZone
+	} else {
+		delete(spec, "timeZone")
+	}
+	if c.ConcurrencyPolicy != "" {
+		spec["concurrencyPolicy"] = c.ConcurrencyPolicy
+	} else {
+		delete(spec, "concurrencyPolicy")
+	}
+	if c.BackoffLimit != nil {
+		spec["backoffLimit"] = int64(*c.BackoffLimit)
+	} else {
+		delete(spec, "backoffLimit")
+	}
+	if c.ActiveDeadlineSeconds != nil {
+		spec["activeDeadlineSeconds"] = *c.ActiveDeadlineSeconds
+	} else {
+		delete(spec, "activeDeadlineSeconds")
+	}
+}
+
+// validateWorkload checks the fields of a build request that depend on its kind
+func validateWorkload(kind string, req BuildRequest) error {
+	if kind != kindWebApp {
+		if req.HealthCheck != nil || req.Strategy != nil || req.Volumes != nil || req.Ports != nil || req.Port != 0 {
+			return fmt.Errorf("port, ports, healthCheck, strategy and volumes only apply to webapps")
+		}
+	}
+	if kind != kindWorker && req.Replicas != nil {
+		return fmt.Errorf("replicas only apply to workers")
+	}
+	if req.Replicas != nil && *req.Replicas < 0 {
+		return fmt.Errorf("replicas cannot be negative")
+	}
+	if kind != kindCronJob && req.Cron != nil {
+		return fmt.Errorf("cron only applies to cronjobs")
+	}
+	if req.Cron != nil {
+		return req.Cron.validate()
+	}
+	return nil
+}
+
+// createWorkload creates or updates a Worker or CronJob CR, the way
+// createWebApp does for WebApps. The image is left to watchBuilds, and the
+// command, replicas and schedule are kept on rebuilds when omitted.
+func (s *Server) createWorkload(ctx context.Context, kind workloadKind, namespace, resourceName string, req BuildRequest) error {
+	resources := s.DynamicClient.Resource(kind.GVR).Namespace(namespace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		workload, err := resources.Get(ctx, resourceName, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			workload = &unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": kind.GVR.GroupVersion().String(),
+					"kind":       kind.Kind,
+					"metadata": map[string]interface{}{
+						"name":      resourceName,
+						"namespace": namespace,
+						"labels": map[string]interface{}{
+							"container-id": req.ContainerID,
+						},
+					},
+					"spec": map[string]interface{}{
+						"containerID": req.ContainerID,
+					},
+				},
+			}
+		} else if err != nil {
+			return err
+		}
+
+		spec, ok := workload.Object["spec"].(map[string]interface{})
+		if !ok {
+			spec = make(map[string]interface{})
+		}
+		spec["displayName"] = req.Name
+		spec["repoURL"] = req.RepoURL
+		spec["branch"] = req.Branch
+		if req.EnvVariables != nil {
+			spec["envVariables"] = toInterfaceMap(req.EnvVariables)
+		}
+		if req.Plan != "" {
+			spec["plan"] = req.Plan
+		}
+		if req.Command != nil {
+			setStrings(spec, "command", req.Command)
+		}
+		if req.Args != nil {
+			setStrings(spec, "args", req.Args)
+		}
+		if req.Replicas != nil {
+			spec["replicas"] = int64(*req.Replicas)
+		}
+		if req.Cron != nil {
+			req.Cron.apply(spec)
+		}
+		if buildSpec := req.BuildConfig.specValue(); buildSpec != nil {
+			spec["build"] = buildSpec
+		} else {
+			delete(spec, "build")
+		}
+		if req.GitCredentials != "" {
+			spec["gitCredentials"] = req.GitCredentials
+		} else {
+			delete(spec, "gitCredentials")
+		}
+		workload.Object["spec"] = spec
+
+		if workload.GetResourceVersion() == "" {
+			_, err = resources.Create(ctx, workload, metav1.CreateOptions{})
+		} else {
+			_, err = resources.Update(ctx, workload, metav1.UpdateOptions{})
+		}
+		return err
+	})
+}
+
+func toInterfaceMap(values map[string]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		result[k] = v
+	}
+	return result
+}
+
+// setStrings sets a list of strings, removing it when empty
+func setStrings(spec map[string]interface{}, field string, values []string) {
+	if len(values) == 0 {
+		delete(spec, field)
+		return
+	}
+	list := make([]interface{}, len(values))
+	for i, value := range values {
+		list[i] = value
+	}
+	spec[field] = list
+}
+
+// WorkloadSpec mirrors the spec of the Worker and CronJob CRDs
+type WorkloadSpec struct {
+	ContainerID           string            `json:"containerID"`
+	DisplayName           string            `json:"displayName,omitempty"`
+	RepoURL               string            `json:"repoURL,omitempty"`
+	Branch                string            `json:"branch,omitempty"`
+	GitCredentials        string            `json:"gitCredentials,omitempty"`
+	Image                 string            `json:"image,omitempty"`
+	Commit                string            `json:"commit,omitempty"`
+	Command               []string          `json:"command,omitempty"`
+	Args                  []string          `json:"args,omitempty"`
+	Plan                  string            `json:"plan,omitempty"`
+	EnvVariables          map[string]string `json:"envVariables,omitempty"`
+	SecretEnv             []string          `json:"secretEnv,omitempty"` // Names only, the values stay in the Secret
+	Databases             []DatabaseBinding `json:"databases,omitempty"`
+	Build                 *BuildConfig      `json:"build,omitempty"`
+	Replicas              *int32            `json:"replicas,omitempty"` // Workers only
+	Schedule              string            `json:"schedule,omitempty"` // CronJobs only, as are the fields below
+	TimeZone              string            `json:"timeZone,omitempty"`
+	ConcurrencyPolicy     string            `json:"concurrencyPolicy,omitempty"`
+	Suspend               bool              `json:"suspend,omitempty"`
+	BackoffLimit          *int32            `json:"backoffLimit,omitempty"`
+	ActiveDeadlineSeconds *int64            `json:"activeDeadlineSeconds,omitempty"`
+}
+
+// WorkloadStatus mirrors the status of the Worker and CronJob CRDs
+type WorkloadStatus struct {
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	CurrentImage       string             `json:"currentImage,omitempty"`
+	Replicas           int32              `json:"replicas,omitempty"`       // Workers only
+	ReadyReplicas      int32              `json:"readyReplicas,omitempty"`  // Workers only
+	LastDeployedAt     *metav1.Time       `json:"lastDeployedAt,omitempty"` // Workers only
+	Active             int32              `json:"active,omitempty"`         // CronJobs only, as are the fields below
+	LastScheduleTime   *metav1.Time       `json:"lastScheduleTime,omitempty"`
+	LastSuccessfulTime *metav1.Time       `json:"lastSuccessfulTime,omitempty"`
+}
+
+// WorkloadDetails is a Worker or CronJob as returned to the frontend
+type WorkloadDetails struct {
+	Kind        string         `json:"kind"`
+	Name        string         `json:"name"`
+	Namespace   string         `json:"namespace"`
+	Spec        WorkloadSpec   `json:"spec"`
+	Status      WorkloadStatus `json:"status"`
+	LatestBuild *BuildStatus   `json:"latestBuild,omitempty"`
+	CreatedAt   metav1.Time    `json:"createdAt"`
+}
+
+func decodeWorkload(workload *unstructured.Unstructured) (WorkloadSpec, WorkloadStatus, error) {
+	var spec WorkloadSpec
+	var status WorkloadStatus
+
+	rawSpec, _, err := unstructured.NestedMap(workload.Object, "spec")
+	if err != nil {
+		return spec, status, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawSpec, &spec); err != nil {
+		return spec, status, err
+	}
+
+	rawStatus, _, err := unstructured.NestedMap(workload.Object, "status")
+	if err != nil {
+		return spec, status, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawStatus, &status); err != nil {
+		return spec, status, err
+	}
+	return spec, status, nil
+}
+
+// handleListWorkloads lists the Workers or CronJobs of a project
+func (s *Server) handleListWorkloads(kindName string) http.HandlerFunc {
+	kind := workloadKinds[kindName]
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		projectID := r.PathValue("projectID")
+		namespaceName, err := validateAndSanitize(projectID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := s.authorizeProject(w, r, projectID, permissionReadProject); !ok {
+			return
+		}
+
+		workloads, err := s.DynamicClient.Resource(kind.GVR).Namespace(namespaceName).List(r.Context(), metav1.ListOptions{})
+		if err != nil {
+			s.Logger.Error("Failed to list workloads", "kind", kind.Kind, "namespace", namespaceName, "error", err)
+			http.Error(w, fmt.Sprintf("Failed to list %ss", kind.Kind), http.StatusInternalServerError)
+			return
+		}
+		latestBuilds, err := s.latestBuilds(r.Context(), namespaceName, "")
+		if err != nil {
+			s.Logger.Error("Failed to list builds", "namespace", namespaceName, "error", err)
+			http.Error(w, fmt.Sprintf("Failed to list %ss", kind.Kind), http.StatusInternalServerError)
+			return
+		}
+
+		sort.Slice(workloads.Items, func(i, j int) bool {
+			return workloads.Items[i].GetName() < workloads.Items[j].GetName()
+		})
+
+		result := make([]WorkloadDetails, 0, len(workloads.Items))
+		for i := range workloads.Items {
+			workload := &workloads.Items[i]
+			spec, status, err := decodeWorkload(workload)
+			if err != nil {
+				s.Logger.Error("Skipping workload with unreadable spec", "kind", kind.Kind, "namespace", namespaceName, "name", workload.GetName(), "error", err)
+				continue
+			}
+			result = append(result, WorkloadDetails{
+				Kind:        kind.Kind,
+				Name:        workload.GetName(),
+				Namespace:   namespaceName,
+				Spec:        spec,
+				Status:      status,
+				LatestBuild: latestBuilds[workload.GetName()],
+				CreatedAt:   workload.GetCreationTimestamp(),
+			})
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// handleDeleteWorkload removes a Worker or CronJob CR. What the operator
+// runs for it is owned by the CR and garbage collected with it.
+func (s *Server) handleDeleteWorkload(kindName string) http.HandlerFunc {
+	kind := workloadKinds[kindName]
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		projectID := r.PathValue("projectID")
+		namespaceName, err := validateAndSanitize(projectID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid Project ID format: %v", err), http.StatusBadRequest)
+			return
+		}
+		rawUUID, err := validateAndSanitize(r.PathValue("containerID"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid Container ID format: %v", err), http.StatusBadRequest)
+			return
+		}
+		resourceName := kind.Prefix + rawUUID
+
+		if _, ok := s.authorizeProject(w, r, projectID, permissionWriteProject); !ok {
+			return
+		}
+
+		propagation := metav1.DeletePropagationBackground
+		err = s.DynamicClient.Resource(kind.GVR).Namespace(namespaceName).Delete(r.Context(), resourceName, metav1.DeleteOptions{
+			PropagationPolicy: &propagation,
+		})
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				http.Error(w, fmt.Sprintf("%s not found", kind.Kind), http.StatusNotFound)
+				return
+			}
+			s.Logger.Error("Failed to delete workload", "kind", kind.Kind, "namespace", namespaceName, "resourceName", resourceName, "error", err)
+			http.Error(w, fmt.Sprintf("Failed to delete %s", kind.Kind), http.StatusInternalServerError)
+			return
+		}
+
+		s.Logger.Info("Workload deleted", "kind", kind.Kind, "namespace", namespaceName, "resourceName", resourceName)
+
+		writeJSON(w, http.StatusOK, Response{
+			Namespace: namespaceName,
+			AppName:   resourceName,
+			Message:   fmt.Sprintf("%s deleted", kind.Kind),
+		})
+	}
+}
+
+// buildRequestFromWorkload rebuilds the BuildRequest a Worker or CronJob was
+// created from, for the Git webhooks. Environment variables, command and
+// schedule are left out so the current ones are kept.
+func buildRequestFromWorkload(kindName string, workload *unstructured.Unstructured) (BuildRequest, error) {
+	spec, _, err := decodeWorkload(workload)
+	if err != nil {
+		return BuildRequest{}, err
+	}
+
+	req := BuildRequest{
+		Kind:           kindName,
+		ContainerID:    spec.ContainerID,
+		ProjectID:      workload.GetNamespace(),
+		Name:           spec.DisplayName,
+		RepoURL:        spec.RepoURL,
+		Branch:         spec.Branch,
+		GitCredentials: spec.GitCredentials,
+	}
+	if spec.Build != nil {
+		req.BuildConfig = *spec.Build
+	}
+	return req, nil
+}